@@ -1,6 +1,8 @@
 package ast
 
 import (
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/makramkd/go-monkey/token"
@@ -9,6 +11,8 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	// Pos returns the position of the first character belonging to the node.
+	Pos() token.Position
 }
 
 type Statement interface {
@@ -36,6 +40,14 @@ func (p *Program) TokenLiteral() string {
 	return ""
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+
+	return token.Position{}
+}
+
 func (p *Program) String() string {
 	builder := strings.Builder{}
 
@@ -57,6 +69,8 @@ func (i *Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
 
+func (i *Identifier) Pos() token.Position { return i.Token.Pos }
+
 func (i *Identifier) String() string { return i.Value }
 
 // LetStatement represents a Monkey let statement.
@@ -76,6 +90,8 @@ func (l *LetStatement) TokenLiteral() string {
 	return l.Token.Literal
 }
 
+func (l *LetStatement) Pos() token.Position { return l.Token.Pos }
+
 func (l *LetStatement) String() string {
 	builder := strings.Builder{}
 	builder.WriteString(l.TokenLiteral() + " ")
@@ -102,6 +118,8 @@ func (r *ReturnStatement) TokenLiteral() string {
 	return r.Token.Literal
 }
 
+func (r *ReturnStatement) Pos() token.Position { return r.Token.Pos }
+
 func (r *ReturnStatement) String() string {
 	builder := strings.Builder{}
 	builder.WriteString(r.TokenLiteral() + " ")
@@ -126,6 +144,8 @@ func (e *ExpressionStatement) TokenLiteral() string {
 	return e.Token.Literal
 }
 
+func (e *ExpressionStatement) Pos() token.Position { return e.Token.Pos }
+
 func (e *ExpressionStatement) String() string {
 	if e.Expression != nil {
 		return e.Expression.String()
@@ -140,8 +160,19 @@ type IntegerLiteral struct {
 
 func (i *IntegerLiteral) expressionNode()      {}
 func (i *IntegerLiteral) TokenLiteral() string { return i.Token.Literal }
+func (i *IntegerLiteral) Pos() token.Position  { return i.Token.Pos }
 func (i *IntegerLiteral) String() string       { return i.Token.Literal }
 
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (f *FloatLiteral) expressionNode()      {}
+func (f *FloatLiteral) TokenLiteral() string { return f.Token.Literal }
+func (f *FloatLiteral) Pos() token.Position  { return f.Token.Pos }
+func (f *FloatLiteral) String() string       { return f.Token.Literal }
+
 type PrefixExpression struct {
 	Token    token.Token // the prefix token, e.g ! or -
 	Operator string
@@ -154,6 +185,8 @@ func (p *PrefixExpression) TokenLiteral() string {
 	return p.Token.Literal
 }
 
+func (p *PrefixExpression) Pos() token.Position { return p.Token.Pos }
+
 func (p *PrefixExpression) String() string {
 	builder := strings.Builder{}
 	builder.WriteRune('(')
@@ -163,6 +196,64 @@ func (p *PrefixExpression) String() string {
 	return builder.String()
 }
 
+type PostfixExpression struct {
+	Token    token.Token // the postfix token, e.g ++ or --
+	Left     Expression
+	Operator string
+}
+
+func (p *PostfixExpression) expressionNode() {}
+
+func (p *PostfixExpression) TokenLiteral() string { return p.Token.Literal }
+
+func (p *PostfixExpression) Pos() token.Position {
+	if p.Left != nil {
+		return p.Left.Pos()
+	}
+	return p.Token.Pos
+}
+
+func (p *PostfixExpression) String() string {
+	builder := strings.Builder{}
+	builder.WriteRune('(')
+	builder.WriteString(p.Left.String())
+	builder.WriteString(p.Operator)
+	builder.WriteRune(')')
+	return builder.String()
+}
+
+// AssignExpression represents rebinding an existing variable, e.g a = b or
+// a += b, or updating an element of an array or hash, e.g a[0] = b. Unlike a
+// let statement it doesn't introduce a new binding, but updates the one
+// visible from the current scope.
+type AssignExpression struct {
+	Token    token.Token // the assignment operator token
+	Target   Expression  // an identifier or index expression
+	Operator string      // =, +=, -=, *=, /= or %=
+	Value    Expression
+}
+
+func (a *AssignExpression) expressionNode() {}
+
+func (a *AssignExpression) TokenLiteral() string { return a.Token.Literal }
+
+func (a *AssignExpression) Pos() token.Position {
+	if a.Target != nil {
+		return a.Target.Pos()
+	}
+	return a.Token.Pos
+}
+
+func (a *AssignExpression) String() string {
+	builder := strings.Builder{}
+	builder.WriteRune('(')
+	builder.WriteString(a.Target.String() + " ")
+	builder.WriteString(a.Operator + " ")
+	builder.WriteString(a.Value.String())
+	builder.WriteRune(')')
+	return builder.String()
+}
+
 type InfixExpression struct {
 	Token    token.Token // the operator token
 	Left     Expression
@@ -174,6 +265,13 @@ func (i *InfixExpression) expressionNode() {}
 
 func (i *InfixExpression) TokenLiteral() string { return i.Token.Literal }
 
+func (i *InfixExpression) Pos() token.Position {
+	if i.Left != nil {
+		return i.Left.Pos()
+	}
+	return i.Token.Pos
+}
+
 func (i *InfixExpression) String() string {
 	builder := strings.Builder{}
 	builder.WriteRune('(')
@@ -192,6 +290,7 @@ type BooleanLiteral struct {
 func (b *BooleanLiteral) expressionNode() {}
 
 func (b *BooleanLiteral) TokenLiteral() string { return b.Token.Literal }
+func (b *BooleanLiteral) Pos() token.Position  { return b.Token.Pos }
 
 func (b *BooleanLiteral) String() string { return b.Token.Literal }
 
@@ -202,6 +301,7 @@ type BlockStatement struct {
 
 func (b *BlockStatement) statementNode()       {}
 func (b *BlockStatement) TokenLiteral() string { return b.Token.Literal }
+func (b *BlockStatement) Pos() token.Position  { return b.Token.Pos }
 func (b *BlockStatement) String() string {
 	builder := strings.Builder{}
 	for _, stmt := range b.Statements {
@@ -220,6 +320,7 @@ type IfExpression struct {
 func (i *IfExpression) expressionNode() {}
 
 func (i *IfExpression) TokenLiteral() string { return i.Token.Literal }
+func (i *IfExpression) Pos() token.Position  { return i.Token.Pos }
 
 func (i *IfExpression) String() string {
 	builder := strings.Builder{}
@@ -240,10 +341,12 @@ type FunctionLiteral struct {
 	Token      token.Token // the 'fn' token
 	Parameters []*Identifier
 	Body       *BlockStatement
+	Name       string // the name the function is bound to by a let statement, if any
 }
 
 func (f *FunctionLiteral) expressionNode()      {}
 func (f *FunctionLiteral) TokenLiteral() string { return f.Token.Literal }
+func (f *FunctionLiteral) Pos() token.Position  { return f.Token.Pos }
 func (f *FunctionLiteral) String() string {
 	builder := strings.Builder{}
 	builder.WriteString("fn")
@@ -269,6 +372,12 @@ type CallExpression struct {
 
 func (c *CallExpression) expressionNode()      {}
 func (c *CallExpression) TokenLiteral() string { return c.Token.Literal }
+func (c *CallExpression) Pos() token.Position {
+	if c.Function != nil {
+		return c.Function.Pos()
+	}
+	return c.Token.Pos
+}
 func (c *CallExpression) String() string {
 	builder := strings.Builder{}
 	builder.WriteByte('(')
@@ -292,6 +401,7 @@ type StringLiteral struct {
 
 func (s *StringLiteral) expressionNode()      {}
 func (s *StringLiteral) TokenLiteral() string { return s.Token.Literal }
+func (s *StringLiteral) Pos() token.Position  { return s.Token.Pos }
 func (s *StringLiteral) String() string       { return s.Token.Literal }
 
 type ArrayLiteral struct {
@@ -301,6 +411,7 @@ type ArrayLiteral struct {
 
 func (a *ArrayLiteral) expressionNode()      {}
 func (a *ArrayLiteral) TokenLiteral() string { return a.Token.Literal }
+func (a *ArrayLiteral) Pos() token.Position  { return a.Token.Pos }
 func (a *ArrayLiteral) String() string {
 	builder := strings.Builder{}
 	builder.WriteByte('[')
@@ -322,6 +433,12 @@ type IndexAccessExpression struct {
 
 func (a *IndexAccessExpression) expressionNode()      {}
 func (a *IndexAccessExpression) TokenLiteral() string { return a.Token.Literal }
+func (a *IndexAccessExpression) Pos() token.Position {
+	if a.Left != nil {
+		return a.Left.Pos()
+	}
+	return a.Token.Pos
+}
 func (a *IndexAccessExpression) String() string {
 	builder := strings.Builder{}
 	builder.WriteByte('(')
@@ -334,20 +451,55 @@ func (a *IndexAccessExpression) String() string {
 }
 
 type ImportStatement struct {
-	Token  token.Token // The 'import' token
-	Module *Identifier // The module to import, will be an identifier
+	Token  token.Token    // The 'import' token
+	Module *Identifier    // The standard module to import, if imported by name
+	Path   *StringLiteral // The path of the file to import, if imported by path
+	Alias  *Identifier    // The name the module is bound to, if given with 'as'
+	Names  []*Identifier  // The definitions to import from the module, if listed
 }
 
 func (i *ImportStatement) statementNode()       {}
 func (i *ImportStatement) TokenLiteral() string { return i.Token.Literal }
+func (i *ImportStatement) Pos() token.Position  { return i.Token.Pos }
 func (i *ImportStatement) String() string {
 	builder := strings.Builder{}
 	builder.WriteString("import ")
-	builder.WriteString(i.Module.Value)
+	if i.Path != nil {
+		builder.WriteString(strconv.Quote(i.Path.Value))
+	} else {
+		builder.WriteString(i.Module.Value)
+	}
+	if i.Alias != nil {
+		builder.WriteString(" as ")
+		builder.WriteString(i.Alias.Value)
+	}
+	if i.Names != nil {
+		names := make([]string, len(i.Names))
+		for j, name := range i.Names {
+			names[j] = name.Value
+		}
+		builder.WriteString(" (")
+		builder.WriteString(strings.Join(names, ", "))
+		builder.WriteString(")")
+	}
 	builder.WriteString(";")
 	return builder.String()
 }
 
+// MemberExpression accesses a definition of an imported module, e.g u.helper.
+type MemberExpression struct {
+	Token  token.Token // The '.' token
+	Left   Expression  // The module
+	Member *Identifier // The name of the definition
+}
+
+func (m *MemberExpression) expressionNode()      {}
+func (m *MemberExpression) TokenLiteral() string { return m.Token.Literal }
+func (m *MemberExpression) Pos() token.Position  { return m.Left.Pos() }
+func (m *MemberExpression) String() string {
+	return "(" + m.Left.String() + "." + m.Member.Value + ")"
+}
+
 type HashLiteral struct {
 	Token token.Token // The '{' token
 	Pairs map[Expression]Expression
@@ -355,18 +507,37 @@ type HashLiteral struct {
 
 func (h *HashLiteral) expressionNode()      {}
 func (h *HashLiteral) TokenLiteral() string { return h.Token.Literal }
+func (h *HashLiteral) Pos() token.Position  { return h.Token.Pos }
 func (h *HashLiteral) String() string {
 	builder := strings.Builder{}
 	builder.WriteByte('{')
 	pairs := []string{}
-	for k, v := range h.Pairs {
-		pairs = append(pairs, k.String()+":"+v.String())
+	for _, k := range h.Keys() {
+		pairs = append(pairs, k.String()+":"+h.Pairs[k].String())
 	}
 	builder.WriteString(strings.Join(pairs, ", "))
 	builder.WriteByte('}')
 	return builder.String()
 }
 
+// Keys returns the keys of the hash literal in the order in which they appear
+// in the source. Keys without a position (e.g hand-built in tests) are ordered
+// by their string representation so that the result is always deterministic.
+func (h *HashLiteral) Keys() []Expression {
+	keys := make([]Expression, 0, len(h.Pairs))
+	for k := range h.Pairs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		pi, pj := keys[i].Pos(), keys[j].Pos()
+		if pi.Offset != pj.Offset {
+			return pi.Offset < pj.Offset
+		}
+		return keys[i].String() < keys[j].String()
+	})
+	return keys
+}
+
 type ForEachStatement struct {
 	Token       token.Token     // The 'for' token
 	Identifiers []*Identifier   // The variables to capture into
@@ -376,6 +547,7 @@ type ForEachStatement struct {
 
 func (f *ForEachStatement) statementNode()       {}
 func (f *ForEachStatement) TokenLiteral() string { return f.Token.Literal }
+func (f *ForEachStatement) Pos() token.Position  { return f.Token.Pos }
 func (f *ForEachStatement) String() string {
 	builder := strings.Builder{}
 	builder.WriteString("for ")
@@ -390,10 +562,121 @@ func (f *ForEachStatement) String() string {
 	return builder.String()
 }
 
+// WhileStatement represents a loop that runs its body for as long as its
+// condition holds, e.g while (x < 10) { x++; }
+type WhileStatement struct {
+	Token     token.Token // The 'while' token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (w *WhileStatement) statementNode()       {}
+func (w *WhileStatement) TokenLiteral() string { return w.Token.Literal }
+func (w *WhileStatement) Pos() token.Position  { return w.Token.Pos }
+func (w *WhileStatement) String() string {
+	builder := strings.Builder{}
+	builder.WriteString("while")
+	builder.WriteString(w.Condition.String())
+	builder.WriteString(" ")
+	builder.WriteString(w.Body.String())
+	return builder.String()
+}
+
+// ForStatement represents a C-style for loop, e.g
+// for (let i = 0; i < 10; i++) { }
+// Any of the three clauses may be left out; a missing condition always holds.
+type ForStatement struct {
+	Token     token.Token // The 'for' token
+	Init      Statement   // Run once before the loop, may be nil
+	Condition Expression  // Checked before every iteration, may be nil
+	Step      Expression  // Run after every iteration, may be nil
+	Body      *BlockStatement
+}
+
+func (f *ForStatement) statementNode()       {}
+func (f *ForStatement) TokenLiteral() string { return f.Token.Literal }
+func (f *ForStatement) Pos() token.Position  { return f.Token.Pos }
+func (f *ForStatement) String() string {
+	builder := strings.Builder{}
+	builder.WriteString("for (")
+	if f.Init != nil {
+		builder.WriteString(f.Init.String())
+	}
+	// let statements print their own semicolon.
+	if _, ok := f.Init.(*LetStatement); !ok {
+		builder.WriteString(";")
+	}
+	if f.Condition != nil {
+		builder.WriteString(" " + f.Condition.String())
+	}
+	builder.WriteString(";")
+	if f.Step != nil {
+		builder.WriteString(" " + f.Step.String())
+	}
+	builder.WriteString(") ")
+	builder.WriteString(f.Body.String())
+	return builder.String()
+}
+
 type BreakStatement struct {
 	Token token.Token // The 'break' token
 }
 
 func (b *BreakStatement) statementNode()       {}
 func (b *BreakStatement) TokenLiteral() string { return b.Token.Literal }
+func (b *BreakStatement) Pos() token.Position  { return b.Token.Pos }
 func (b *BreakStatement) String() string       { return b.Token.Literal }
+
+type ContinueStatement struct {
+	Token token.Token // The 'continue' token
+}
+
+func (c *ContinueStatement) statementNode()       {}
+func (c *ContinueStatement) TokenLiteral() string { return c.Token.Literal }
+func (c *ContinueStatement) Pos() token.Position  { return c.Token.Pos }
+func (c *ContinueStatement) String() string       { return c.Token.Literal }
+
+// ThrowStatement raises an error, e.g throw "invalid record";
+type ThrowStatement struct {
+	Token token.Token // The 'throw' token
+	Value Expression
+}
+
+func (t *ThrowStatement) statementNode()       {}
+func (t *ThrowStatement) TokenLiteral() string { return t.Token.Literal }
+func (t *ThrowStatement) Pos() token.Position  { return t.Token.Pos }
+func (t *ThrowStatement) String() string {
+	return t.TokenLiteral() + " " + t.Value.String() + ";"
+}
+
+// TryStatement runs a block, handing any error it raises to the catch block
+// and running the finally block however the statement is left, e.g
+// try { parse(record) } catch (e) { puts(e["message"]) } finally { done++ }
+// Either the catch or the finally block may be left out, but not both.
+type TryStatement struct {
+	Token      token.Token // The 'try' token
+	Body       *BlockStatement
+	CatchParam *Identifier     // The name the caught error is bound to, if there's a catch block
+	Catch      *BlockStatement // may be nil
+	Finally    *BlockStatement // may be nil
+}
+
+func (t *TryStatement) statementNode()       {}
+func (t *TryStatement) TokenLiteral() string { return t.Token.Literal }
+func (t *TryStatement) Pos() token.Position  { return t.Token.Pos }
+func (t *TryStatement) String() string {
+	builder := strings.Builder{}
+	builder.WriteString("try ")
+	builder.WriteString(t.Body.String())
+	if t.Catch != nil {
+		builder.WriteString(" catch (")
+		builder.WriteString(t.CatchParam.String())
+		builder.WriteString(") ")
+		builder.WriteString(t.Catch.String())
+	}
+	if t.Finally != nil {
+		builder.WriteString(" finally ")
+		builder.WriteString(t.Finally.String())
+	}
+	return builder.String()
+}
@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/makramkd/go-monkey/ast"
+	"github.com/makramkd/go-monkey/lexer"
+	"github.com/makramkd/go-monkey/parser"
 	"github.com/makramkd/go-monkey/token"
 	"github.com/stretchr/testify/assert"
 )
@@ -27,3 +29,66 @@ func TestString(t *testing.T) {
 
 	assert.Equal(t, "let myVar = anotherVar;", program.String())
 }
+
+func TestDump(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let x = 1 + 2;",
+			`Program 1:1
+  Statements[0]: LetStatement 1:1
+    Name: Identifier 1:5 Value="x"
+    Value: InfixExpression 1:9 Operator="+"
+      Left: IntegerLiteral 1:9 Value=1
+      Right: IntegerLiteral 1:13 Value=2
+`,
+		},
+		{
+			"if (!ok) { f(1, true) }",
+			`Program 1:1
+  Statements[0]: ExpressionStatement 1:1
+    Expression: IfExpression 1:1
+      Condition: PrefixExpression 1:5 Operator="!"
+        Right: Identifier 1:6 Value="ok"
+      Consequence: BlockStatement 1:10
+        Statements[0]: ExpressionStatement 1:12
+          Expression: CallExpression 1:12
+            Function: Identifier 1:12 Value="f"
+            Arguments[0]: IntegerLiteral 1:14 Value=1
+            Arguments[1]: BooleanLiteral 1:17 Value=true
+`,
+		},
+		{
+			`{"b": 2, "a": 1.5}`,
+			`Program 1:1
+  Statements[0]: ExpressionStatement 1:1
+    Expression: HashLiteral 1:1
+      Pairs[0].Key: StringLiteral 1:2 Value="b"
+      Pairs[0].Value: IntegerLiteral 1:7 Value=2
+      Pairs[1].Key: StringLiteral 1:10 Value="a"
+      Pairs[1].Value: FloatLiteral 1:15 Value=1.5
+`,
+		},
+		{
+			"let f = fn(x) { return x; };",
+			`Program 1:1
+  Statements[0]: LetStatement 1:1
+    Name: Identifier 1:5 Value="f"
+    Value: FunctionLiteral 1:9 Name="f"
+      Parameters[0]: Identifier 1:12 Value="x"
+      Body: BlockStatement 1:15
+        Statements[0]: ReturnStatement 1:17
+          ReturnValue: Identifier 1:24 Value="x"
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		assert.Empty(t, p.Errors())
+		assert.Equal(t, tt.expected, ast.Dump(program), tt.input)
+	}
+}
@@ -0,0 +1,102 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/makramkd/go-monkey/token"
+)
+
+var (
+	nodeType  = reflect.TypeOf((*Node)(nil)).Elem()
+	tokenType = reflect.TypeOf(token.Token{})
+)
+
+// Dump returns the tree of node, one node per line, indented by depth. Each
+// line holds the field of the parent the node is in, the type and position
+// of the node and its fields that aren't nodes, e.g for `let x = 1 + 2;`:
+//
+//	Program 1:1
+//	  Statements[0]: LetStatement 1:1
+//	    Name: Identifier 1:5 Value="x"
+//	    Value: InfixExpression 1:9 Operator="+"
+//	      Left: IntegerLiteral 1:9 Value=1
+//	      Right: IntegerLiteral 1:13 Value=2
+func Dump(node Node) string {
+	var b strings.Builder
+	dump(&b, "", node, 0)
+	return b.String()
+}
+
+type child struct {
+	label string
+	node  Node
+}
+
+func dump(b *strings.Builder, label string, node Node, depth int) {
+	v := reflect.ValueOf(node).Elem()
+	t := v.Type()
+
+	b.WriteString(strings.Repeat("  ", depth))
+	if label != "" {
+		b.WriteString(label + ": ")
+	}
+	b.WriteString(t.Name() + " " + node.Pos().String())
+
+	var children []child
+	for i := 0; i < t.NumField(); i++ {
+		name, f := t.Field(i).Name, v.Field(i)
+
+		switch {
+		case f.Type() == tokenType:
+		case f.Type().Implements(nodeType):
+			if n, ok := toNode(f); ok {
+				children = append(children, child{name, n})
+			}
+		case f.Kind() == reflect.Slice:
+			for j := 0; j < f.Len(); j++ {
+				if n, ok := toNode(f.Index(j)); ok {
+					children = append(children, child{fmt.Sprintf("%s[%d]", name, j), n})
+				}
+			}
+		case f.Kind() == reflect.Map:
+			// Pairs are shown in the order they appear in the source.
+			keys := f.MapKeys()
+			sort.Slice(keys, func(i, j int) bool {
+				return keys[i].Interface().(Node).Pos().Offset < keys[j].Interface().(Node).Pos().Offset
+			})
+			for j, key := range keys {
+				k, _ := toNode(key)
+				children = append(children, child{fmt.Sprintf("%s[%d].Key", name, j), k})
+				if n, ok := toNode(f.MapIndex(key)); ok {
+					children = append(children, child{fmt.Sprintf("%s[%d].Value", name, j), n})
+				}
+			}
+		case f.Kind() == reflect.String:
+			if f.String() != "" {
+				fmt.Fprintf(b, " %s=%q", name, f.String())
+			}
+		default:
+			fmt.Fprintf(b, " %s=%v", name, f.Interface())
+		}
+	}
+	b.WriteString("\n")
+
+	for _, c := range children {
+		dump(b, c.label, c.node, depth+1)
+	}
+}
+
+// toNode returns the node held by v, reporting false if v is nil.
+func toNode(v reflect.Value) (Node, bool) {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		return nil, false
+	}
+	n, ok := v.Interface().(Node)
+	return n, ok
+}
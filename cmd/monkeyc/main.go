@@ -1,65 +1,189 @@
+// Command monkeyc runs Monkey programs and the tools that work on them.
+//
+// Usage:
+//
+//	monkeyc <command> [arguments]
+//
+// Run monkeyc help for the list of commands. Without a command, monkeyc
+// starts the REPL, and given a file instead of one, it runs the file, so that
+// scripts starting with #!/usr/bin/env monkeyc can be run directly.
 package main
 
 import (
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
-	"os/user"
+	"path/filepath"
+	"strings"
 
 	"github.com/makramkd/go-monkey/evaluator"
-	"github.com/makramkd/go-monkey/lexer"
-	"github.com/makramkd/go-monkey/object"
-	"github.com/makramkd/go-monkey/parser"
-	"github.com/makramkd/go-monkey/repl"
 )
 
-var stdlibModulesPath = flag.String("stdlib-modules-path", "", "The path to the Monkey standard library")
-var executableFile = flag.String("e", "", "The Monkey script to execute and exit")
+// Exit codes of monkeyc.
+const (
+	exitOK    = 0
+	exitError = 1 // the program failed to parse or run
+	exitUsage = 2 // monkeyc was run with the wrong arguments
+)
+
+// command is a subcommand of monkeyc.
+type command struct {
+	name  string
+	args  string // describes the arguments
+	short string
+	// run runs the command with the arguments following its name and
+	// returns the exit code of monkeyc.
+	run func(c *command, args []string) int
+	// flags are the flags of the command, which run parses.
+	flags *flag.FlagSet
+}
+
+var commands = []*command{
+	{name: "run", args: "[flags] <file | -> [arguments...]", short: "run a program", run: runRun},
+	{name: "repl", args: "[flags]", short: "start an interactive session", run: runREPL},
+	{name: "check", args: "<files...>", short: "report the syntax errors of programs", run: runCheck},
+	{name: "tokens", args: "<file | ->", short: "print the tokens of a program", run: runTokens},
+	{name: "ast", args: "<file | ->", short: "print the syntax tree of a program", run: runAST},
+	{name: "fmt", args: "[-l] [-w] [files...]", short: "format programs", run: runFmt},
+	{name: "test", args: "[flags] [files or directories...]", short: "run the tests in *_test.monkey files", run: runTest},
+}
 
 func main() {
-	user, err := user.Current()
-	if err != nil {
-		panic(err)
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) == 0 {
+		return runREPL(lookup("repl"), nil)
 	}
 
-	flag.Parse()
+	// Before there were commands, programs were run with -e, which still
+	// works.
+	if strings.HasPrefix(args[0], "-") && args[0] != "-" && args[0] != "-h" && args[0] != "-help" {
+		return runLegacy(args)
+	}
 
-	evaluator.SetStdlibPath(*stdlibModulesPath)
+	switch args[0] {
+	case "help", "-h", "-help":
+		usage(os.Stdout)
+		return exitOK
+	}
 
-	if *executableFile != "" {
-		executeMonkeyScript()
-		return
+	c := lookup(args[0])
+	if c == nil && isFile(args[0]) {
+		return runRun(lookup("run"), args)
+	}
+	if c == nil {
+		fmt.Fprintf(os.Stderr, "monkeyc: unknown command %q\n", args[0])
+		usage(os.Stderr)
+		return exitUsage
 	}
+	return c.run(c, args[1:])
+}
+
+func lookup(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
 
-	fmt.Printf("Hello, %s! This is the Monkey programming language!\n", user.Username)
-	fmt.Printf("Feel free to type in commands\n")
-	repl.Start(os.Stdin, os.Stdout)
+// isFile reports whether name is a regular file.
+func isFile(name string) bool {
+	info, err := os.Stat(name)
+	return err == nil && info.Mode().IsRegular()
 }
 
-func executeMonkeyScript() {
-	f, err := os.Open(*executableFile)
-	if err != nil {
-		panic(err)
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: monkeyc <command> [arguments]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", c.name, c.short)
 	}
+	fmt.Fprintf(w, "\nRun monkeyc <command> -h for the arguments of a command. Without a command, monkeyc starts the REPL, and given a file, it runs it.\n")
+}
 
-	b, err := ioutil.ReadAll(f)
-	if err != nil {
-		panic(err)
+// newFlags returns the flag set of c, which prints its usage on errors.
+func (c *command) newFlags() *flag.FlagSet {
+	c.flags = flag.NewFlagSet(c.name, flag.ContinueOnError)
+	c.flags.Usage = func() {
+		fmt.Fprintf(c.flags.Output(), "Usage: monkeyc %s %s\n\n%s.\n", c.name, c.args, strings.ToUpper(c.short[:1])+c.short[1:])
+		c.flags.PrintDefaults()
 	}
+	return c.flags
+}
 
-	l := lexer.New(string(b))
-	p := parser.New(l)
-	program := p.ParseProgram()
-	if len(p.Errors()) > 0 {
-		for _, e := range p.Errors() {
-			fmt.Printf("parse error: %s", e.Error())
-		}
-		return
+// parse parses the flags of c in args, reporting the exit code to return if
+// monkeyc should stop. The flags are those added to the set returned by
+// newFlags, if it was called.
+func (c *command) parse(args []string) (int, bool) {
+	if c.flags == nil || c.flags.Parsed() {
+		c.newFlags()
+	}
+	if err := c.flags.Parse(args); err == flag.ErrHelp {
+		return exitOK, false
+	} else if err != nil {
+		return exitUsage, false
+	}
+	return exitOK, true
+}
+
+// usageError reports wrong arguments to c.
+func (c *command) usageError(format string, args ...interface{}) int {
+	fmt.Fprintf(os.Stderr, "monkeyc %s: %s\n", c.name, fmt.Sprintf(format, args...))
+	c.flags.Usage()
+	return exitUsage
+}
+
+// engineFlags are the flags of the commands that run programs.
+type engineFlags struct {
+	engine            *string
+	checkedArithmetic *bool
+	stdlibModulesPath *string
+}
+
+func addEngineFlags(fs *flag.FlagSet) engineFlags {
+	return engineFlags{
+		engine:            fs.String("engine", "eval", "The engine to execute scripts with: vm or eval"),
+		checkedArithmetic: fs.Bool("checked-arithmetic", false, "Report integer overflow as a runtime error instead of wrapping around"),
+		stdlibModulesPath: addStdlibFlag(fs),
+	}
+}
+
+func addStdlibFlag(fs *flag.FlagSet) *string {
+	return fs.String("stdlib-modules-path", "", "Directories to look up standard modules in after the embedded standard library, separated like PATH")
+}
+
+// setup applies the flags that are global to the process.
+func (f engineFlags) setup() {
+	evaluator.SetStdlibPath(filepath.SplitList(*f.stdlibModulesPath)...)
+}
+
+// readSource reads the program in the named file, or standard input for
+// "-".
+func readSource(filename string) (string, error) {
+	if filename == "-" {
+		b, err := ioutil.ReadAll(os.Stdin)
+		return string(b), err
 	}
 
-	e := object.NewEnv()
-	ret := evaluator.Eval(program, e)
+	b, err := ioutil.ReadFile(filename)
+	return string(b), err
+}
+
+// sourceName is the name of the program in filename in positions.
+func sourceName(filename string) string {
+	if filename == "-" {
+		return "<stdin>"
+	}
+	return filename
+}
 
-	fmt.Printf("%s\n", ret.Inspect())
+// fail reports an error that stops monkeyc.
+func fail(err error) int {
+	fmt.Fprintf(os.Stderr, "monkeyc: %v\n", err)
+	return exitError
 }
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"ok.monkey":        "let x = 1;",
+		"error.monkey":     "let f = fn() { 1 / 0 }; f();",
+		"syntax.monkey":    "let = 1;",
+		"exit.monkey":      "import os; exit(len(args)); 1 / 0;",
+		"exit5.monkey":     "import os; exit(5);",
+		"script.monkey":    "#!/usr/bin/env monkeyc\nlet x = 1;",
+		"ok_test.monkey":   `let testOk = fn() { 1 };`,
+		"fail_test.monkey": `let testFail = fn() { throw "failed"; };`,
+	}
+	for name, src := range files {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0o644))
+	}
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	tests := []struct {
+		args []string
+		code int
+	}{
+		{[]string{"run", path("ok.monkey")}, exitOK},
+		{[]string{"run", "-engine=vm", path("ok.monkey")}, exitOK},
+		{[]string{"run", path("ok.monkey"), "extra", "-arguments"}, exitOK},
+		{[]string{"run", path("error.monkey")}, exitError},
+		{[]string{"run", "-engine=vm", path("error.monkey")}, exitError},
+		{[]string{"run", path("syntax.monkey")}, exitError},
+		{[]string{"run", path("missing.monkey")}, exitError},
+		{[]string{"run", path("exit.monkey")}, exitOK},
+		{[]string{"run", path("exit.monkey"), "a", "b", "c"}, 3},
+		{[]string{"run", "-engine=vm", path("exit.monkey"), "a", "b", "c"}, 3},
+		{[]string{"-e", path("exit.monkey"), "a"}, 1},
+		{[]string{path("exit.monkey"), "a", "b"}, 2},
+		{[]string{path("script.monkey")}, exitOK},
+		{[]string{"run", "-engine=nope", path("ok.monkey")}, exitUsage},
+		{[]string{"run"}, exitUsage},
+		{[]string{"run", "-nope"}, exitUsage},
+		{[]string{"-e", path("ok.monkey")}, exitOK},
+		{[]string{"-e", path("error.monkey")}, exitError},
+		{[]string{"check", path("ok.monkey"), path("error.monkey")}, exitOK},
+		{[]string{"check", path("ok.monkey"), path("syntax.monkey")}, exitError},
+		{[]string{"check"}, exitUsage},
+		{[]string{"tokens", path("ok.monkey")}, exitOK},
+		{[]string{"tokens", path("ok.monkey"), path("ok.monkey")}, exitUsage},
+		{[]string{"ast", path("ok.monkey")}, exitOK},
+		{[]string{"ast", path("syntax.monkey")}, exitError},
+		{[]string{"fmt", "-l", path("ok.monkey")}, exitOK},
+		{[]string{"fmt", path("syntax.monkey")}, exitError},
+		{[]string{"test", path("ok_test.monkey")}, exitOK},
+		{[]string{"test", path("fail_test.monkey")}, exitError},
+		{[]string{"test", dir}, exitError},
+		{[]string{"help"}, exitOK},
+		{[]string{"nope"}, exitUsage},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.code, run(tt.args), "%v", tt.args)
+	}
+
+	// Sessions piped into the REPL end with the status of exit, if it's
+	// called.
+	defer func(f *os.File) { os.Stdin = f }(os.Stdin)
+	sessions := []struct {
+		input string
+		code  int
+	}{
+		{"1 + 1\n", exitOK},
+		{"1 / 0\n", exitOK},
+		{"import os;\nexit(5)\n1 / 0\n", 5},
+		{":load " + path("exit5.monkey") + "\n:quit\n", 5},
+	}
+	for _, tt := range sessions {
+		for _, args := range [][]string{{"repl"}, {}} {
+			stdin, err := os.Open(writeFile(t, tt.input))
+			if !assert.NoError(t, err) {
+				continue
+			}
+			os.Stdin = stdin
+			assert.Equal(t, tt.code, run(args), "%v: %q", args, tt.input)
+			stdin.Close()
+		}
+	}
+}
+
+// writeFile writes src to a new temporary file, returning its name.
+func writeFile(t *testing.T, src string) string {
+	t.Helper()
+
+	f, err := ioutil.TempFile(t.TempDir(), "input")
+	assert.NoError(t, err)
+	_, err = f.WriteString(src)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	return f.Name()
+}
+
+func TestStdin(t *testing.T) {
+	stdin, err := ioutil.TempFile(t.TempDir(), "stdin")
+	assert.NoError(t, err)
+	_, err = stdin.WriteString("#!/usr/bin/env monkeyc\nimport os; exit(len(args));")
+	assert.NoError(t, err)
+	defer func(f *os.File) { os.Stdin = f }(os.Stdin)
+	os.Stdin = stdin
+
+	for _, engine := range []string{"eval", "vm"} {
+		_, err = stdin.Seek(0, io.SeekStart)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, run([]string{"run", "-engine=" + engine, "-", "a", "b"}), engine)
+	}
+}
+
+func TestFmtWrite(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "a.monkey")
+	assert.NoError(t, ioutil.WriteFile(filename, []byte("let  x=1+2;"), 0o644))
+
+	assert.Equal(t, exitOK, run([]string{"fmt", "-w", filename}))
+
+	b, err := ioutil.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, "let x = 1 + 2;\n", string(b))
+}
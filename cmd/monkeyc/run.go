@@ -0,0 +1,164 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+
+	monkey "github.com/makramkd/go-monkey"
+	"github.com/makramkd/go-monkey/ast"
+	"github.com/makramkd/go-monkey/compiler"
+	"github.com/makramkd/go-monkey/lexer"
+	"github.com/makramkd/go-monkey/object"
+	"github.com/makramkd/go-monkey/parser"
+	"github.com/makramkd/go-monkey/repl"
+	"github.com/makramkd/go-monkey/vm"
+)
+
+func runRun(c *command, args []string) int {
+	engine := addEngineFlags(c.newFlags())
+	if code, ok := c.parse(args); !ok {
+		return code
+	}
+	if c.flags.NArg() == 0 {
+		return c.usageError("no program to run")
+	}
+	engine.setup()
+
+	return runFile(c.flags.Arg(0), c.flags.Args()[1:], engine)
+}
+
+// runLegacy runs monkeyc as it was run before there were commands, with the
+// program to run given with -e.
+func runLegacy(args []string) int {
+	fs := flag.NewFlagSet("monkeyc", flag.ContinueOnError)
+	executableFile := fs.String("e", "", "The Monkey script to execute and exit")
+	engine := addEngineFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		usage(os.Stderr)
+		return exitUsage
+	}
+	engine.setup()
+
+	if *executableFile == "" {
+		return startREPL()
+	}
+	return runFile(*executableFile, fs.Args(), engine)
+}
+
+// runFile runs the program in filename, or standard input for "-", with the
+// given engine and arguments. Programs that call exit end with its status,
+// and those that fail with exitError.
+func runFile(filename string, args []string, engine engineFlags) int {
+	src, err := readSource(filename)
+	if err != nil {
+		return fail(err)
+	}
+
+	p := parser.New(lexer.NewWithFilename(sourceName(filename), src))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		for _, e := range p.Errors() {
+			fmt.Fprintln(os.Stderr, e)
+		}
+		return exitError
+	}
+
+	var runErr *object.Error
+	switch *engine.engine {
+	case "eval":
+		runErr = runEvaluator(program, args, *engine.checkedArithmetic)
+	case "vm":
+		runErr = runVM(program, args, *engine.checkedArithmetic)
+	default:
+		fmt.Fprintf(os.Stderr, "monkeyc: unknown engine: %s\n", *engine.engine)
+		return exitUsage
+	}
+
+	if runErr != nil && runErr.Kind == object.ExitError {
+		// Statuses beyond a byte would be truncated by the operating system,
+		// e.g 256 would end the process as if it had succeeded.
+		if runErr.Code < 0 || runErr.Code > 255 {
+			fmt.Fprintf(os.Stderr, "monkeyc: exit status out of range 0-255: %d\n", runErr.Code)
+			return exitError
+		}
+		return runErr.Code
+	}
+	if runErr != nil {
+		fmt.Fprintf(os.Stderr, "%s%s\n", runErr.Traceback(), runErr.Inspect())
+		return exitError
+	}
+	return exitOK
+}
+
+// argsArray returns the array of arguments that programs find in args.
+func argsArray(args []string) *object.Array {
+	values := make([]object.Object, len(args))
+	for i, arg := range args {
+		values[i] = &object.String{Value: arg}
+	}
+	return &object.Array{Values: values}
+}
+
+func runEvaluator(program *ast.Program, args []string, checkedArithmetic bool) *object.Error {
+	opts := []monkey.Option{monkey.WithGlobal("args", argsArray(args)), monkey.WithOSAccess()}
+	if checkedArithmetic {
+		opts = append(opts, monkey.WithCheckedArithmetic())
+	}
+
+	if _, err := monkey.New(opts...).Eval(program); err != nil {
+		return err.(*object.Error)
+	}
+	return nil
+}
+
+func runVM(program *ast.Program, args []string, checkedArithmetic bool) *object.Error {
+	comp := compiler.New()
+	argsIndex := comp.DefineGlobal("args")
+	if err := comp.Compile(program); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+
+	machine := vm.New(comp.Bytecode())
+	machine.SetGlobal(argsIndex, argsArray(args))
+	machine.SetCheckedArithmetic(checkedArithmetic)
+	machine.SetOSAccess(true)
+	if err := machine.Run(); err != nil {
+		if e, ok := err.(*object.Error); ok {
+			return e
+		}
+		return &object.Error{Message: err.Error()}
+	}
+	return nil
+}
+
+func runREPL(c *command, args []string) int {
+	fs := c.newFlags()
+	engine := engineFlags{stdlibModulesPath: addStdlibFlag(fs)}
+	if code, ok := c.parse(args); !ok {
+		return code
+	}
+	if c.flags.NArg() > 0 {
+		return c.usageError("unexpected arguments: %v", c.flags.Args())
+	}
+	engine.setup()
+
+	return startREPL()
+}
+
+func startREPL() int {
+	name := "there"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+
+	// Sessions end with the status that exit was called with, as programs
+	// run with monkeyc run do, e.g for sessions piped in by scripts.
+	return repl.Run(os.Stdin, repl.Config{
+		Stdout:   os.Stdout,
+		Stderr:   os.Stderr,
+		Greeting: fmt.Sprintf("Hello, %s! This is the Monkey programming language!\nFeel free to type in commands\n", name),
+		OSAccess: true,
+	})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	monkey "github.com/makramkd/go-monkey"
+	"github.com/makramkd/go-monkey/ast"
+	"github.com/makramkd/go-monkey/object"
+)
+
+// Tests are the functions without parameters whose names start with "test",
+// defined at the top level of files whose names end with "_test.monkey".
+// They fail if they end with an error, e.g one they throw.
+const (
+	testFileSuffix = "_test.monkey"
+	testPrefix     = "test"
+)
+
+func runTest(c *command, args []string) int {
+	fs := c.newFlags()
+	checkedArithmetic := fs.Bool("checked-arithmetic", false, "Report integer overflow as a runtime error instead of wrapping around")
+	engine := engineFlags{stdlibModulesPath: addStdlibFlag(fs)}
+	verbose := fs.Bool("v", false, "Print the name of every test that is run")
+	if code, ok := c.parse(args); !ok {
+		return code
+	}
+	engine.setup()
+
+	paths := c.flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := findTestFiles(paths)
+	if err != nil {
+		return fail(err)
+	}
+	if len(files) == 0 {
+		fmt.Println("no test files")
+		return exitOK
+	}
+
+	opts := []monkey.Option{monkey.WithGlobal("args", argsArray(nil)), monkey.WithOSAccess()}
+	if *checkedArithmetic {
+		opts = append(opts, monkey.WithCheckedArithmetic())
+	}
+
+	code := exitOK
+	for _, filename := range files {
+		if !testFile(filename, *verbose, opts) {
+			code = exitError
+		}
+	}
+	return code
+}
+
+// findTestFiles returns the test files among paths and in the directories
+// among them, recursively except for testdata directories.
+func findTestFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() && info.Name() == "testdata" {
+				return filepath.SkipDir
+			}
+			if !info.IsDir() && strings.HasSuffix(path, testFileSuffix) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// testFile runs the tests in filename, reporting whether they all passed.
+func testFile(filename string, verbose bool, opts []monkey.Option) bool {
+	program, ok := parseFile(filename)
+	if !ok {
+		fmt.Printf("FAIL\t%s\n", filename)
+		return false
+	}
+
+	interp := monkey.New(opts...)
+	if _, err := interp.Eval(program); err != nil {
+		printTestError(err)
+		fmt.Printf("FAIL\t%s\n", filename)
+		return false
+	}
+
+	names := testNames(program)
+	passed := true
+	for _, name := range names {
+		if _, err := interp.Call(name); err != nil {
+			fmt.Printf("--- FAIL: %s\n", name)
+			printTestError(err)
+			passed = false
+		} else if verbose {
+			fmt.Printf("--- PASS: %s\n", name)
+		}
+	}
+
+	if !passed {
+		fmt.Printf("FAIL\t%s\n", filename)
+		return false
+	}
+	fmt.Printf("ok\t%s\t(%d tests)\n", filename, len(names))
+	return true
+}
+
+// testNames returns the names of the tests defined by program, in the order
+// they are defined.
+func testNames(program *ast.Program) []string {
+	var names []string
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok || !strings.HasPrefix(let.Name.Value, testPrefix) {
+			continue
+		}
+		if fn, ok := let.Value.(*ast.FunctionLiteral); ok && len(fn.Parameters) == 0 {
+			names = append(names, let.Name.Value)
+		}
+	}
+	return names
+}
+
+// printTestError prints the error a test ended with, indented below it.
+func printTestError(err error) {
+	msg := err.Error()
+	if e, ok := err.(*object.Error); ok {
+		msg = e.Traceback() + e.Inspect()
+	}
+	for _, line := range strings.Split(strings.TrimRight(msg, "\n"), "\n") {
+		fmt.Printf("    %s\n", line)
+	}
+}
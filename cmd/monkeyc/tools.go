@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/makramkd/go-monkey/ast"
+	"github.com/makramkd/go-monkey/format"
+	"github.com/makramkd/go-monkey/lexer"
+	"github.com/makramkd/go-monkey/parser"
+	"github.com/makramkd/go-monkey/token"
+)
+
+// parseFile parses the program in filename, or standard input for "-",
+// reporting its errors.
+func parseFile(filename string) (*ast.Program, bool) {
+	src, err := readSource(filename)
+	if err != nil {
+		fail(err)
+		return nil, false
+	}
+
+	p := parser.New(lexer.NewWithFilename(sourceName(filename), src))
+	program := p.ParseProgram()
+	for _, e := range p.Errors() {
+		fmt.Fprintln(os.Stderr, e)
+	}
+	return program, len(p.Errors()) == 0
+}
+
+func runCheck(c *command, args []string) int {
+	if code, ok := c.parse(args); !ok {
+		return code
+	}
+	if c.flags.NArg() == 0 {
+		return c.usageError("no files to check")
+	}
+
+	code := exitOK
+	for _, filename := range c.flags.Args() {
+		if _, ok := parseFile(filename); !ok {
+			code = exitError
+		}
+	}
+	return code
+}
+
+// singleFile returns the only file that c is run on.
+func (c *command) singleFile(args []string) (string, int, bool) {
+	if code, ok := c.parse(args); !ok {
+		return "", code, false
+	}
+	if c.flags.NArg() != 1 {
+		return "", c.usageError("expected a single file"), false
+	}
+	return c.flags.Arg(0), exitOK, true
+}
+
+func runTokens(c *command, args []string) int {
+	filename, code, ok := c.singleFile(args)
+	if !ok {
+		return code
+	}
+
+	src, err := readSource(filename)
+	if err != nil {
+		return fail(err)
+	}
+
+	l := lexer.NewWithFilename(sourceName(filename), src)
+	l.SetKeepComments(true)
+	for tok := l.NextToken(); tok.T != token.EOF; tok = l.NextToken() {
+		fmt.Printf("%s %s %q\n", tok.Pos, tok.T, tok.Literal)
+		if tok.T == token.ILLEGAL {
+			code = exitError
+		}
+	}
+	return code
+}
+
+func runAST(c *command, args []string) int {
+	filename, code, ok := c.singleFile(args)
+	if !ok {
+		return code
+	}
+
+	program, ok := parseFile(filename)
+	if !ok {
+		return exitError
+	}
+	fmt.Print(ast.Dump(program))
+	return exitOK
+}
+
+func runFmt(c *command, args []string) int {
+	fs := c.newFlags()
+	list := fs.Bool("l", false, "List the files whose formatting differs instead of printing them")
+	write := fs.Bool("w", false, "Write the formatted programs to their files instead of printing them")
+	if code, ok := c.parse(args); !ok {
+		return code
+	}
+
+	if c.flags.NArg() == 0 {
+		if *write {
+			return c.usageError("cannot use -w with standard input")
+		}
+		return formatFile("-", *list, false)
+	}
+
+	code := exitOK
+	for _, filename := range c.flags.Args() {
+		if formatFile(filename, *list, *write) != exitOK {
+			code = exitError
+		}
+	}
+	return code
+}
+
+// formatFile formats the program in filename, or standard input for "-".
+func formatFile(filename string, list, write bool) int {
+	src, err := readSource(filename)
+	if err != nil {
+		return fail(err)
+	}
+
+	formatted, err := format.Source(sourceName(filename), []byte(src))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	changed := !bytes.Equal([]byte(src), formatted)
+	if list && changed {
+		fmt.Println(sourceName(filename))
+	}
+	if write && changed {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return fail(err)
+		}
+		if err := ioutil.WriteFile(filename, formatted, info.Mode()); err != nil {
+			return fail(err)
+		}
+	}
+	if !list && !write {
+		os.Stdout.Write(formatted)
+	}
+	return exitOK
+}
@@ -0,0 +1,307 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Instructions is a sequence of bytecode instructions, each consisting of a
+// one byte opcode followed by its operands.
+type Instructions []byte
+
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+
+	// Arithmetic
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpPow
+	OpRem
+
+	// Literals
+	OpTrue
+	OpFalse
+	OpNull
+
+	// Comparison and boolean operators
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpGreaterEqual
+	OpLessThan
+	OpLessEqual
+	OpAnd
+	OpOr
+
+	// Prefix operators
+	OpMinus
+	OpBang
+
+	// Control flow
+	OpJumpNotTruthy
+	OpJump
+
+	// Bindings
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+	OpGetBuiltin
+	OpGetFree
+	OpCurrentClosure
+	OpAssignGlobal
+	OpAssignLocal
+	OpAssignFree
+	OpGetLocalCell
+	OpGetFreeCell
+
+	// Composite values
+	OpArray
+	OpHash
+	OpIndex
+	OpSetIndex
+	OpDup2
+
+	// Functions
+	OpCall
+	OpReturnValue
+	OpReturn
+	OpClosure
+
+	// For-each loops
+	OpIterInit
+	OpIterNext
+
+	// Error handling
+	OpTry
+	OpEndTry
+	OpThrow
+	OpCatch
+
+	// Modules
+	OpImport
+
+	// Tail calls
+	OpTailCall
+)
+
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+
+	OpAdd: {"OpAdd", []int{}},
+	OpSub: {"OpSub", []int{}},
+	OpMul: {"OpMul", []int{}},
+	OpDiv: {"OpDiv", []int{}},
+	OpPow: {"OpPow", []int{}},
+	OpRem: {"OpRem", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpGreaterThan:  {"OpGreaterThan", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+	OpLessThan:     {"OpLessThan", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+	OpAnd:          {"OpAnd", []int{}},
+	OpOr:           {"OpOr", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	// The operand is the instruction offset to jump to.
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpJump:          {"OpJump", []int{2}},
+
+	OpGetGlobal:      {"OpGetGlobal", []int{2}},
+	OpSetGlobal:      {"OpSetGlobal", []int{2}},
+	OpGetLocal:       {"OpGetLocal", []int{2}},
+	OpSetLocal:       {"OpSetLocal", []int{2}},
+	OpGetBuiltin:     {"OpGetBuiltin", []int{1}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	// Unlike the Set instructions, which introduce a new binding, the Assign
+	// instructions update an existing one and leave the value on the stack.
+	OpAssignGlobal: {"OpAssignGlobal", []int{2}},
+	OpAssignLocal:  {"OpAssignLocal", []int{2}},
+	OpAssignFree:   {"OpAssignFree", []int{1}},
+	// Push the cell holding a variable rather than its value, so that a
+	// closure capturing it sees later assignments.
+	OpGetLocalCell: {"OpGetLocalCell", []int{2}},
+	OpGetFreeCell:  {"OpGetFreeCell", []int{1}},
+
+	// The operand is the number of elements (for hashes: keys and values)
+	// on the stack.
+	OpArray: {"OpArray", []int{2}},
+	OpHash:  {"OpHash", []int{2}},
+	OpIndex: {"OpIndex", []int{}},
+	// Sets an element of the array or hash below the index and value on the
+	// stack. The operand is 1 if the element's previous value should be left
+	// on the stack instead of the new one, as for postfix ++ and --.
+	OpSetIndex: {"OpSetIndex", []int{1}},
+	// Duplicates the two values on top of the stack, e.g the collection and
+	// index of a compound assignment.
+	OpDup2: {"OpDup2", []int{}},
+
+	// The operand is the number of arguments on the stack.
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+	// The operands are the constant index of the function and the number of
+	// free variables on the stack.
+	OpClosure: {"OpClosure", []int{2, 1}},
+
+	// The operand is the number of loop variables, i.e 1 for arrays and 2
+	// for hashes.
+	OpIterInit: {"OpIterInit", []int{1}},
+	// The operand is the instruction offset to jump to once the iterator is
+	// exhausted.
+	OpIterNext: {"OpIterNext", []int{2}},
+
+	// The operand is the instruction offset of the handler that errors
+	// raised before the matching OpEndTry jump to, with the error pushed
+	// onto the stack.
+	OpTry:    {"OpTry", []int{2}},
+	OpEndTry: {"OpEndTry", []int{}},
+	// Raises the value on top of the stack as an error. Errors pushed by a
+	// handler are raised again as they are.
+	OpThrow: {"OpThrow", []int{}},
+	// Replaces the error on top of the stack with the hash it is caught as.
+	OpCatch: {"OpCatch", []int{}},
+
+	// Runs a module the first time it's imported, leaving the result of the
+	// module on the stack, or null if it was imported already. The operand is
+	// the constant index of the function the module is compiled to.
+	OpImport: {"OpImport", []int{2}},
+
+	// Calls a function like OpCall, but replaces the frame of the calling
+	// function with the frame of the callee, whose return value is then
+	// returned from the calling function. The operand is the number of
+	// arguments on the stack.
+	OpTailCall: {"OpTailCall", []int{1}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// Make encodes the given opcode and operands into a single instruction.
+// An empty slice is returned for unknown opcodes.
+// Make encodes an instruction. Operands are truncated to their widths, so it's
+// up to callers to check that they fit.
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction described by def,
+// returning them along with the number of bytes read.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
@@ -0,0 +1,73 @@
+package code_test
+
+import (
+	"testing"
+
+	"github.com/makramkd/go-monkey/code"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMake(t *testing.T) {
+	testCases := []struct {
+		op       code.Opcode
+		operands []int
+		expected []byte
+	}{
+		{code.OpConstant, []int{65534}, []byte{byte(code.OpConstant), 255, 254}},
+		{code.OpAdd, []int{}, []byte{byte(code.OpAdd)}},
+		{code.OpGetLocal, []int{255}, []byte{byte(code.OpGetLocal), 0, 255}},
+		{code.OpClosure, []int{65534, 255}, []byte{byte(code.OpClosure), 255, 254, 255}},
+	}
+
+	for _, testCase := range testCases {
+		instruction := code.Make(testCase.op, testCase.operands...)
+		assert.Equal(t, testCase.expected, instruction)
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := []code.Instructions{
+		code.Make(code.OpAdd),
+		code.Make(code.OpGetLocal, 1),
+		code.Make(code.OpConstant, 2),
+		code.Make(code.OpConstant, 65535),
+		code.Make(code.OpClosure, 65535, 255),
+	}
+
+	expected := `0000 OpAdd
+0001 OpGetLocal 1
+0004 OpConstant 2
+0007 OpConstant 65535
+0010 OpClosure 65535 255
+`
+
+	concatted := code.Instructions{}
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+
+	assert.Equal(t, expected, concatted.String())
+}
+
+func TestReadOperands(t *testing.T) {
+	testCases := []struct {
+		op        code.Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{code.OpConstant, []int{65535}, 2},
+		{code.OpGetBuiltin, []int{255}, 1},
+		{code.OpClosure, []int{65535, 255}, 3},
+	}
+
+	for _, testCase := range testCases {
+		instruction := code.Make(testCase.op, testCase.operands...)
+
+		def, err := code.Lookup(byte(testCase.op))
+		assert.NoError(t, err)
+
+		operandsRead, n := code.ReadOperands(def, instruction[1:])
+		assert.Equal(t, testCase.bytesRead, n)
+		assert.Equal(t, testCase.operands, operandsRead)
+	}
+}
@@ -0,0 +1,1127 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/makramkd/go-monkey/ast"
+	"github.com/makramkd/go-monkey/code"
+	"github.com/makramkd/go-monkey/object"
+	"github.com/makramkd/go-monkey/token"
+)
+
+// Error is an error found while compiling, along with the position in the
+// source at which it was found.
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e *Error) Error() string {
+	if e.Pos.IsValid() {
+		return e.Pos.String() + ": " + e.Msg
+	}
+	return e.Msg
+}
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// CompilationScope holds the instructions of the function being compiled.
+type CompilationScope struct {
+	instructions        code.Instructions
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+	positions           map[int]token.Position
+	// loops holds the loops being compiled, innermost last.
+	loops []*loop
+	// tries holds the try statements being compiled, innermost last.
+	tries []*tryBlock
+}
+
+// loop collects the jumps emitted for break and continue statements so that
+// they can be patched once the loop has been compiled: breaks jump past the
+// end of the loop, continues to the start of its next iteration.
+type loop struct {
+	breaks    []int
+	continues []int
+	// tries is the number of try statements the loop is nested in.
+	tries int
+}
+
+// tryBlock is a try statement being compiled. Statements that jump out of it
+// have to remove its handler and run its finally block first.
+type tryBlock struct {
+	finally *ast.BlockStatement
+	// protected is set while compiling code covered by an OpTry handler: the
+	// body, and the catch block if there's a finally block.
+	protected bool
+	// pendingError is set while compiling the finally block run for an
+	// uncaught error, which stays on the stack until it's thrown again.
+	pendingError bool
+	// loops is the number of loops the statement is nested in.
+	loops int
+}
+
+type Compiler struct {
+	constants []object.Object
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	// pos is the position of the node being compiled, recorded for every
+	// emitted instruction.
+	pos token.Position
+
+	// modules are the modules imported so far, moduleIndex their indexes by
+	// key and importing the keys of those being compiled, outermost first.
+	modules     []*module
+	moduleIndex map[string]int
+	importing   []string
+
+	// tailCalls are the calls in tail position of the functions compiled so
+	// far.
+	tailCalls map[*ast.CallExpression]bool
+
+	// err is the first error met while emitting instructions, e.g because
+	// an operand doesn't fit in its instruction, which Compile returns.
+	err error
+}
+
+// module is an imported module, compiled to a function that the VM runs the
+// first time an import of it is run.
+type module struct {
+	name        string
+	fnIndex     int
+	symbolTable *SymbolTable
+}
+
+func New() *Compiler {
+	mainScope := CompilationScope{
+		instructions: code.Instructions{},
+		positions:    map[int]token.Position{},
+	}
+
+	symbolTable := NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: symbolTable,
+		scopes:      []CompilationScope{mainScope},
+		moduleIndex: map[string]int{},
+		tailCalls:   map[*ast.CallExpression]bool{},
+	}
+}
+
+// DefineGlobal defines a global variable that the host of the program sets,
+// with VM.SetGlobal, before running it. It returns the index of the global.
+func (c *Compiler) DefineGlobal(name string) int {
+	return c.symbolTable.DefineHostGlobal(name).Index
+}
+
+// Bytecode is the output of the compiler: the instructions of the main
+// program and the constants they refer to.
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+	// NumLocals is the number of local slots the main program needs for the
+	// variables of top level loops.
+	NumLocals int
+	Positions map[int]token.Position
+	// GlobalNames are the names of the globals by index, used to report
+	// references to globals that were never defined.
+	GlobalNames []string
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+		NumLocals:    c.symbolTable.NumLocals(),
+		Positions:    c.scopes[c.scopeIndex].positions,
+		GlobalNames:  c.symbolTable.GlobalNames(),
+	}
+}
+
+func (c *Compiler) Compile(node ast.Node) (err error) {
+	prevPos := c.pos
+	c.pos = node.Pos()
+	defer func() {
+		c.pos = prevPos
+		// Report instructions that couldn't be emitted as an error of the
+		// node they were emitted for.
+		if err == nil && c.err != nil {
+			err, c.err = c.err, nil
+		}
+	}()
+
+	switch node := node.(type) {
+	// Statements
+	case *ast.Program:
+		for i, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+
+			// The value of a program is the value of its last statement,
+			// which is null unless it's an expression.
+			if _, ok := s.(*ast.ExpressionStatement); !ok && i == len(node.Statements)-1 {
+				c.emit(code.OpNull)
+				c.emit(code.OpPop)
+			}
+		}
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+	case *ast.LetStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.bind(node.Name.Value)
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		if err := c.leaveTryBlocks(0, true); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+	case *ast.ImportStatement:
+		return c.compileImportStatement(node)
+	case *ast.ForEachStatement:
+		return c.compileForEachStatement(node)
+	case *ast.WhileStatement:
+		return c.compileWhileStatement(node)
+	case *ast.ForStatement:
+		return c.compileForStatement(node)
+	case *ast.ThrowStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+	case *ast.TryStatement:
+		return c.compileTryStatement(node)
+	case *ast.BreakStatement:
+		if len(c.currentScope().loops) == 0 {
+			return c.errorf("break cannot be used outside a loop context")
+		}
+		l := c.currentScope().loops[len(c.currentScope().loops)-1]
+		if err := c.leaveTryBlocks(l.tries, false); err != nil {
+			return err
+		}
+		l.breaks = append(l.breaks, c.emit(code.OpJump, 9999))
+	case *ast.ContinueStatement:
+		if len(c.currentScope().loops) == 0 {
+			return c.errorf("continue cannot be used outside a loop context")
+		}
+		l := c.currentScope().loops[len(c.currentScope().loops)-1]
+		if err := c.leaveTryBlocks(l.tries, false); err != nil {
+			return err
+		}
+		l.continues = append(l.continues, c.emit(code.OpJump, 9999))
+
+	// Expressions
+	case *ast.IntegerLiteral:
+		integer := &object.Integer{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(integer))
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+	case *ast.BooleanLiteral:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	case *ast.PrefixExpression:
+		if node.Operator == "++" || node.Operator == "--" {
+			return c.compileIncrement(node.Operator, node.Right, true)
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return c.errorf("unknown operator %s", node.Operator)
+		}
+	case *ast.InfixExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		op, ok := infixOperators[node.Operator]
+		if !ok {
+			return c.errorf("unknown operator %s", node.Operator)
+		}
+		c.emit(op)
+	case *ast.PostfixExpression:
+		return c.compileIncrement(node.Operator, node.Left, false)
+	case *ast.AssignExpression:
+		return c.compileAssignExpression(node)
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			// The identifier may be a global that is defined later on, e.g a
+			// function that calls another one defined after it. If it isn't,
+			// the VM reports it when the global is read.
+			symbol = c.symbolTable.Global().Define(node.Value)
+		}
+		if symbol.Scope == ModuleScope {
+			return c.errorf("cannot use module %s as a value", node.Value)
+		}
+		c.loadSymbol(symbol)
+	case *ast.MemberExpression:
+		return c.compileMemberExpression(node)
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+	case *ast.HashLiteral:
+		keys := node.Keys()
+		for _, k := range keys {
+			if err := c.Compile(k); err != nil {
+				return err
+			}
+			if err := c.Compile(node.Pairs[k]); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(keys)*2)
+	case *ast.IndexAccessExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node)
+	case *ast.CallExpression:
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+		for _, a := range node.Arguments {
+			if err := c.Compile(a); err != nil {
+				return err
+			}
+		}
+		if c.tailCalls[node] {
+			c.emit(code.OpTailCall, len(node.Arguments))
+		} else {
+			c.emit(code.OpCall, len(node.Arguments))
+		}
+	default:
+		return c.errorf("unsupported node %T", node)
+	}
+
+	return nil
+}
+
+var infixOperators = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"**": code.OpPow,
+	"%":  code.OpRem,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	">":  code.OpGreaterThan,
+	">=": code.OpGreaterEqual,
+	"<":  code.OpLessThan,
+	"<=": code.OpLessEqual,
+	"&&": code.OpAnd,
+	"||": code.OpOr,
+}
+
+// compoundOperators maps compound assignment operators to the infix operator
+// they apply before assigning.
+var compoundOperators = map[string]string{
+	"+=": "+",
+	"-=": "-",
+	"*=": "*",
+	"/=": "/",
+	"%=": "%",
+	"++": "+",
+	"--": "-",
+}
+
+func (c *Compiler) compileAssignExpression(node *ast.AssignExpression) error {
+	if target, ok := node.Target.(*ast.IndexAccessExpression); ok {
+		return c.compileIndexAssignment(target, node.Operator, node.Value)
+	}
+
+	symbol, err := c.resolveAssignable(node.Target)
+	if err != nil {
+		return err
+	}
+
+	op, compound := compoundOperators[node.Operator]
+	if compound {
+		c.loadSymbol(symbol)
+	}
+
+	if err := c.Compile(node.Value); err != nil {
+		return err
+	}
+
+	if compound {
+		c.emit(infixOperators[op])
+	}
+
+	c.assignSymbol(symbol)
+	return nil
+}
+
+// compileIncrement compiles ++ and --, leaving the updated value on the stack
+// when used as a prefix and the original value when used as a postfix.
+func (c *Compiler) compileIncrement(operator string, target ast.Expression, prefix bool) error {
+	if target, ok := target.(*ast.IndexAccessExpression); ok {
+		return c.compileIndexIncrement(operator, target, prefix)
+	}
+
+	symbol, err := c.resolveAssignable(target)
+	if err != nil {
+		return err
+	}
+
+	c.loadSymbol(symbol)
+	if !prefix {
+		c.loadSymbol(symbol)
+	}
+	c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: 1}))
+	c.emit(infixOperators[compoundOperators[operator]])
+	c.assignSymbol(symbol)
+	if !prefix {
+		c.emit(code.OpPop)
+	}
+
+	return nil
+}
+
+// compileIndexAssignment compiles an assignment to an element of an array or
+// hash. The collection and index are only evaluated once, with compound
+// assignments duplicating them to read the current value:
+//
+//	<collection>
+//	<index>
+//	OpDup2, OpIndex, for compound assignments
+//	<value>
+//	<operator>, for compound assignments
+//	OpSetIndex 0
+func (c *Compiler) compileIndexAssignment(target *ast.IndexAccessExpression, operator string, value ast.Expression) error {
+	if err := c.Compile(target.Left); err != nil {
+		return err
+	}
+	if err := c.Compile(target.Index); err != nil {
+		return err
+	}
+
+	op, compound := compoundOperators[operator]
+	if compound {
+		c.emit(code.OpDup2)
+		c.emit(code.OpIndex)
+	}
+
+	if err := c.Compile(value); err != nil {
+		return err
+	}
+
+	if compound {
+		c.emit(infixOperators[op])
+	}
+
+	c.emit(code.OpSetIndex, 0)
+	return nil
+}
+
+func (c *Compiler) compileIndexIncrement(operator string, target *ast.IndexAccessExpression, prefix bool) error {
+	if err := c.Compile(target.Left); err != nil {
+		return err
+	}
+	if err := c.Compile(target.Index); err != nil {
+		return err
+	}
+
+	c.emit(code.OpDup2)
+	c.emit(code.OpIndex)
+	c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: 1}))
+	c.emit(infixOperators[compoundOperators[operator]])
+
+	if prefix {
+		c.emit(code.OpSetIndex, 0)
+	} else {
+		c.emit(code.OpSetIndex, 1)
+	}
+	return nil
+}
+
+func (c *Compiler) resolveAssignable(target ast.Expression) (Symbol, error) {
+	ident, ok := target.(*ast.Identifier)
+	if !ok {
+		return Symbol{}, c.errorf("cannot assign to %s", target.String())
+	}
+
+	symbol, ok := c.symbolTable.Resolve(ident.Value)
+	if !ok {
+		// As with reads, the global may be defined later on. The VM reports
+		// it if it isn't defined by the time it's assigned to.
+		return c.symbolTable.Global().Define(ident.Value), nil
+	}
+
+	switch c.symbolTable.origin(symbol).Scope {
+	case BuiltinScope:
+		return symbol, c.errorf("identifier not found: %s", ident.Value)
+	case ModuleScope:
+		return symbol, c.errorf("cannot assign to module %s", ident.Value)
+	case FunctionScope:
+		return symbol, c.errorf("cannot assign to %s inside its own definition", ident.Value)
+	}
+
+	return symbol, nil
+}
+
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if err := c.compileBlockValue(node.Consequence); err != nil {
+		return err
+	}
+
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else {
+		if err := c.compileBlockValue(node.Alternative); err != nil {
+			return err
+		}
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+// compileBlockValue compiles a block that leaves its value on the stack: the
+// value of its last statement if that's an expression, null otherwise.
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+
+	if endsWithExpression(block) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+
+	return nil
+}
+
+func endsWithExpression(block *ast.BlockStatement) bool {
+	if len(block.Statements) == 0 {
+		return false
+	}
+	_, ok := block.Statements[len(block.Statements)-1].(*ast.ExpressionStatement)
+	return ok
+}
+
+func endsWithReturn(block *ast.BlockStatement) bool {
+	if len(block.Statements) == 0 {
+		return false
+	}
+	_, ok := block.Statements[len(block.Statements)-1].(*ast.ReturnStatement)
+	return ok
+}
+
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral) error {
+	// Functions bound to a global can refer to themselves through that
+	// global. Anywhere else, let the function refer to itself directly since
+	// its name is only bound once the function has been created.
+	selfReference := node.Name != "" && c.symbolTable.Outer != nil
+
+	c.enterScope()
+
+	if selfReference {
+		c.symbolTable.DefineFunctionName(node.Name)
+	}
+
+	for _, p := range node.Parameters {
+		c.symbolTable.Define(p.Value)
+	}
+
+	c.markTailCalls(node.Body, true)
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+
+	// Only check the last statement, rather than the last instruction, for a
+	// return: e.g a try statement may end with one that other paths jump past.
+	if endsWithExpression(node.Body) {
+		c.replaceLastPopWithReturn()
+	} else if !endsWithReturn(node.Body) {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.NumLocals()
+	positions := c.currentScope().positions
+	instructions := c.leaveScope()
+
+	for _, s := range freeSymbols {
+		c.loadCell(s)
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		Name:          node.Name,
+		Positions:     positions,
+		Source:        object.InspectFunction(node.Parameters, node.Body),
+	}
+
+	fnIndex := c.addConstant(compiledFn)
+	c.emit(code.OpClosure, fnIndex, len(freeSymbols))
+
+	return nil
+}
+
+// compileForEachStatement compiles a for-each loop. The loop body gets a
+// scope of its own, with the iterator stored in a hidden variable:
+//
+//	<collection>
+//	OpIterInit <number of loop variables>
+//	<set $iter>
+//	start:
+//	<get $iter>
+//	OpIterNext end
+//	<set loop variables>
+//	<body>
+//	OpJump start
+//	end:
+func (c *Compiler) compileForEachStatement(node *ast.ForEachStatement) error {
+	if err := c.Compile(node.Collection); err != nil {
+		return err
+	}
+
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+	defer func() { c.symbolTable = c.symbolTable.Outer }()
+
+	// '$' can't appear in identifiers so this can't clash with user variables.
+	iter := c.symbolTable.Define("$iter")
+
+	c.emit(code.OpIterInit, len(node.Identifiers))
+	c.setSymbol(iter)
+
+	start := len(c.currentInstructions())
+	c.loadSymbol(iter)
+	iterNextPos := c.emit(code.OpIterNext, 9999)
+
+	// Values are pushed in order, so the last one is on top of the stack.
+	for i := len(node.Identifiers) - 1; i >= 0; i-- {
+		c.setSymbol(c.symbolTable.Define(node.Identifiers[i].Value))
+	}
+
+	l, err := c.compileLoopBody(node.Body)
+	if err != nil {
+		return err
+	}
+
+	c.emit(code.OpJump, start)
+
+	end := len(c.currentInstructions())
+	c.changeOperand(iterNextPos, end)
+	c.patchLoop(l, start, end)
+
+	return nil
+}
+
+// compileWhileStatement compiles a while loop:
+//
+//	start:
+//	<condition>
+//	OpJumpNotTruthy end
+//	<body>
+//	OpJump start
+//	end:
+func (c *Compiler) compileWhileStatement(node *ast.WhileStatement) error {
+	start := len(c.currentInstructions())
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+	l, err := c.compileLoopBody(node.Body)
+	c.symbolTable = c.symbolTable.Outer
+	if err != nil {
+		return err
+	}
+
+	c.emit(code.OpJump, start)
+
+	end := len(c.currentInstructions())
+	c.changeOperand(jumpNotTruthyPos, end)
+	c.patchLoop(l, start, end)
+
+	return nil
+}
+
+// compileForStatement compiles a C-style for loop. The init clause gets a
+// scope of its own, shared by every iteration, and the body a nested one:
+//
+//	<init>
+//	start:
+//	<condition>
+//	OpJumpNotTruthy end
+//	<body>
+//	next:
+//	<step>
+//	OpJump start
+//	end:
+func (c *Compiler) compileForStatement(node *ast.ForStatement) error {
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+	defer func() { c.symbolTable = c.symbolTable.Outer }()
+
+	if node.Init != nil {
+		if err := c.Compile(node.Init); err != nil {
+			return err
+		}
+	}
+
+	start := len(c.currentInstructions())
+	jumpNotTruthyPos := -1
+	if node.Condition != nil {
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+		jumpNotTruthyPos = c.emit(code.OpJumpNotTruthy, 9999)
+	}
+
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+	l, err := c.compileLoopBody(node.Body)
+	c.symbolTable = c.symbolTable.Outer
+	if err != nil {
+		return err
+	}
+
+	next := len(c.currentInstructions())
+	if node.Step != nil {
+		if err := c.Compile(node.Step); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+	}
+
+	c.emit(code.OpJump, start)
+
+	end := len(c.currentInstructions())
+	if jumpNotTruthyPos != -1 {
+		c.changeOperand(jumpNotTruthyPos, end)
+	}
+	c.patchLoop(l, next, end)
+
+	return nil
+}
+
+// compileLoopBody compiles the body of a loop, collecting the break and
+// continue statements that belong to it.
+func (c *Compiler) compileLoopBody(body *ast.BlockStatement) (*loop, error) {
+	l := &loop{tries: len(c.currentScope().tries)}
+	c.scopes[c.scopeIndex].loops = append(c.currentScope().loops, l)
+
+	if err := c.Compile(body); err != nil {
+		return nil, err
+	}
+
+	c.scopes[c.scopeIndex].loops = c.currentScope().loops[:len(c.currentScope().loops)-1]
+	return l, nil
+}
+
+// patchLoop points the continue statements of a loop at next and its break
+// statements at end.
+func (c *Compiler) patchLoop(l *loop, next, end int) {
+	for _, pos := range l.continues {
+		c.changeOperand(pos, next)
+	}
+	for _, pos := range l.breaks {
+		c.changeOperand(pos, end)
+	}
+}
+
+// compileTryStatement compiles a try statement. The finally block is compiled
+// for every way of leaving the statement, here and by leaveTryBlocks:
+//
+//	OpTry handler
+//	<body>
+//	OpEndTry
+//	<finally>
+//	OpJump end
+//	handler:
+//	OpTry finallyHandler     (only with a finally block)
+//	OpCatch
+//	<set catch parameter>
+//	<catch>
+//	OpEndTry                 (only with a finally block)
+//	<finally>
+//	OpJump end
+//	finallyHandler:
+//	<finally>
+//	OpThrow
+//	end:
+//
+// Without a catch block, errors are handled by finallyHandler directly.
+func (c *Compiler) compileTryStatement(node *ast.TryStatement) error {
+	depth := len(c.currentScope().tries)
+	t := &tryBlock{finally: node.Finally, protected: true, loops: len(c.currentScope().loops)}
+	c.scopes[c.scopeIndex].tries = append(c.currentScope().tries, t)
+	defer func() { c.scopes[c.scopeIndex].tries = c.currentScope().tries[:depth] }()
+
+	var jumps []int
+
+	handlerPos := c.emit(code.OpTry, 9999)
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	if err := c.leaveTryBlocks(depth, false); err != nil {
+		return err
+	}
+	jumps = append(jumps, c.emit(code.OpJump, 9999))
+	c.changeOperand(handlerPos, len(c.currentInstructions()))
+
+	if node.Catch != nil {
+		t.protected = node.Finally != nil
+		if t.protected {
+			handlerPos = c.emit(code.OpTry, 9999)
+		}
+		c.emit(code.OpCatch)
+
+		// The caught error is only visible inside the catch block.
+		c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+		c.setSymbol(c.symbolTable.Define(node.CatchParam.Value))
+		err := c.Compile(node.Catch)
+		c.symbolTable = c.symbolTable.Outer
+		if err != nil {
+			return err
+		}
+
+		if err := c.leaveTryBlocks(depth, false); err != nil {
+			return err
+		}
+		if t.protected {
+			jumps = append(jumps, c.emit(code.OpJump, 9999))
+			c.changeOperand(handlerPos, len(c.currentInstructions()))
+		}
+	}
+
+	if node.Finally != nil {
+		t.protected = false
+		t.pendingError = true
+		t.finally = nil
+		if err := c.Compile(node.Finally); err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+	}
+
+	end := len(c.currentInstructions())
+	for _, pos := range jumps {
+		c.changeOperand(pos, end)
+	}
+
+	return nil
+}
+
+// leaveTryBlocks emits the code for jumping out of the try statements being
+// compiled, innermost first, down to the one at index depth: their handlers
+// are removed and their finally blocks run. A value being returned stays on
+// top of the stack.
+func (c *Compiler) leaveTryBlocks(depth int, returning bool) error {
+	tries, loops := c.currentScope().tries, c.currentScope().loops
+	defer func() {
+		c.scopes[c.scopeIndex].tries = tries
+		c.scopes[c.scopeIndex].loops = loops
+	}()
+
+	for i := len(tries) - 1; i >= depth; i-- {
+		t := tries[i]
+		if t.protected {
+			c.emit(code.OpEndTry)
+		}
+		if t.pendingError && !returning {
+			c.emit(code.OpPop)
+		}
+		if t.finally != nil {
+			// The finally block is compiled as if it was outside the
+			// statement, so that it can only jump to enclosing loops. The
+			// capacities are limited so that loops and try statements inside
+			// it don't overwrite the ones being left.
+			c.scopes[c.scopeIndex].tries = tries[:i:i]
+			c.scopes[c.scopeIndex].loops = loops[:t.loops:t.loops]
+			if err := c.Compile(t.finally); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+// loadCell pushes what a closure captures for s: the cell holding the
+// variable, so that assignments are shared between the closure and its
+// enclosing function.
+func (c *Compiler) loadCell(s Symbol) {
+	switch s.Scope {
+	case LocalScope:
+		c.emit(code.OpGetLocalCell, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFreeCell, s.Index)
+	default:
+		c.loadSymbol(s)
+	}
+}
+
+func (c *Compiler) assignSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpAssignGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpAssignLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpAssignFree, s.Index)
+	}
+}
+
+// bind binds name to the value on top of the stack, as let statements do.
+func (c *Compiler) bind(name string) {
+	redefinition := c.symbolTable.defines(name)
+	symbol := c.symbolTable.Define(name)
+	if redefinition && symbol.Scope == LocalScope {
+		// Closures may have captured the existing binding, so update it in
+		// place rather than replacing it.
+		c.emit(code.OpAssignLocal, symbol.Index)
+		c.emit(code.OpPop)
+	} else {
+		c.setSymbol(symbol)
+	}
+}
+
+func (c *Compiler) setSymbol(s Symbol) {
+	if s.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, s.Index)
+	} else {
+		c.emit(code.OpSetLocal, s.Index)
+	}
+}
+
+func (c *Compiler) errorf(format string, args ...interface{}) error {
+	return &Error{Pos: c.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	c.checkOperands(op, operands)
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	if c.pos.IsValid() {
+		c.scopes[c.scopeIndex].positions[pos] = c.pos
+	}
+
+	c.setLastInstruction(op, pos)
+
+	return pos
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+	return posNewInstruction
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	c.scopes[c.scopeIndex].instructions = c.currentInstructions()[:last.Position]
+	delete(c.scopes[c.scopeIndex].positions, last.Position)
+	c.scopes[c.scopeIndex].lastInstruction = previous
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	c.checkOperands(op, []int{operand})
+	newInstruction := code.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+// checkOperands records an error if the operands of an instruction don't fit
+// in it, rather than letting them wrap around, which would make the program
+// run differently than it reads.
+func (c *Compiler) checkOperands(op code.Opcode, operands []int) {
+	def, err := code.Lookup(byte(op))
+	if err != nil || c.err != nil {
+		return
+	}
+
+	for i, operand := range operands {
+		max := 1<<(8*def.OperandWidths[i]) - 1
+		if operand >= 0 && operand <= max {
+			continue
+		}
+		format, ok := operandErrors[op]
+		if op == code.OpClosure && i == 1 {
+			format = operandErrors[code.OpGetFree]
+		} else if !ok {
+			format = "operand of " + def.Name + " out of range: the limit is %d"
+		}
+		c.err = c.errorf(format, max)
+		return
+	}
+}
+
+// operandErrors are the errors raised when the operand of an instruction
+// doesn't fit, formatted with the largest operand that does.
+var operandErrors = map[code.Opcode]string{
+	code.OpConstant:      "too many constants: the limit is %d",
+	code.OpClosure:       "too many constants: the limit is %d",
+	code.OpImport:        "too many constants: the limit is %d",
+	code.OpJump:          "jump too far: functions are limited to %d bytes of instructions",
+	code.OpJumpNotTruthy: "jump too far: functions are limited to %d bytes of instructions",
+	code.OpIterNext:      "jump too far: functions are limited to %d bytes of instructions",
+	code.OpTry:           "jump too far: functions are limited to %d bytes of instructions",
+	code.OpGetGlobal:     "too many global variables: the limit is %d",
+	code.OpSetGlobal:     "too many global variables: the limit is %d",
+	code.OpAssignGlobal:  "too many global variables: the limit is %d",
+	code.OpGetLocal:      "too many local variables: the limit is %d",
+	code.OpSetLocal:      "too many local variables: the limit is %d",
+	code.OpAssignLocal:   "too many local variables: the limit is %d",
+	code.OpGetLocalCell:  "too many local variables: the limit is %d",
+	code.OpGetFree:       "too many free variables: the limit is %d",
+	code.OpAssignFree:    "too many free variables: the limit is %d",
+	code.OpGetFreeCell:   "too many free variables: the limit is %d",
+	code.OpArray:         "too many elements: the limit is %d",
+	code.OpHash:          "too many elements: the limit is %d",
+	code.OpCall:          "too many arguments: the limit is %d",
+	code.OpTailCall:      "too many arguments: the limit is %d",
+}
+
+func (c *Compiler) currentScope() *CompilationScope {
+	return &c.scopes[c.scopeIndex]
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{
+		instructions: code.Instructions{},
+		positions:    map[int]token.Position{},
+	}
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
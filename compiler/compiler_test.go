@@ -0,0 +1,710 @@
+package compiler_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/makramkd/go-monkey/code"
+	"github.com/makramkd/go-monkey/compiler"
+	"github.com/makramkd/go-monkey/lexer"
+	"github.com/makramkd/go-monkey/object"
+	"github.com/makramkd/go-monkey/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+type compilerTestCase struct {
+	input                string
+	expectedConstants    []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func runCompilerTests(t *testing.T, testCases []compilerTestCase) {
+	t.Helper()
+
+	for _, testCase := range testCases {
+		l := lexer.New(testCase.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		if !assert.Empty(t, p.Errors(), testCase.input) {
+			continue
+		}
+
+		c := compiler.New()
+		err := c.Compile(program)
+		if !assert.NoError(t, err, testCase.input) {
+			continue
+		}
+
+		bytecode := c.Bytecode()
+		assert.Equal(t, concatInstructions(testCase.expectedInstructions).String(), bytecode.Instructions.String(), testCase.input)
+		testConstants(t, testCase.expectedConstants, bytecode.Constants)
+	}
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+	out := code.Instructions{}
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+func testConstants(t *testing.T, expected []interface{}, actual []object.Object) {
+	t.Helper()
+
+	if !assert.Len(t, actual, len(expected)) {
+		return
+	}
+
+	for i, constant := range expected {
+		switch constant := constant.(type) {
+		case int:
+			assert.Equal(t, &object.Integer{Value: int64(constant)}, actual[i])
+		case string:
+			assert.Equal(t, &object.String{Value: constant}, actual[i])
+		case []code.Instructions:
+			if assert.IsType(t, &object.CompiledFunction{}, actual[i]) {
+				fn := actual[i].(*object.CompiledFunction)
+				assert.Equal(t, concatInstructions(constant).String(), fn.Instructions.String())
+			}
+		}
+	}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	runCompilerTests(t, []compilerTestCase{
+		{
+			input:             "1 + 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 < 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpLessThan),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "-1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMinus),
+				code.Make(code.OpPop),
+			},
+		},
+	})
+}
+
+func TestConditionals(t *testing.T) {
+	runCompilerTests(t, []compilerTestCase{
+		{
+			input:             "if (true) { 10 }; 3333;",
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 11),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpPop),
+				// 0012
+				code.Make(code.OpConstant, 1),
+				// 0015
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "if (true) { let a = 1; }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 14),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpNull),
+				code.Make(code.OpJump, 15),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			},
+		},
+	})
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	runCompilerTests(t, []compilerTestCase{
+		{
+			input:             "let one = 1; let two = 2;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let one = 1; let one = one + 1; one;",
+			expectedConstants: []interface{}{1, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// Globals can be referenced before they are defined.
+			input:             "let f = fn() { g }; let g = 1;",
+			expectedConstants: []interface{}{[]code.Instructions{code.Make(code.OpGetGlobal, 0), code.Make(code.OpReturnValue)}, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			},
+		},
+	})
+}
+
+func TestFunctions(t *testing.T) {
+	runCompilerTests(t, []compilerTestCase{
+		{
+			input: "fn() { return 5 + 10; }",
+			expectedConstants: []interface{}{
+				5,
+				10,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn(a) { fn(b) { a + b } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocalCell, 0),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { let countDown = fn(x) { countDown(x - 1); }; countDown(1); }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+				[]code.Instructions{
+					code.Make(code.OpClosure, 1, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	})
+}
+
+func TestTailCalls(t *testing.T) {
+	runCompilerTests(t, []compilerTestCase{
+		{
+			input: "fn(f) { return f(); }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpTailCall, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// The call isn't the last thing the function does.
+			input: "fn(f) { 1 + f() }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCall, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// Calls outside of functions return to the main program.
+			input: "let f = fn() { 1 }; f();",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	})
+}
+
+func TestBuiltins(t *testing.T) {
+	runCompilerTests(t, []compilerTestCase{
+		{
+			input:             "len([]);",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	})
+}
+
+func TestForEachStatements(t *testing.T) {
+	runCompilerTests(t, []compilerTestCase{
+		{
+			input:             "for x in [1] { x; break; }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpArray, 1),
+				// 0006
+				code.Make(code.OpIterInit, 1),
+				// 0008
+				code.Make(code.OpSetLocal, 0),
+				// 0011
+				code.Make(code.OpGetLocal, 0),
+				// 0014
+				code.Make(code.OpIterNext, 30),
+				// 0017
+				code.Make(code.OpSetLocal, 1),
+				// 0020
+				code.Make(code.OpGetLocal, 1),
+				// 0023
+				code.Make(code.OpPop),
+				// 0024
+				code.Make(code.OpJump, 30),
+				// 0027
+				code.Make(code.OpJump, 11),
+				// 0030
+				code.Make(code.OpNull),
+				// 0031
+				code.Make(code.OpPop),
+			},
+		},
+	})
+}
+
+func TestWhileStatements(t *testing.T) {
+	runCompilerTests(t, []compilerTestCase{
+		{
+			input:             "while (true) { continue; break; }",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 13),
+				// 0004
+				code.Make(code.OpJump, 0),
+				// 0007
+				code.Make(code.OpJump, 13),
+				// 0010
+				code.Make(code.OpJump, 0),
+				// 0013
+				code.Make(code.OpNull),
+				// 0014
+				code.Make(code.OpPop),
+			},
+		},
+	})
+}
+
+func TestTryStatements(t *testing.T) {
+	runCompilerTests(t, []compilerTestCase{
+		{
+			input:             "try { 1; } catch (e) { 2; } finally { 3; }",
+			expectedConstants: []interface{}{1, 3, 2, 3, 3},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTry, 15),
+				// 0003
+				code.Make(code.OpConstant, 0),
+				// 0006
+				code.Make(code.OpPop),
+				// 0007
+				code.Make(code.OpEndTry),
+				// 0008
+				code.Make(code.OpConstant, 1),
+				// 0011
+				code.Make(code.OpPop),
+				// 0012
+				code.Make(code.OpJump, 39),
+				// 0015
+				code.Make(code.OpTry, 34),
+				// 0018
+				code.Make(code.OpCatch),
+				// 0019
+				code.Make(code.OpSetLocal, 0),
+				// 0022
+				code.Make(code.OpConstant, 2),
+				// 0025
+				code.Make(code.OpPop),
+				// 0026
+				code.Make(code.OpEndTry),
+				// 0027
+				code.Make(code.OpConstant, 3),
+				// 0030
+				code.Make(code.OpPop),
+				// 0031
+				code.Make(code.OpJump, 39),
+				// 0034
+				code.Make(code.OpConstant, 4),
+				// 0037
+				code.Make(code.OpPop),
+				// 0038
+				code.Make(code.OpThrow),
+				// 0039
+				code.Make(code.OpNull),
+				// 0040
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { try { return 1; } catch (e) { throw e; } }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpTry, 12),
+					// 0003
+					code.Make(code.OpConstant, 0),
+					// 0006
+					code.Make(code.OpEndTry),
+					// 0007
+					code.Make(code.OpReturnValue),
+					// 0008
+					code.Make(code.OpEndTry),
+					// 0009
+					code.Make(code.OpJump, 20),
+					// 0012
+					code.Make(code.OpCatch),
+					// 0013
+					code.Make(code.OpSetLocal, 0),
+					// 0016
+					code.Make(code.OpGetLocal, 0),
+					// 0019
+					code.Make(code.OpThrow),
+					// 0020
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	})
+}
+
+func TestForStatements(t *testing.T) {
+	runCompilerTests(t, []compilerTestCase{
+		{
+			input:             "for (let i = 0; i < 1; i++) { continue; }",
+			expectedConstants: []interface{}{0, 1, 1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpSetLocal, 0),
+				// 0006
+				code.Make(code.OpGetLocal, 0),
+				// 0009
+				code.Make(code.OpConstant, 1),
+				// 0012
+				code.Make(code.OpLessThan),
+				// 0013
+				code.Make(code.OpJumpNotTruthy, 37),
+				// 0016
+				code.Make(code.OpJump, 19),
+				// 0019
+				code.Make(code.OpGetLocal, 0),
+				// 0022
+				code.Make(code.OpGetLocal, 0),
+				// 0025
+				code.Make(code.OpConstant, 2),
+				// 0028
+				code.Make(code.OpAdd),
+				// 0029
+				code.Make(code.OpAssignLocal, 0),
+				// 0032
+				code.Make(code.OpPop),
+				// 0033
+				code.Make(code.OpPop),
+				// 0034
+				code.Make(code.OpJump, 6),
+				// 0037
+				code.Make(code.OpNull),
+				// 0038
+				code.Make(code.OpPop),
+			},
+		},
+	})
+}
+
+func TestAssignExpressions(t *testing.T) {
+	testCases := []compilerTestCase{
+		{
+			input:             "let a = 1; a += 2;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpAssignGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn(a) { a++ }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpAssignLocal, 0),
+					code.Make(code.OpPop),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn(a) { fn() { a = 1 } }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpAssignFree, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocalCell, 0),
+					code.Make(code.OpClosure, 1, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, testCases)
+}
+
+func TestIndexAssignment(t *testing.T) {
+	testCases := []compilerTestCase{
+		{
+			input:             "let a = [1]; a[0] = 2;",
+			expectedConstants: []interface{}{1, 0, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSetIndex, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let a = [1]; a[0] += 2;",
+			expectedConstants: []interface{}{1, 0, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpDup2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetIndex, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let a = [1]; a[0]--;",
+			expectedConstants: []interface{}{1, 0, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpDup2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSub),
+				code.Make(code.OpSetIndex, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, testCases)
+}
+
+func TestCompilerErrors(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"break;", "1:1: break cannot be used outside a loop context"},
+		{"for x in [1] { fn() { break; } }", "1:23: break cannot be used outside a loop context"},
+		{"len = 1;", "1:1: identifier not found: len"},
+		{"++5;", "1:1: cannot assign to 5"},
+		{"fn() { let f = fn() { fn() { f = 1; } }; }", "1:30: cannot assign to f inside its own definition"},
+		{"continue;", "1:1: continue cannot be used outside a loop context"},
+		{"while (true) { fn() { continue; } }", "1:23: continue cannot be used outside a loop context"},
+		{"import doesnotexist;", "1:1: standard module does not exist: doesnotexist. Was the Monkey stdlib path specified correctly?"},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.New(testCase.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		assert.Empty(t, p.Errors())
+
+		c := compiler.New()
+		assert.EqualError(t, c.Compile(program), testCase.expected)
+	}
+}
+
+func TestOperandLimits(t *testing.T) {
+	var globals strings.Builder
+	for i := 0; i < 70000; i++ {
+		fmt.Fprintf(&globals, "let v%d = true;\n", i)
+	}
+
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 0; if (true) { " + strings.Repeat("x = x + 1; ", 12000) + "} x;", "1:12: jump too far: functions are limited to 65535 bytes of instructions"},
+		{"let x = 0; while (x < 1) { " + strings.Repeat("x = x + 1; ", 12000) + "}", "1:12: jump too far: functions are limited to 65535 bytes of instructions"},
+		{globals.String() + "puts(v69999);", "65537:1: too many global variables: the limit is 65535"},
+		{"len(" + strings.Repeat("1, ", 256) + "1);", "1:1: too many arguments: the limit is 255"},
+		{"fn() { len(" + strings.Repeat("1, ", 256) + "1) };", "1:8: too many arguments: the limit is 255"},
+		{strings.Repeat("1.5; ", 65537), "1:327681: too many constants: the limit is 65535"},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.New(testCase.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		assert.Empty(t, p.Errors())
+
+		c := compiler.New()
+		assert.EqualError(t, c.Compile(program), testCase.expected)
+	}
+
+	// The limits themselves are fine.
+	input := "len(" + strings.Repeat("[], ", 254) + "[]);"
+	assert.NoError(t, compiler.New().Compile(parser.New(lexer.New(input)).ParseProgram()))
+}
@@ -0,0 +1,167 @@
+package compiler
+
+import (
+	"strings"
+
+	"github.com/makramkd/go-monkey/ast"
+	"github.com/makramkd/go-monkey/code"
+	"github.com/makramkd/go-monkey/evaluator/stdlib"
+	"github.com/makramkd/go-monkey/object"
+)
+
+// compileImportStatement compiles an import statement, which runs the
+// module and binds it: the listed definitions if there are any, else the
+// module to its alias if it has one, else files to their name and standard
+// modules by copying their exported definitions into the current scope.
+func (c *Compiler) compileImportStatement(node *ast.ImportStatement) error {
+	index, err := c.importModule(node)
+	if err != nil {
+		return err
+	}
+	m := c.modules[index]
+
+	pos := c.emit(code.OpImport, m.fnIndex)
+	if c.pos.IsValid() {
+		// Tracebacks take the position of a call from the byte before the
+		// one its caller is suspended on: the opcode of OpCall, but the
+		// first operand byte of OpImport.
+		c.currentScope().positions[pos+1] = c.pos
+	}
+	c.emit(code.OpPop)
+
+	switch {
+	case node.Names != nil:
+		for _, name := range node.Names {
+			member, ok := m.symbolTable.member(name.Value)
+			if !ok || !object.Exported(name.Value) {
+				return c.errorf("cannot import %s from module %s", name.Value, m.name)
+			}
+			c.bindMember(member)
+		}
+	case node.Alias != nil:
+		c.symbolTable.DefineModule(node.Alias.Value, index)
+	case node.Path != nil:
+		c.symbolTable.DefineModule(m.name, index)
+	default:
+		for _, member := range m.symbolTable.members() {
+			if object.Exported(member.Name) {
+				c.bindMember(member)
+			}
+		}
+	}
+
+	return nil
+}
+
+// bindMember binds the name of a member of a module to its value in the
+// current scope.
+func (c *Compiler) bindMember(member Symbol) {
+	if member.Scope == ModuleScope {
+		c.symbolTable.DefineModule(member.Name, member.Index)
+		return
+	}
+	c.emit(code.OpGetGlobal, member.Index)
+	c.bind(member.Name)
+}
+
+// importModule returns the index of the module imported by node, compiling
+// it the first time it is imported.
+func (c *Compiler) importModule(node *ast.ImportStatement) (int, error) {
+	imported, err := stdlib.ResolveImport(node)
+	if err != nil {
+		return 0, c.errorf("%s", err)
+	}
+
+	if index, ok := c.moduleIndex[imported.Key]; ok {
+		return index, nil
+	}
+
+	for i, key := range c.importing {
+		if key == imported.Key {
+			cycle := append(append([]string{}, c.importing[i:]...), key)
+			return 0, c.errorf("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	program, err := imported.Load(stdlib.Load)
+	if err != nil {
+		return 0, c.errorf("%s", err)
+	}
+
+	c.importing = append(c.importing, imported.Key)
+	m, err := c.compileModule(imported.Name, program)
+	c.importing = c.importing[:len(c.importing)-1]
+	if err != nil {
+		return 0, err
+	}
+
+	c.modules = append(c.modules, m)
+	c.moduleIndex[imported.Key] = len(c.modules) - 1
+	return len(c.modules) - 1, nil
+}
+
+// compileModule compiles the program of a module to a function, whose top
+// level definitions are globals in a symbol table of their own.
+func (c *Compiler) compileModule(name string, program *ast.Program) (*module, error) {
+	table := NewModuleSymbolTable(c.symbolTable)
+	for i, v := range object.Builtins {
+		table.DefineBuiltin(i, v.Name)
+	}
+
+	c.enterScope()
+	enclosed := c.symbolTable
+	c.symbolTable = table
+
+	for _, s := range program.Statements {
+		if err := c.Compile(s); err != nil {
+			return nil, err
+		}
+	}
+	c.emit(code.OpReturn)
+
+	numLocals := table.NumLocals()
+	positions := c.currentScope().positions
+	c.symbolTable = enclosed
+	instructions := c.leaveScope()
+
+	fn := &object.CompiledFunction{
+		Instructions: instructions,
+		NumLocals:    numLocals,
+		Name:         "<module " + name + ">",
+		Positions:    positions,
+	}
+
+	return &module{name: name, fnIndex: c.addConstant(fn), symbolTable: table}, nil
+}
+
+// compileMemberExpression compiles an access to a member of a module, which
+// is resolved to the global it's stored in.
+func (c *Compiler) compileMemberExpression(node *ast.MemberExpression) error {
+	ident, ok := node.Left.(*ast.Identifier)
+	if !ok {
+		return c.errorf("%s is not a module", node.Left.String())
+	}
+
+	symbol, ok := c.symbolTable.Resolve(ident.Value)
+	if !ok {
+		return c.errorf("identifier not found: %s", ident.Value)
+	}
+	if symbol.Scope != ModuleScope {
+		return c.errorf("%s is not a module", ident.Value)
+	}
+
+	m := c.modules[symbol.Index]
+	if !object.Exported(node.Member.Value) {
+		return c.errorf("cannot access private member %s of module %s", node.Member.Value, m.name)
+	}
+	member, ok := m.symbolTable.member(node.Member.Value)
+	if !ok {
+		return c.errorf("module %s has no member %s", m.name, node.Member.Value)
+	}
+	if member.Scope == ModuleScope {
+		return c.errorf("cannot use module %s.%s as a value", ident.Value, node.Member.Value)
+	}
+
+	c.loadSymbol(member)
+	return nil
+}
@@ -0,0 +1,258 @@
+package compiler
+
+import "sort"
+
+type SymbolScope string
+
+const (
+	GlobalScope   SymbolScope = "GLOBAL"
+	LocalScope    SymbolScope = "LOCAL"
+	BuiltinScope  SymbolScope = "BUILTIN"
+	FreeScope     SymbolScope = "FREE"
+	FunctionScope SymbolScope = "FUNCTION"
+	// ModuleScope symbols are bound to imported modules, which only exist at
+	// compile time. The index is that of the module in the compiler.
+	ModuleScope SymbolScope = "MODULE"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+// SymbolTable associates identifiers with the storage they are bound to.
+// There is one table for the global scope, one per imported module and one
+// per function literal. Modules have global tables of their own, whose
+// globals are stored alongside those of the main program.
+// Loop bodies get a block table of their own: its definitions are not visible
+// outside the loop, but they are stored in the slots of the enclosing function
+// (or, at the top level, in local slots of the main program).
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+
+	// FreeSymbols are the symbols of enclosing functions referenced by the
+	// function this table belongs to.
+	FreeSymbols []Symbol
+
+	// block is set for loop body tables, owner is the global or function
+	// table whose slots a table's definitions are stored in.
+	block bool
+	owner *SymbolTable
+	// numBlockLocals counts the local slots used by block tables of the
+	// global table.
+	numBlockLocals int
+
+	// main is the global table of the main program, which numbers the
+	// globals of all modules, and modules are the tables of the modules
+	// imported by it.
+	main    *SymbolTable
+	modules []*SymbolTable
+	// hostGlobals are the globals of the main table set by the host of the
+	// program, which are visible to every module, like builtins.
+	hostGlobals map[string]Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	s := &SymbolTable{store: map[string]Symbol{}}
+	s.owner = s
+	s.main = s
+	return s
+}
+
+// NewModuleSymbolTable returns the global table of a module imported by the
+// program that s belongs to.
+func NewModuleSymbolTable(s *SymbolTable) *SymbolTable {
+	main := s.Global().main
+
+	module := NewSymbolTable()
+	module.main = main
+	main.modules = append(main.modules, module)
+	return module
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewEnclosedSymbolTable(outer)
+	s.block = true
+	s.owner = outer.owner
+	return s
+}
+
+// Define binds name in the table. Redefining a name in the same table reuses
+// its slot, so that e.g globals referenced before their definition end up
+// pointing at the right value.
+func (s *SymbolTable) Define(name string) Symbol {
+	if symbol, ok := s.store[name]; ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+		return symbol
+	}
+
+	symbol := Symbol{Name: name}
+	switch {
+	case s.Outer == nil:
+		symbol.Scope = GlobalScope
+		symbol.Index = s.main.numDefinitions
+		s.main.numDefinitions++
+	case s.owner.Outer == nil:
+		symbol.Scope = LocalScope
+		symbol.Index = s.owner.numBlockLocals
+		s.owner.numBlockLocals++
+	default:
+		symbol.Scope = LocalScope
+		symbol.Index = s.owner.numDefinitions
+		s.owner.numDefinitions++
+	}
+
+	s.store[name] = symbol
+	return symbol
+}
+
+// defines reports whether name is bound to a slot owned by s itself, as
+// opposed to an enclosing table.
+func (s *SymbolTable) defines(name string) bool {
+	symbol, ok := s.store[name]
+	return ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope)
+}
+
+// DefineHostGlobal defines a global that the host of the program sets before
+// running it. It is visible to the main program and every module, unless they
+// define the name themselves, and takes precedence over a builtin of the same
+// name.
+func (s *SymbolTable) DefineHostGlobal(name string) Symbol {
+	main := s.Global().main
+	symbol := Symbol{Name: name, Scope: GlobalScope, Index: main.numDefinitions}
+	main.numDefinitions++
+
+	if main.hostGlobals == nil {
+		main.hostGlobals = map[string]Symbol{}
+	}
+	main.hostGlobals[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) DefineModule(name string, index int) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: ModuleScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Scope: FreeScope}
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if s.Outer == nil && (!ok || symbol.Scope == BuiltinScope) {
+		if global, found := s.main.hostGlobals[name]; found {
+			return global, true
+		}
+	}
+	if ok || s.Outer == nil {
+		return symbol, ok
+	}
+
+	if s.block {
+		// Blocks share the slots of their owner, so there's nothing to capture.
+		return s.Outer.Resolve(name)
+	}
+
+	symbol, ok = s.Outer.Resolve(name)
+	if !ok {
+		return symbol, ok
+	}
+
+	if symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope || symbol.Scope == ModuleScope {
+		return symbol, ok
+	}
+
+	return s.defineFree(symbol), true
+}
+
+// origin follows a free symbol resolved in s back to the symbol it was
+// captured from.
+func (s *SymbolTable) origin(symbol Symbol) Symbol {
+	table := s.owner
+	for symbol.Scope == FreeScope {
+		symbol = table.FreeSymbols[symbol.Index]
+		table = table.Outer.owner
+	}
+	return symbol
+}
+
+// Global returns the global symbol table that s is nested in.
+func (s *SymbolTable) Global() *SymbolTable {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	return s
+}
+
+// NumLocals returns the number of local slots needed by the function this
+// table belongs to.
+func (s *SymbolTable) NumLocals() int {
+	if s.owner.Outer == nil {
+		return s.owner.numBlockLocals
+	}
+	return s.owner.numDefinitions
+}
+
+// GlobalNames returns the names of the globals defined in s and the modules
+// it imports, by index.
+func (s *SymbolTable) GlobalNames() []string {
+	names := make([]string, s.numDefinitions)
+	for name, symbol := range s.hostGlobals {
+		names[symbol.Index] = name
+	}
+	for _, table := range append([]*SymbolTable{s}, s.modules...) {
+		for name, symbol := range table.store {
+			if symbol.Scope == GlobalScope {
+				names[symbol.Index] = name
+			}
+		}
+	}
+	return names
+}
+
+// member returns the symbol of the definition name made at the top level of
+// the module whose global table is s.
+func (s *SymbolTable) member(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	return symbol, ok && (symbol.Scope == GlobalScope || symbol.Scope == ModuleScope)
+}
+
+// members returns the symbols of the definitions made at the top level of
+// the module whose global table is s, sorted by name.
+func (s *SymbolTable) members() []Symbol {
+	var symbols []Symbol
+	for _, symbol := range s.store {
+		if symbol.Scope == GlobalScope || symbol.Scope == ModuleScope {
+			symbols = append(symbols, symbol)
+		}
+	}
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i].Name < symbols[j].Name })
+	return symbols
+}
@@ -0,0 +1,95 @@
+package compiler_test
+
+import (
+	"testing"
+
+	"github.com/makramkd/go-monkey/compiler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefineAndResolve(t *testing.T) {
+	global := compiler.NewSymbolTable()
+	a := global.Define("a")
+	assert.Equal(t, compiler.Symbol{Name: "a", Scope: compiler.GlobalScope, Index: 0}, a)
+	assert.Equal(t, a, global.Define("a"), "redefining a global reuses its slot")
+
+	local := compiler.NewEnclosedSymbolTable(global)
+	b := local.Define("b")
+	assert.Equal(t, compiler.Symbol{Name: "b", Scope: compiler.LocalScope, Index: 0}, b)
+
+	nested := compiler.NewEnclosedSymbolTable(local)
+	c := nested.Define("c")
+	assert.Equal(t, compiler.Symbol{Name: "c", Scope: compiler.LocalScope, Index: 0}, c)
+
+	resolved, ok := nested.Resolve("a")
+	assert.True(t, ok)
+	assert.Equal(t, a, resolved)
+
+	resolved, ok = nested.Resolve("b")
+	assert.True(t, ok)
+	assert.Equal(t, compiler.Symbol{Name: "b", Scope: compiler.FreeScope, Index: 0}, resolved)
+	assert.Equal(t, []compiler.Symbol{b}, nested.FreeSymbols)
+
+	_, ok = nested.Resolve("d")
+	assert.False(t, ok)
+}
+
+func TestBlockSymbolTables(t *testing.T) {
+	global := compiler.NewSymbolTable()
+	global.Define("a")
+
+	// Blocks of the main program are stored in its local slots.
+	topLevelBlock := compiler.NewBlockSymbolTable(global)
+	assert.Equal(t, compiler.Symbol{Name: "x", Scope: compiler.LocalScope, Index: 0}, topLevelBlock.Define("x"))
+	assert.Equal(t, 1, global.NumLocals())
+
+	_, ok := global.Resolve("x")
+	assert.False(t, ok, "block definitions are not visible outside the block")
+
+	fn := compiler.NewEnclosedSymbolTable(global)
+	fn.Define("param")
+	block := compiler.NewBlockSymbolTable(fn)
+	nestedBlock := compiler.NewBlockSymbolTable(block)
+	assert.Equal(t, compiler.Symbol{Name: "y", Scope: compiler.LocalScope, Index: 1}, block.Define("y"))
+	assert.Equal(t, compiler.Symbol{Name: "z", Scope: compiler.LocalScope, Index: 2}, nestedBlock.Define("z"))
+	assert.Equal(t, 3, fn.NumLocals())
+
+	resolved, ok := nestedBlock.Resolve("param")
+	assert.True(t, ok)
+	assert.Equal(t, compiler.Symbol{Name: "param", Scope: compiler.LocalScope, Index: 0}, resolved)
+	assert.Empty(t, fn.FreeSymbols)
+}
+
+func TestResolveBuiltins(t *testing.T) {
+	global := compiler.NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+
+	nested := compiler.NewEnclosedSymbolTable(compiler.NewEnclosedSymbolTable(global))
+	resolved, ok := nested.Resolve("len")
+	assert.True(t, ok)
+	assert.Equal(t, compiler.Symbol{Name: "len", Scope: compiler.BuiltinScope, Index: 0}, resolved)
+}
+
+func TestResolveHostGlobals(t *testing.T) {
+	global := compiler.NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+	global.Define("a")
+	args := global.DefineHostGlobal("args")
+	assert.Equal(t, compiler.Symbol{Name: "args", Scope: compiler.GlobalScope, Index: 1}, args)
+	length := global.DefineHostGlobal("len")
+
+	resolved, ok := compiler.NewEnclosedSymbolTable(global).Resolve("args")
+	assert.True(t, ok)
+	assert.Equal(t, args, resolved)
+	resolved, _ = global.Resolve("len")
+	assert.Equal(t, length, resolved, "host globals take precedence over builtins")
+
+	module := compiler.NewModuleSymbolTable(global)
+	resolved, ok = module.Resolve("args")
+	assert.True(t, ok)
+	assert.Equal(t, args, resolved)
+
+	assert.Equal(t, compiler.Symbol{Name: "args", Scope: compiler.GlobalScope, Index: 3}, module.Define("args"),
+		"modules defining the name get a global of their own")
+	assert.Equal(t, []string{"a", "args", "len", "args"}, global.GlobalNames())
+}
@@ -0,0 +1,33 @@
+package compiler
+
+import "github.com/makramkd/go-monkey/ast"
+
+// markTailCalls records the calls of node in tail position, i.e whose value
+// is the result of the function node belongs to, so that they're compiled to
+// OpTailCall. If tail is set, the value of node is the result of the
+// function. Either way, return statements are in tail position.
+//
+// As in the evaluator, only blocks, return statements and if expressions
+// pass on tail position to their children, e.g a return inside a loop or try
+// statement makes a call as usual.
+func (c *Compiler) markTailCalls(root ast.Node, tail bool) {
+	switch node := root.(type) {
+	case *ast.BlockStatement:
+		for i, stmt := range node.Statements {
+			c.markTailCalls(stmt, tail && i == len(node.Statements)-1)
+		}
+	case *ast.ExpressionStatement:
+		c.markTailCalls(node.Expression, tail)
+	case *ast.ReturnStatement:
+		c.markTailCalls(node.ReturnValue, true)
+	case *ast.IfExpression:
+		c.markTailCalls(node.Consequence, tail)
+		if node.Alternative != nil {
+			c.markTailCalls(node.Alternative, tail)
+		}
+	case *ast.CallExpression:
+		if tail {
+			c.tailCalls[node] = true
+		}
+	}
+}
@@ -0,0 +1,897 @@
+// Package conformance_test runs the same Monkey programs on every execution
+// engine and checks that they all agree on the result.
+package conformance_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/makramkd/go-monkey/ast"
+	"github.com/makramkd/go-monkey/compiler"
+	"github.com/makramkd/go-monkey/evaluator"
+	"github.com/makramkd/go-monkey/evaluator/stdlib"
+	"github.com/makramkd/go-monkey/lexer"
+	"github.com/makramkd/go-monkey/object"
+	"github.com/makramkd/go-monkey/parser"
+	"github.com/makramkd/go-monkey/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+type engine struct {
+	name string
+	run  func(program *ast.Program, opts options) object.Object
+}
+
+// options configure how engines run the programs of a conformance test.
+type options struct {
+	checkedArithmetic bool
+	// streams are where builtins print to, those of the process if unset.
+	streams object.Streams
+	// args are the arguments of the program, which has none if unset.
+	args []string
+	// limits bound the resources the program may use.
+	limits object.Limits
+	// ctx stops the program once it is done, if set.
+	ctx context.Context
+	// osAccess lets the program use the operating system.
+	osAccess bool
+}
+
+// argsArray returns the value of the args global of programs run with opts.
+func (opts options) argsArray() *object.Array {
+	values := make([]object.Object, len(opts.args))
+	for i, arg := range opts.args {
+		values[i] = &object.String{Value: arg}
+	}
+	return &object.Array{Values: values}
+}
+
+func init() {
+	// Standard modules that only the tests use.
+	stdlib.SetPath("testdata/stdlib")
+}
+
+var engines = []engine{
+	{"eval", runEvaluator},
+	{"vm", runVM},
+}
+
+func runEvaluator(program *ast.Program, opts options) object.Object {
+	env := object.NewEnv()
+	env.SetCheckedArithmetic(opts.checkedArithmetic)
+	if opts.streams.Stdout != nil {
+		env.SetStreams(opts.streams)
+	}
+	if opts.args != nil {
+		env.Prelude().Set("args", opts.argsArray())
+	}
+	env.SetLimits(opts.limits)
+	env.SetOSAccess(opts.osAccess)
+	return evaluator.EvalContext(opts.ctx, program, env)
+}
+
+func runVM(program *ast.Program, opts options) object.Object {
+	comp := compiler.New()
+	argsIndex := -1
+	if opts.args != nil {
+		argsIndex = comp.DefineGlobal("args")
+	}
+	if err := comp.Compile(program); err != nil {
+		return &object.Error{Message: err.(*compiler.Error).Msg}
+	}
+
+	machine := vm.New(comp.Bytecode())
+	machine.SetCheckedArithmetic(opts.checkedArithmetic)
+	if opts.streams.Stdout != nil {
+		machine.SetStreams(opts.streams)
+	}
+	if argsIndex >= 0 {
+		machine.SetGlobal(argsIndex, opts.argsArray())
+	}
+	machine.SetLimits(opts.limits)
+	machine.SetOSAccess(opts.osAccess)
+	if err := machine.RunContext(opts.ctx); err != nil {
+		return err.(*object.Error)
+	}
+
+	return machine.LastPoppedStackElem()
+}
+
+// expectation is what a conformance case should evaluate to: a Go int,
+// float64, bool, string, nil (for null), []interface{} for arrays or error
+// for runtime errors, compared by message.
+type expectation interface{}
+
+type conformanceCase struct {
+	input    string
+	expected expectation
+}
+
+func runConformanceTests(t *testing.T, testCases []conformanceCase) {
+	t.Helper()
+	runConformanceTestsWithOptions(t, options{}, testCases)
+}
+
+func runConformanceTestsWithOptions(t *testing.T, opts options, testCases []conformanceCase) {
+	t.Helper()
+
+	for _, testCase := range testCases {
+		l := lexer.New(testCase.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		if !assert.Empty(t, p.Errors(), testCase.input) {
+			continue
+		}
+
+		for _, e := range engines {
+			actual := e.run(program, opts)
+			assertObject(t, testCase.expected, actual, fmt.Sprintf("%s: %s", e.name, testCase.input))
+		}
+	}
+}
+
+func assertObject(t *testing.T, expected expectation, actual object.Object, msg string) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		if assert.IsType(t, &object.Integer{}, actual, msg) {
+			assert.Equal(t, int64(expected), actual.(*object.Integer).Value, msg)
+		}
+	case float64:
+		if assert.IsType(t, &object.Float{}, actual, msg) {
+			assert.Equal(t, expected, actual.(*object.Float).Value, msg)
+		}
+	case bool:
+		if assert.IsType(t, &object.Boolean{}, actual, msg) {
+			assert.Equal(t, expected, actual.(*object.Boolean).Value, msg)
+		}
+	case string:
+		if assert.IsType(t, &object.String{}, actual, msg) {
+			assert.Equal(t, expected, actual.(*object.String).Value, msg)
+		}
+	case nil:
+		// The evaluator produces no value at all for statements.
+		if actual != nil {
+			assert.IsType(t, &object.Null{}, actual, msg)
+		}
+	case []interface{}:
+		if assert.IsType(t, &object.Array{}, actual, msg) {
+			values := actual.(*object.Array).Values
+			if assert.Len(t, values, len(expected), msg) {
+				for i, e := range expected {
+					assertObject(t, e, values[i], msg)
+				}
+			}
+		}
+	case error:
+		if assert.IsType(t, &object.Error{}, actual, msg) {
+			assert.Equal(t, expected.Error(), actual.(*object.Error).Message, msg)
+		}
+	default:
+		t.Fatalf("unsupported expectation %T", expected)
+	}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	runConformanceTests(t, []conformanceCase{
+		{"5", 5},
+		{"-10", -10},
+		{"5 + 4 * 10", 45},
+		{"28 / 2 + 3 * 4 + 1", 27},
+		{"(4 + 10) * 2 + (3 + 10) * 2 + 1", 55},
+		{"2 ** 10", 1024},
+		{"7 % 3", 1},
+		{"-(5 + 5)", -10},
+	})
+}
+
+func TestTryCatch(t *testing.T) {
+	runConformanceTests(t, []conformanceCase{
+		{`let r = 0; try { r = 1; } catch (e) { r = 2; } r;`, 1},
+		{`let r = 0; try { 1 / 0; r = 1; } catch (e) { r = e["message"]; } r;`, "division by zero"},
+		{`let r = 0; try { 1 + true; } catch (e) { r = e["kind"]; } r;`, "TypeError"},
+		{`let r = 0; try { undefined; } catch (e) { r = [e["kind"], e["message"]]; } r;`, []interface{}{"NameError", "identifier not found: undefined"}},
+		{`let r = 0; try { [1][3]; } catch (e) { r = e["kind"]; } r;`, "IndexError"},
+		{`let r = 0; try { len(1, 2); } catch (e) { r = e["kind"]; } r;`, "ArgumentError"},
+		{`let r = 0; try { int("x"); } catch (e) { r = e["kind"]; } r;`, "ValueError"},
+		{`let r = 0; try { throw "bad record"; } catch (e) { r = [e["kind"], e["message"], e["value"]]; } r;`, []interface{}{"Error", "bad record", "bad record"}},
+		{`let r = 0; try { throw 42; } catch (e) { r = [e["message"], e["value"] + 1]; } r;`, []interface{}{"42", 43}},
+		{`let r = 0; try { throw {"message": "negative", "kind": "ValueError"}; } catch (e) { r = e["kind"] + ": " + e["message"]; } r;`, "ValueError: negative"},
+		{`let r = 0;
+try {
+  throw "x";
+} catch (e) { r = e["position"]; } r;`, "3:3"},
+		{`let r = 0; try { throw "x"; } catch (err) { r = 1; } err;`, fmt.Errorf("identifier not found: err")},
+		{`let e = 1; try { throw "x"; } catch (e) { e = 2; } e;`, 1},
+		{`throw "oops";`, fmt.Errorf("oops")},
+		{`throw {"message": "custom"};`, fmt.Errorf("custom")},
+		{`try { throw "inner"; } catch (e) { throw "from catch: " + e["message"]; }`, fmt.Errorf("from catch: inner")},
+		{`try { 1 / 0; } catch (e) { throw e; }`, fmt.Errorf("division by zero")},
+		{`let r = 0; try { try { 1 / 0; } catch (e) { throw e; } } catch (e) { r = e["kind"]; } r;`, "ArithmeticError"},
+		// Errors propagate out of function calls to the nearest try.
+		{`let f = fn(x) { if (x == 0) { throw "zero"; } x };
+		  let g = fn(x) { f(x) * 2 };
+		  let results = [];
+		  for x in [1, 0, 3] {
+			try { results = push(results, g(x)); } catch (e) { results = push(results, e["message"]); }
+		  }
+		  results;`, []interface{}{2, "zero", 6}},
+		{`let safe = fn(f) { try { return f(); } catch (e) { return "failed"; } };
+		  [safe(fn() { 1 }), safe(fn() { 1 / 0 }), safe(fn() { safe(fn() { throw 1; }); 2 })];`, []interface{}{1, "failed", 2}},
+		{`let f = fn() { try { throw "x"; } catch (e) { return "caught"; } "after" }; f();`, "caught"},
+		{`let f = fn() { try { 1 } catch (e) { return 2; } }; f();`, nil},
+		// Finally blocks run however the statement is left.
+		{`let log = []; try { log = push(log, "body"); } finally { log = push(log, "finally"); } log;`, []interface{}{"body", "finally"}},
+		{`let log = []; try { try { throw "x"; } finally { log = push(log, "finally"); } } catch (e) { log = push(log, e["message"]); } log;`, []interface{}{"finally", "x"}},
+		{`let log = []; try { throw "x"; } catch (e) { log = push(log, "catch"); } finally { log = push(log, "finally"); } log;`, []interface{}{"catch", "finally"}},
+		{`let log = []; try { try { throw "x"; } catch (e) { throw "y"; } finally { log = push(log, "finally"); } } catch (e) { log = push(log, e["message"]); } log;`, []interface{}{"finally", "y"}},
+		{`let log = []; let f = fn() { try { return 1; } finally { log = push(log, "finally"); } }; [f(), log];`, []interface{}{1, []interface{}{"finally"}}},
+		{`let f = fn() { try { return 1; } finally { return 2; } }; f();`, 2},
+		{`let f = fn() { try { throw "x"; } finally { return "swallowed"; } }; f();`, "swallowed"},
+		{`let x = 0; let f = fn() { try { return x; } finally { x = 5; } }; [f(), x];`, []interface{}{0, 5}},
+		{`let log = []; let f = fn() { try { try { return 1; } finally { log = push(log, 1); } } finally { log = push(log, 2); } }; [f(), log];`, []interface{}{1, []interface{}{1, 2}}},
+		{`let f = fn() { try { throw "x"; } finally { 1; } }; f();`, fmt.Errorf("x")},
+		{`try { 1 } finally { throw "from finally"; }`, fmt.Errorf("from finally")},
+		// ...including through break and continue.
+		{`let log = [];
+		  for x in [1, 2, 3] {
+			try {
+				if (x == 2) { continue; }
+				if (x == 3) { break; }
+				log = push(log, x);
+			} finally {
+				log = push(log, "f" + "x");
+			}
+		  }
+		  log;`, []interface{}{1, "fx", "fx", "fx"}},
+		{`let n = 0;
+		  while (true) {
+			try { throw "x"; } catch (e) { n++; if (n == 3) { break; } continue; }
+		  }
+		  n;`, 3},
+		{`let n = 0;
+		  while (n < 5) {
+			n++;
+			try { throw "x"; } finally { break; }
+		  }
+		  n;`, 1},
+		{`let log = [];
+		  try {
+			for (let i = 0; i < 3; i++) {
+				try { if (i == 1) { break; } } finally { log = push(log, i); }
+			}
+			log = push(log, "after");
+		  } finally {
+			for x in [1, 2] { if (x == 2) { break; } log = push(log, "outer"); }
+		  }
+		  log;`, []interface{}{0, 1, "after", "outer"}},
+		{`let f = fn() {
+			let log = [0, 0];
+			for x in [1, 2] {
+				try { return log; } finally { for y in [0, 1] { log[y] = y + 3; } }
+			}
+		  };
+		  f();`, []interface{}{3, 4}},
+		// Closures keep working after an error unwinds the frames they were
+		// created in.
+		{`let counter = fn() { let n = 0; fn() { n++; if (n == 2) { throw "two"; } n } };
+		  let c = counter();
+		  let r = [];
+		  for i in [1, 2, 3] { try { r = push(r, c()); } catch (e) { r = push(r, e["message"]); } }
+		  r;`, []interface{}{1, "two", 3}},
+		{`let deep = fn(n) { if (n == 0) { throw "bottom"; } deep(n - 1) + 1 };
+		  let r = 0;
+		  try { deep(50); } catch (e) { r = e["message"]; }
+		  [r, deep(1)];`, fmt.Errorf("bottom")},
+	})
+}
+
+func TestArithmeticErrors(t *testing.T) {
+	runConformanceTests(t, []conformanceCase{
+		{"1 / 0", fmt.Errorf("division by zero")},
+		{"let f = fn(x) { 10 % x }; f(0);", fmt.Errorf("modulo by zero")},
+		{"let x = 5; x /= 0;", fmt.Errorf("division by zero")},
+		{"1.0 / 0", fmt.Errorf("division by zero")},
+		{"1 / 0.0", fmt.Errorf("division by zero")},
+		{"1.5 % 0", fmt.Errorf("modulo by zero")},
+		{"let x = 2.5; x /= 0.0;", fmt.Errorf("division by zero")},
+		{"0.0 / 0", fmt.Errorf("division by zero")},
+		{"1.0 / 1e-320 > 1e308", true},
+		// Without checked arithmetic, integers wrap around.
+		{"9223372036854775807 + 1", -9223372036854775807 - 1},
+		{"2 ** 64", 0},
+		{"let min = -9223372036854775807 - 1; [min / -1, min % -1, -min];", []interface{}{-9223372036854775807 - 1, 0, -9223372036854775807 - 1}},
+	})
+}
+
+func TestCheckedArithmetic(t *testing.T) {
+	runConformanceTestsWithOptions(t, options{checkedArithmetic: true}, []conformanceCase{
+		{"9223372036854775806 + 1", 9223372036854775807},
+		{"9223372036854775807 + 1", fmt.Errorf("integer overflow: 9223372036854775807 + 1")},
+		{"-9223372036854775807 - 2", fmt.Errorf("integer overflow: -9223372036854775807 - 2")},
+		{"4611686018427387904 * 2", fmt.Errorf("integer overflow: 4611686018427387904 * 2")},
+		{"-4611686018427387904 * 2", -9223372036854775807 - 1},
+		{"2 ** 62", 4611686018427387904},
+		{"2 ** 63", fmt.Errorf("integer overflow: 2 ** 63")},
+		{"let min = -9223372036854775807 - 1; min / -1;", fmt.Errorf("integer overflow: -9223372036854775808 / -1")},
+		{"let min = -9223372036854775807 - 1; -min;", fmt.Errorf("integer overflow: -(-9223372036854775808)")},
+		{"let x = 9223372036854775807; x++;", fmt.Errorf("integer overflow: 9223372036854775807 + 1")},
+		{"let f = fn(x) { x * x }; f(3037000499);", 9223372030926249001},
+		{"let f = fn(x) { x * x }; f(3037000500);", fmt.Errorf("integer overflow: 3037000500 * 3037000500")},
+		{"1 / 0", fmt.Errorf("division by zero")},
+	})
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	runConformanceTests(t, []conformanceCase{
+		{"3.14", 3.14},
+		{"1e-9", 1e-9},
+		{"2.5E3", 2500.0},
+		{"1e+2", 100.0},
+		{"-1.5", -1.5},
+		{"0.5 + 0.25", 0.75},
+		{"1.5 * 2", 3.0},
+		{"2 * 1.5", 3.0},
+		{"1 / 4.0", 0.25},
+		{"1 / 4", 0},
+		{"7.5 % 2", 1.5},
+		{"2.0 ** 0.5 * 2.0 ** 0.5 > 1.99", true},
+		{"2 ** 10", 1024},
+		{"2 ** -1", 0.5},
+		{"3 ** 39", 4052555153018976267},
+		{"1.0 == 1", true},
+		{"1 < 1.5", true},
+		{"2.5 >= 2.5", true},
+		{"let x = 1.5; x += 1; x;", 2.5},
+		{"let x = 0.5; x++; x;", 1.5},
+		{"let ratio = fn(a, b) { a * 100.0 / b }; ratio(1, 8);", 12.5},
+		{`"a" + 1.5`, fmt.Errorf("type mismatch: STRING + FLOAT")},
+		{"1.5 + true", fmt.Errorf("type mismatch: FLOAT + BOOLEAN")},
+		{"-true", fmt.Errorf("unknown operator: -BOOLEAN")},
+	})
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	runConformanceTests(t, []conformanceCase{
+		{"true", true},
+		{"1 < 2", true},
+		{"1 <= 1", true},
+		{"2 > 1", true},
+		{"1 >= 2", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"true == false", false},
+		{"true != false", true},
+		{"1 > 2 && 2 > 1", false},
+		{"1 > 2 || 2 > 1", true},
+		{"1 && 0", false},
+		{"1 || 0", true},
+		{"!true", false},
+		{"!5", false},
+		{"!!5", true},
+		{`"a" == "a"`, true},
+		{`"a" != "b"`, true},
+	})
+}
+
+func TestConditionals(t *testing.T) {
+	runConformanceTests(t, []conformanceCase{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 }", nil},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (0) { 10 } else { 20 }", 10},
+		{"if (if (false) { 1 }) { 10 } else { 20 }", 20},
+		{"if (true) { let a = 1; }", nil},
+		{"if (10 > 1) { if (10 > 2) { return 10; } return 1; }", 10},
+	})
+}
+
+func TestBindings(t *testing.T) {
+	runConformanceTests(t, []conformanceCase{
+		{"let a = 5; a;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+		{"let a = 5; let a = a + 1; a;", 6},
+		{"let a = 5;", nil},
+		{"let f = fn() { let a = 1; let a = a + 1; a }; f();", 2},
+	})
+}
+
+func TestAssignment(t *testing.T) {
+	runConformanceTests(t, []conformanceCase{
+		{"let a = 5; a = 10; a;", 10},
+		{"let a = 5; a = 10;", 10},
+		{"let a = 1; let b = 2; a = b = 3; a + b;", 6},
+		{"let a = 5; a += 2; a -= 1; a *= 3; a /= 4; a %= 3; a;", 1},
+		{`let s = "foo"; s += "bar"; s;`, "foobar"},
+		{"let a = 5; [++a, a++, a, --a, a--, a];", []interface{}{6, 6, 7, 6, 6, 5}},
+		{"let a = 1; let f = fn() { a = a + 1; }; f(); f(); a;", 3},
+		{"let f = fn() { let a = 1; a += 1; a }; f();", 2},
+		{"let a = 1; let f = fn() { let a = 10; a = a + 1; }; f(); a;", 1},
+		{`let counter = fn() {
+			let count = 0;
+			fn() { count++; count }
+		  };
+		  let c = counter(); c(); c(); c();`, 3},
+		{`let counter = fn() {
+			let count = 0;
+			let inc = fn() { fn() { count += 1 } };
+			let get = fn() { count };
+			inc()(); inc()();
+			get()
+		  };
+		  counter();`, 2},
+		{`let f = fn() {
+			let a = 1;
+			let get = fn() { a };
+			let a = 2;
+			get()
+		  };
+		  f();`, 2},
+		{"let sum = 0; for x in [1, 2, 3] { sum += x; } sum;", 6},
+		{"let f = fn() { let sum = 0; for x in [1, 2, 3] { sum += x; } sum }; f();", 6},
+		{`let fs = [];
+		  for x in [1, 2, 3] { let y = x; fs = push(fs, fn() { y *= 10; y }); }
+		  [fs[0](), fs[1](), fs[2](), fs[0]()];`, []interface{}{10, 20, 30, 100}},
+		{"b = 1;", fmt.Errorf("identifier not found: b")},
+		{"b++;", fmt.Errorf("identifier not found: b")},
+		{`let a = "foo"; a -= 1;`, fmt.Errorf("type mismatch: STRING - INTEGER")},
+	})
+}
+
+func TestStrings(t *testing.T) {
+	runConformanceTests(t, []conformanceCase{
+		{`"hello"`, "hello"},
+		{`"hello" + " " + "world"`, "hello world"},
+		{`let f = fn(first, last) { first + " " + last }; f("Makram", "Kamaleddine")`, "Makram Kamaleddine"},
+		{`"say \"hi\"\n" + "\tC:\\"`, "say \"hi\"\n\tC:\\"},
+		{`"caf\u{e9}"`, "café"},
+		{"`raw \\n`", `raw \n`},
+		{"`two\nlines` == \"two\\nlines\"", true},
+		{`len("\n")`, 1},
+	})
+}
+
+func TestUnicode(t *testing.T) {
+	runConformanceTests(t, []conformanceCase{
+		{`let имя = "Зоя"; let 名前 = "花子"; имя + 名前`, "Зоя花子"},
+		{`let नाम = "राम"; नाम`, "राम"},
+		{"let _x2 = 1; _x2 + 1", 2},
+		{`len("héllo")`, 5},
+		{`len("日本語")`, 3},
+		{`bytelen("héllo")`, 6},
+		{`bytelen("")`, 0},
+		{`"héllo"[1]`, "é"},
+		{`"日本語"[-1]`, "語"},
+		{`let s = "añb"; s[0] + s[1] + s[2]`, "añb"},
+		{`"日本語"[3]`, fmt.Errorf("out of bounds error: index 3 is out of range for string")},
+		{`""[-1]`, fmt.Errorf("out of bounds error: index -1 is out of range for string")},
+		{`"abc"["a"]`, fmt.Errorf("index operator not supported: STRING")},
+		{`let s = "abc"; s[0] = "x";`, fmt.Errorf("index operator not supported: STRING")},
+		{"bytelen([1])", fmt.Errorf("argument to 'bytelen' must be STRING, got ARRAY")},
+	})
+}
+
+func TestFunctionsAndClosures(t *testing.T) {
+	runConformanceTests(t, []conformanceCase{
+		{"let f = fn(x) { return x + 2; }; f(2);", 4},
+		{"let f = fn(x, y) { x ** 2 + y ** 2 }; f(2, 2);", 8},
+		{"fn(x) { x * 2 }(21)", 42},
+		{"let f = fn() { }; f();", nil},
+		{"let f = fn() { let a = 1; }; f();", nil},
+		{"let f = fn() { return 1; 2 }; f();", 1},
+		{"let newAdder = fn(a) { fn(b) { a + b } }; let addTwo = newAdder(2); addTwo(3);", 5},
+		{`let newAdder = fn(a, b) {
+			let c = a + b;
+			fn(d) { let e = d + c; fn(f) { e + f } }
+		  };
+		  newAdder(1, 2)(3)(4);`, 10},
+		{"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15);", 610},
+		{`let wrapper = fn() {
+			let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1) } };
+			countDown(10)
+		  };
+		  wrapper();`, 0},
+		{"let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } }; let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } }; isEven(10);", true},
+		{"let x = 2; let f = fn(x) { x ** 2 }; f(3);", 9},
+	})
+}
+
+func TestBuiltins(t *testing.T) {
+	runConformanceTests(t, []conformanceCase{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len([1, 2, 3])`, 3},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, nil},
+		{`last([1, 2, 3])`, 3},
+		{`rest([1, 2, 3])`, []interface{}{2, 3}},
+		{`rest([])`, nil},
+		{`push([1], 2)`, []interface{}{1, 2}},
+		{`puts()`, nil},
+		{`let len = fn(x) { 42 }; len([1]);`, 42},
+	})
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		limits object.Limits
+		conformanceCase
+	}{
+		{object.Limits{MaxSteps: 100}, conformanceCase{"while (true) {}", fmt.Errorf("maximum number of steps exceeded: 100")}},
+		{object.Limits{MaxSteps: 100}, conformanceCase{"let r = 0; try { while (true) {} } catch (e) { r = 1; } r;", fmt.Errorf("maximum number of steps exceeded: 100")}},
+		{object.Limits{MaxSteps: 1000}, conformanceCase{"let r = 0; for (let i = 0; i < 10; i++) { r += i; } r;", 45}},
+		{object.Limits{MaxCallDepth: 10}, conformanceCase{"let f = fn(n) { 1 + f(n + 1) }; f(0);", fmt.Errorf("maximum call depth exceeded: 10")}},
+		{object.Limits{MaxCallDepth: 10}, conformanceCase{"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(9);", 9}},
+		{object.Limits{MaxStringLength: 8}, conformanceCase{`let s = "ab"; while (true) { s = s + s; }`, fmt.Errorf("maximum string length exceeded: 8")}},
+		{object.Limits{MaxStringLength: 8}, conformanceCase{`let s = "abcd"; s += "efgh"; s;`, "abcdefgh"}},
+		{object.Limits{MaxArrayLength: 3}, conformanceCase{"[1, 2, 3, 4]", fmt.Errorf("maximum array length exceeded: 3")}},
+		{object.Limits{MaxArrayLength: 3}, conformanceCase{"push([1, 2, 3], 4)", fmt.Errorf("maximum array length exceeded: 3")}},
+		{object.Limits{MaxArrayLength: 3}, conformanceCase{"let a = []; for (let i = 0; i < 3; i++) { a = push(a, i); } a;", []interface{}{0, 1, 2}}},
+		{object.Limits{MaxHashSize: 2}, conformanceCase{"{1: 1, 2: 2, 3: 3}", fmt.Errorf("maximum hash size exceeded: 2")}},
+		{object.Limits{MaxHashSize: 2}, conformanceCase{`let h = {}; h["a"] = 1; h["b"] = 2; h["c"] = 3;`, fmt.Errorf("maximum hash size exceeded: 2")}},
+		{object.Limits{MaxHashSize: 2}, conformanceCase{`let h = {"a": 1}; h["b"] = 2; h["a"] = 3; h["a"] + h["b"];`, 5}},
+	}
+
+	for _, tt := range tests {
+		runConformanceTestsWithOptions(t, options{limits: tt.limits}, []conformanceCase{tt.conformanceCase})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	runConformanceTestsWithOptions(t, options{ctx: ctx}, []conformanceCase{
+		{"while (true) {}", fmt.Errorf("evaluation stopped: context canceled")},
+		{"let f = fn() { f() }; try { f(); } catch (e) { 1 }", fmt.Errorf("evaluation stopped: context canceled")},
+	})
+}
+
+func TestStreams(t *testing.T) {
+	program := parser.New(lexer.New(`puts(1, "a"); let f = fn() { puts([true]) }; f(); puts()`)).ParseProgram()
+
+	for _, e := range engines {
+		var stdout bytes.Buffer
+		actual := e.run(program, options{streams: object.Streams{Stdout: &stdout, Stderr: &stdout}})
+		assertObject(t, nil, actual, e.name)
+		assert.Equal(t, "1\na\n[true]\n", stdout.String(), e.name)
+	}
+
+	// Functions print the same on both engines, whatever they capture.
+	program = parser.New(lexer.New(`let y = 1; let f = fn() { let z = 2; fn(x) { x + y + z } }; puts(f(), [len]);`)).ParseProgram()
+	for _, e := range engines {
+		var stdout bytes.Buffer
+		e.run(program, options{streams: object.Streams{Stdout: &stdout, Stderr: &stdout}})
+		assert.Equal(t, "fn(x) {\n((x + y) + z)\n}\n[builtin function]\n", stdout.String(), e.name)
+	}
+}
+
+func TestNumericBuiltins(t *testing.T) {
+	runConformanceTests(t, []conformanceCase{
+		{"int(3.9)", 3},
+		{"int(-3.9)", -3},
+		{"int(7)", 7},
+		{`int("42")`, 42},
+		{"float(2)", 2.0},
+		{`float("1e3")`, 1000.0},
+		{"int(1e19)", fmt.Errorf("argument to 'int' out of range, got 1e+19")},
+		{`int("4.2")`, fmt.Errorf(`could not parse "4.2" as integer`)},
+		{`float("x")`, fmt.Errorf(`could not parse "x" as float`)},
+		{"int([])", fmt.Errorf("argument to 'int' not supported, got ARRAY")},
+		{"import math; [floor(2.5), floor(-2.5), floor(3)];", []interface{}{2, -3, 3}},
+		{"import math; [ceil(2.5), ceil(-2.5), ceil(3)];", []interface{}{3, -2, 3}},
+		{"import math; [round(2.5), round(2.4), round(-2.5), round(-2.4), round(7)];", []interface{}{3, 2, -3, -2, 7}},
+		{"import math; [sqrt(16), sqrt(2.25), sqrt(0)];", []interface{}{4.0, 1.5, 0.0}},
+		{"import math; let r = sqrt(2); r * r - 2 < 1e-15 && 2 - r * r < 1e-15;", true},
+		{"import math; let r = sqrt(-1); r != r;", true},
+		{"import math; round(2 * 100.0 / 3);", 67},
+	})
+}
+
+func TestArraysAndHashes(t *testing.T) {
+	runConformanceTests(t, []conformanceCase{
+		{"[]", []interface{}{}},
+		{"[1, 2 * 2, 3 + 3]", []interface{}{1, 4, 6}},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][-3]", 1},
+		{"let a = [1, 2, 3]; a[-1] = 4; a;", []interface{}{1, 2, 4}},
+		{"[1, 2, 3][3]", fmt.Errorf("out of bounds error: index 3 is out of range for array")},
+		{"[1, 2, 3][-4]", fmt.Errorf("out of bounds error: index -4 is out of range for array")},
+		{"[][0]", fmt.Errorf("out of bounds error: index 0 is out of range for array")},
+		{"let a = [1, [2, 3]]; a[1][0];", 2},
+		{`{"one": 1, "two": 2}["two"]`, 2},
+		{`{"one": 1}["two"]`, nil},
+		{`{1: "one", true: "yes"}[true]`, "yes"},
+		{`let key = "k"; {key: [1, 2]}[key][1]`, 2},
+	})
+}
+
+func TestIndexAssignment(t *testing.T) {
+	runConformanceTests(t, []conformanceCase{
+		{"let a = [1, 2, 3]; a[1] = 5; a;", []interface{}{1, 5, 3}},
+		{"let a = [1, 2, 3]; let b = a; b[0] = 7; a[0];", 7},
+		{"let a = [1, 2, 3]; [a[0]++, ++a[1], a[2] *= 10, a];", []interface{}{1, 3, 30, []interface{}{2, 3, 30}}},
+		{"let a = [[1], [2]]; a[1][0] = 9; a;", []interface{}{[]interface{}{1}, []interface{}{9}}},
+		{`let h = {"a": 1}; h["a"] = 2; h["b"] = 3; h["a"] + h["b"];`, 5},
+		{`let h = {"a": {"b": 1}}; h["a"]["b"] += 1; h["a"]["b"];`, 2},
+		{`let i = 0; let next = fn() { i++ }; let a = [10, 20]; a[next()] += 1; [a, i];`, []interface{}{[]interface{}{11, 20}, 1}},
+		{"let set = fn(arr) { arr[0] = 42; }; let a = [0]; set(a); a[0];", 42},
+		{"let a = [0, 0, 0]; for x in [0, 1, 2] { a[x] = x * x; } a;", []interface{}{0, 1, 4}},
+		{"let a = push(push([], 1), 2); let b = push(a, 3); let c = push(a, 4); [b, c];", []interface{}{[]interface{}{1, 2, 3}, []interface{}{1, 2, 4}}},
+		{"let a = push(push([], 1), 2); let b = push(a, 3); a[0] = 9; [a, b];", []interface{}{[]interface{}{9, 2}, []interface{}{1, 2, 3}}},
+		{"let a = push(push([], 1), 2); let b = push(a, 3); b[0] = 9; [a, b];", []interface{}{[]interface{}{1, 2}, []interface{}{9, 2, 3}}},
+		{"let a = [1, 2, 3]; let r = rest(a); r[0] = 9; a[0] = 7; [a, r];", []interface{}{[]interface{}{7, 2, 3}, []interface{}{9, 3}}},
+		{"let r = rest([1, 2]); let b = push(r, 3); let c = push(r, 4); [r, b, c];", []interface{}{[]interface{}{2}, []interface{}{2, 3}, []interface{}{2, 4}}},
+		{"let a = [1]; a[1] = 2;", fmt.Errorf("out of bounds error: index 1 is out of range for array")},
+		{"let a = [1]; a[-2] = 2;", fmt.Errorf("out of bounds error: index -2 is out of range for array")},
+		{"let h = {}; h[[1]] = 2;", fmt.Errorf("unusable as hash key: [1]")},
+		{"let s = 1; s[0] = 2;", fmt.Errorf("index operator not supported: INTEGER")},
+		{`let h = {}; h["a"] += 1;`, fmt.Errorf("type mismatch: NULL + INTEGER")},
+	})
+}
+
+func TestForEachLoops(t *testing.T) {
+	runConformanceTests(t, []conformanceCase{
+		{"let sum = fn(arr) { let total = [0]; for x in arr { let total = [total[0] + x]; } total[0] }; sum([1, 2, 3]);", 0},
+		{"let find = fn(arr, y) { for x in arr { if (x == y) { return x; } } -1 }; find([1, 2, 3], 2);", 2},
+		{"let find = fn(arr, y) { for x in arr { if (x == y) { return x; } } -1 }; find([1, 2, 3], 4);", -1},
+		{"for x in [1, 2, 3] { if (x == 2) { return x * 10; } }", 20},
+		{"let count = fn(h) { let n = 0; for k, v in h { return v; } n }; count({\"a\": 1});", 1},
+		{"let f = fn() { for x in [1, 2, 3] { if (x == 2) { break; } } 7 }; f();", 7},
+		{"for x in [1, 2, 3] { let y = x; } y", fmt.Errorf("identifier not found: y")},
+		{`let first = fn(arr) { let fs = []; for x in arr { return fn() { x * 2 }; } fs }; first([21, 1])();`, 42},
+		{`for x in [1] { for y in [2] { return x + y; } }`, 3},
+	})
+}
+
+func TestLoops(t *testing.T) {
+	runConformanceTests(t, []conformanceCase{
+		{"let i = 0; while (i < 10) { i++; } i;", 10},
+		{"let i = 0; while (i < 10) { i++; if (i == 5) { break; } } i;", 5},
+		{"let i = 0; while (false) { i++; }", nil},
+		{"let sum = 0; for (let i = 0; i < 5; i++) { sum += i; } sum;", 10},
+		{"let sum = 0; for (let i = 0; i < 5; i++) { if (i % 2 == 0) { continue; } sum += i; } sum;", 4},
+		{"let i = 0; for (; i < 3;) { i += 1; } i;", 3},
+		{"let n = 0; for (;;) { n++; if (n > 2) { if (true) { break; } } } n;", 3},
+		{"let n = 0; for x in [1, 2, 3] { if (x == 2) { continue; } n += x; } n;", 4},
+		{`let n = 0;
+		  for (let i = 0; i < 3; i++) {
+			for (let j = 0; j < 3; j++) {
+				if (j > i) { break; }
+				if (j == 1) { continue; }
+				n += 10 * i + j;
+			}
+		  }
+		  n;`, 52},
+		{"let f = fn() { let i = 0; while (true) { i++; if (i == 3) { return i * 10; } } }; f();", 30},
+		{"let f = fn(n) { let s = 0; for (let i = 1; i <= n; i++) { s += i; } s }; f(100);", 5050},
+		{"let i = 0; while (i < 100000) { i++; } i;", 100000},
+		{`let fs = [];
+		  for (let i = 0; i < 3; i++) { let j = i; fs = push(fs, fn() { j * 10 }); }
+		  [fs[0](), fs[1](), fs[2]()];`, []interface{}{0, 10, 20}},
+		{`let fs = [];
+		  for (let i = 0; i < 2; i++) { fs = push(fs, fn() { i }); }
+		  [fs[0](), fs[1]()];`, []interface{}{2, 2}},
+		{"for (let i = 0; i < 3; i++) { } i;", fmt.Errorf("identifier not found: i")},
+		{"while (1 + true) { }", fmt.Errorf("type mismatch: INTEGER + BOOLEAN")},
+		{"continue;", fmt.Errorf("continue cannot be used outside a loop context")},
+	})
+}
+
+func TestImports(t *testing.T) {
+	runConformanceTests(t, []conformanceCase{
+		{"import math; max(1, 2) + min(3, 4);", 5},
+		{"import math; INT_MAX;", 9223372036854775807},
+		{"import functools; map([1, 2, 3], fn(x) { x * 2 });", []interface{}{2, 4, 6}},
+		{"import functools; filter([1, 2, 3, 4], fn(x) { x % 2 == 0 });", []interface{}{2, 4}},
+		{"import functools; reduce([1, 2, 3], 10, fn(acc, x) { acc + x });", 16},
+		{"import functools; sum([1, 2, 3, 4]);", 10},
+		{"let f = fn() { import math; max(1, 2) }; f();", 2},
+		{"import doesnotexist;", fmt.Errorf("standard module does not exist: doesnotexist. Was the Monkey stdlib path specified correctly?")},
+		{"import math as m; m.max(1, 2);", 2},
+		{"import math as m; max(1, 2);", fmt.Errorf("identifier not found: max")},
+		{"import functools; import functools; sum([1, 2]);", 3},
+	})
+}
+
+func TestOS(t *testing.T) {
+	t.Setenv("MONKEY_TEST_VAR", "value")
+
+	runConformanceTestsWithOptions(t, options{osAccess: true}, []conformanceCase{
+		{`import os; getenv("MONKEY_TEST_VAR");`, "value"},
+		{`import os as os; os.getenv("MONKEY_TEST_VAR");`, "value"},
+		{`import os; getenv("MONKEY_TEST_UNSET_VAR");`, nil},
+		{`import os; getenv(1);`, fmt.Errorf("argument to 'getenv' must be STRING, got INTEGER")},
+		{`import os; exit(3);`, fmt.Errorf("exit status 3")},
+		{`import os; exit();`, fmt.Errorf("exit status 0")},
+		{`import os; exit("1");`, fmt.Errorf("argument to 'exit' must be INTEGER, got STRING")},
+		{`import os; try { exit(1) } catch (e) { 2 }`, fmt.Errorf("exit status 1")},
+		{`import os; let f = fn() { try { exit(1) } finally { return 2; } }; f();`, fmt.Errorf("exit status 1")},
+		{`import os; exit(256);`, fmt.Errorf("exit status out of range 0-255, got 256")},
+		{`import os; exit(-1);`, fmt.Errorf("exit status out of range 0-255, got -1")},
+	})
+
+	// Programs can't use the operating system unless they are allowed to.
+	runConformanceTests(t, []conformanceCase{
+		{`import os; getenv("MONKEY_TEST_VAR");`, fmt.Errorf("'getenv' needs access to the operating system, which the program doesn't have")},
+		{`import os; exit(3);`, fmt.Errorf("'exit' needs access to the operating system, which the program doesn't have")},
+		{`import os; let kind = ""; try { exit(3) } catch (e) { kind = e["kind"]; } kind;`, "RuntimeError"},
+	})
+
+	runConformanceTestsWithOptions(t, options{args: []string{"a", "b"}}, []conformanceCase{
+		{`args`, []interface{}{"a", "b"}},
+		{`let f = fn() { len(args) }; f();`, 2},
+		{`let args = [1]; args;`, []interface{}{1}},
+		{`import "./testdata/modules/args" as m; m.all();`, []interface{}{"a", "b"}},
+	})
+	runConformanceTestsWithOptions(t, options{args: []string{}}, []conformanceCase{
+		{`args`, []interface{}{}},
+	})
+}
+
+func TestExit(t *testing.T) {
+	program := parser.New(lexer.New(`import os; let f = fn() { exit(7) }; f(); 1`)).ParseProgram()
+
+	for _, e := range engines {
+		actual := e.run(program, options{osAccess: true})
+		if assert.IsType(t, &object.Error{}, actual, e.name) {
+			assert.Equal(t, object.ExitError, actual.(*object.Error).Kind, e.name)
+			assert.Equal(t, 7, actual.(*object.Error).Code, e.name)
+		}
+	}
+}
+
+func TestFileModules(t *testing.T) {
+	runConformanceTests(t, []conformanceCase{
+		{`import "./testdata/modules/util"; util.helper(2);`, 4},
+		{`import "./testdata/modules/util.monkey"; util.helper(2);`, 4},
+		{`import "./testdata/modules/util" as u; u.helper(2);`, 4},
+		{`let helper = 1; import "./testdata/modules/util"; helper + util.helper(2);`, 5},
+		{`import "./testdata/modules/util" as a; import "./testdata/modules/util" as b; a.next(); b.next();`, 2},
+		{`import "./testdata/modules/util"; import "./testdata/modules/lib/shout"; util.next(); shout.count();`, 2},
+		{`import "./testdata/modules/lib/shout" as s; s.shout("hi");`, "hi!"},
+		{`let f = fn() { import "./testdata/modules/util" as u; u.next() }; f(); f();`, 2},
+		{`import "./testdata/modules/my-module" as m; m.answer;`, 42},
+		{`let secret = 1; import "./testdata/modules/globals"; globals.get();`, fmt.Errorf("identifier not found: secret")},
+		{`import "./testdata/modules/cycle_a";`, fmt.Errorf("import cycle: testdata/modules/cycle_a.monkey -> testdata/modules/cycle_b.monkey -> testdata/modules/cycle_a.monkey")},
+		{`import "./testdata/modules/missing";`, fmt.Errorf("module does not exist: testdata/modules/missing.monkey")},
+		{`import "./testdata/modules/syntax";`, fmt.Errorf("testdata/modules/syntax.monkey:1:5: expected next token to be 'IDENT', got '=' instead\ntestdata/modules/syntax.monkey:1:5: no prefix parse function found for '='")},
+		// Errors are reported as they are, whatever they contain.
+		{`import "./testdata/modules/percent";`, errors.New("testdata/modules/percent.monkey:1:9: no prefix parse function found for '%'\ntestdata/modules/percent.monkey:1:11: expected next token to be ';', got 'INT' instead")},
+		{`import "./testdata/modules/nope%d";`, errors.New("module name nope%d is not an identifier, import it with 'as' instead")},
+		{`import "./testdata/modules/my-module";`, fmt.Errorf("module name my-module is not an identifier, import it with 'as' instead")},
+		{`import "./testdata/modules/util"; util.nope;`, fmt.Errorf("module util has no member nope")},
+		{`import "./testdata/modules/util" as u; u;`, fmt.Errorf("cannot use module u as a value")},
+		{`import "./testdata/modules/util" as u; u = 1;`, fmt.Errorf("cannot assign to module u")},
+		{`import "./testdata/modules/lib/shout"; shout.util;`, fmt.Errorf("cannot use module shout.util as a value")},
+		{"let x = 1; x.y;", fmt.Errorf("x is not a module")},
+		{"len.y;", fmt.Errorf("len is not a module")},
+		{"[1].y;", fmt.Errorf("[1] is not a module")},
+		{"u.y;", fmt.Errorf("identifier not found: u")},
+	})
+}
+
+func TestModuleExports(t *testing.T) {
+	runConformanceTests(t, []conformanceCase{
+		{"import shapes; area(3);", 9},
+		{"import shapes; _square(3);", fmt.Errorf("identifier not found: _square")},
+		{"import shapes as s; s._square(3);", fmt.Errorf("cannot access private member _square of module shapes")},
+		{"import shapes (area); area(2);", 4},
+		{"import shapes (_square);", fmt.Errorf("cannot import _square from module shapes")},
+		{"import functools (map, filter); filter(map([1, 2, 3], fn(x) { x * 2 }), fn(x) { x > 2 });", []interface{}{4, 6}},
+		{"import functools (map); sum([1]);", fmt.Errorf("identifier not found: sum")},
+		{"import functools (nope);", fmt.Errorf("cannot import nope from module functools")},
+		{`import "./testdata/modules/util" (helper, next); helper(2) + next();`, 5},
+		{`import "./testdata/modules/util"; util._factor;`, fmt.Errorf("cannot access private member _factor of module util")},
+		{`import "./testdata/modules/util" (_factor);`, fmt.Errorf("cannot import _factor from module util")},
+		{`let f = fn() { import "./testdata/modules/util" (helper); helper(3) }; f();`, 6},
+		{`import "./testdata/modules/lib/shout" (util); util.helper(1);`, 2},
+	})
+}
+
+func TestErrors(t *testing.T) {
+	runConformanceTests(t, []conformanceCase{
+		{"5 + true;", fmt.Errorf("type mismatch: INTEGER + BOOLEAN")},
+		{"5 + true; 5;", fmt.Errorf("type mismatch: INTEGER + BOOLEAN")},
+		{"-true", fmt.Errorf("unknown operator: -BOOLEAN")},
+		{"true + false;", fmt.Errorf("unknown operator: BOOLEAN + BOOLEAN")},
+		{`"a" - "b"`, fmt.Errorf("unknown operator: STRING - STRING")},
+		{"[1] + [2]", fmt.Errorf("unknown operator: ARRAY + ARRAY")},
+		{"if (10 > 1) { if (10 > 2) { return true + false; } return 1; }", fmt.Errorf("unknown operator: BOOLEAN + BOOLEAN")},
+		{"foobar", fmt.Errorf("identifier not found: foobar")},
+		{"let f = fn() { foobar }; f();", fmt.Errorf("identifier not found: foobar")},
+		{"len(1)", fmt.Errorf("argument to 'len' not supported, got INTEGER")},
+		{`len("one", "two")`, fmt.Errorf("wrong number of arguments. got=2, want=1")},
+		{"fn(x) { x }(1, 2)", fmt.Errorf("wrong number of arguments. got=2, want=1")},
+		{"fn(x, y) { x }(1)", fmt.Errorf("wrong number of arguments. got=1, want=2")},
+		{"1(2)", fmt.Errorf("not a function: INTEGER")},
+		{"[1, 2][5]", fmt.Errorf("out of bounds error: index 5 is out of range for array")},
+		{`[1, 2]["a"]`, fmt.Errorf("index operator not supported: ARRAY")},
+		{"1[0]", fmt.Errorf("index operator not supported: INTEGER")},
+		{`{[1]: 2}`, fmt.Errorf("given key '[1]' is not hashable")},
+		{`{"a": 1}[[1]]`, fmt.Errorf("unusable as hash key: [1]")},
+		{"let h = {}; h[fn(x) { x }] = 1;", fmt.Errorf("unusable as hash key: fn(x) {\nx\n}")},
+		{"{fn() { 1 }: 2}", fmt.Errorf("given key 'fn() {\n1\n}' is not hashable")},
+		{"for x, y in [1] { }", fmt.Errorf("unsupported iteration type: ARRAY and 2 identifiers")},
+		{"break;", fmt.Errorf("break cannot be used outside a loop context")},
+		{"let f = fn() { 1 + f() }; f();", fmt.Errorf("stack overflow")},
+	})
+
+	// Tail calls don't grow the stack, so a function calling itself runs
+	// until it's stopped.
+	runConformanceTestsWithOptions(t, options{limits: object.Limits{MaxSteps: 1000000}}, []conformanceCase{
+		{"let f = fn() { f() }; f();", fmt.Errorf("maximum number of steps exceeded: 1000000")},
+	})
+}
+
+// TestLargePrograms checks that programs up to the limits of the bytecode run
+// the same on both engines.
+func TestLargePrograms(t *testing.T) {
+	params := make([]string, 255)
+	for i := range params {
+		params[i] = fmt.Sprintf("p%d", i)
+	}
+
+	runConformanceTests(t, []conformanceCase{
+		{"let f = fn(" + strings.Join(params, ", ") + ") { p0 + p254 }; f(" + strings.Repeat("1, ", 254) + "2);", 3},
+		{"let x = 0; if (true) { " + strings.Repeat("x = x + 1; ", 5000) + "} x;", 5000},
+		{"let x = 0; while (x < 5000) { " + strings.Repeat("x = x + 1; ", 5000) + "} x;", 5000},
+		{"let a = [" + strings.Repeat("1, ", 9999) + "1]; len(a);", 10000},
+	})
+}
+
+func TestTailCalls(t *testing.T) {
+	runConformanceTests(t, []conformanceCase{
+		{"let count = fn(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } }; count(200000, 0);", 200000},
+		{`let f = fn(n) { if (n == 0) { return "done"; } return f(n - 1); }; f(200000);`, "done"},
+		{"let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; even(100001);", false},
+		{`let f = fn(n) { let r = ""; try { if (n == 0) { throw "done"; } return f(n - 1); } catch (e) { r = e["message"]; } r }; f(10);`, "done"},
+		// Returns inside try statements aren't tail calls, as finally blocks run after them.
+		{"let log = []; let f = fn(n) { try { if (n == 0) { return 0; } return f(n - 1); } finally { log = push(log, n); } }; f(2); log;", []interface{}{0, 1, 2}},
+		{`import functools;
+let a = [];
+for (let i = 0; i < 100000; i++) { a = push(a, i); }
+[len(map(a, fn(x) { x * 2 })), reduce(a, 0, fn(acc, x) { acc + x }), len(filter(a, fn(x) { x % 2 == 0 }))];`, []interface{}{100000, 4999950000, 50000}},
+	})
+
+	runConformanceTestsWithOptions(t, options{limits: object.Limits{MaxCallDepth: 10}}, []conformanceCase{
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(1000);", 0},
+	})
+}
+
+func TestErrorPositions(t *testing.T) {
+	inputs := []string{
+		"let a = 1;\nlet b = a +\n  true;",
+		"let f = fn(x) {\n  x[3]\n};\nf([1]);",
+		"let f = fn() {\n  undefined\n};\nf();",
+		"let f = fn() {\n  len(1, 2)\n};\nf();",
+		"let f = fn(x) { x + true };\nlet g = fn(x) { f(x) };\ng(1);",
+		"let count = fn(n) { if (n == 0) { undefined } else { count(n - 1) } };\ncount(5);",
+		"let f = fn(x, y) { x };\nlet g = fn() { f(1) };\ng();",
+		"let f = fn() { 1 / 0 };\nlet h = {\"f\": f};\nh[\"f\"]();",
+		"import functools;\nmap([1, 2, 0], fn(x) { 10 / x });",
+		"let f = fn(x) {\n  throw {\"message\": \"bad\", \"kind\": \"ValueError\"};\n};\nf(1);",
+		"let f = fn() {\n  try { 1 / 0; } finally { 2; }\n};\nf();",
+		"let f = fn() { 1 / 0 };\ntry { f(); } catch (e) { throw e; }",
+		"import functools;\nlet inc = fn(acc, x) { acc + x };\nreduce([1, \"a\"], 0, inc);",
+		"import \"./testdata/modules/broken\";",
+		"import \"./testdata/modules/util\";\nutil.fail();",
+	}
+
+	for _, input := range inputs {
+		l := lexer.NewWithFilename("script.monkey", input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		assert.Empty(t, p.Errors())
+
+		expected := runEvaluator(program, options{})
+		if !assert.IsType(t, &object.Error{}, expected, input) {
+			continue
+		}
+		assert.True(t, expected.(*object.Error).Pos.IsValid(), input)
+		assert.Equal(t, expected, runVM(program, options{}), input)
+	}
+}
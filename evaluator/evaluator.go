@@ -1,22 +1,67 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
 	"math"
 
 	"github.com/makramkd/go-monkey/ast"
 	"github.com/makramkd/go-monkey/object"
+	"github.com/makramkd/go-monkey/token"
 )
 
 var (
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	TRUE  = object.TrueValue
+	FALSE = object.FalseValue
 
-	NULL  = &object.Null{}
-	BREAK = &object.Break{}
+	NULL     = object.NullValue
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
+// MaxCallDepth is the number of function calls that can be in progress at
+// once, beyond which calls fail with a stack overflow rather than exhausting
+// the Go stack. Limits set on the environment can lower it further.
+const MaxCallDepth = 1 << 16
+
+// EvalContext evaluates root like Eval, stopping with an error once ctx is
+// done. The limits of env apply to this evaluation alone.
+func EvalContext(ctx context.Context, root ast.Node, env *object.Env) object.Object {
+	env.SetContext(ctx)
+	defer env.SetContext(nil)
+
+	return Eval(root, env)
+}
+
 func Eval(root ast.Node, env *object.Env) object.Object {
+	if err := env.Step(); err != nil {
+		return located(err, root, env)
+	}
+	return checked(eval(root, env), root, env)
+}
+
+// checked checks the result of evaluating root against the limits of env.
+func checked(obj object.Object, root ast.Node, env *object.Env) object.Object {
+	if err := env.CheckSize(obj); err != nil {
+		obj = err
+	}
+	return located(obj, root, env)
+}
+
+// located fills in where an error resulting from evaluating root occurred.
+func located(obj object.Object, root ast.Node, env *object.Env) object.Object {
+	// Errors are reported at the innermost node that produced them, so only
+	// fill in a position if none was set while evaluating the node's children.
+	// The call stack is recorded at the same time, before any calls return.
+	if err, ok := obj.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = root.Pos()
+		err.Stack = env.CallStack().Frames()
+	}
+
+	return obj
+}
+
+func eval(root ast.Node, env *object.Env) object.Object {
 	switch node := root.(type) {
 	// Statements
 	case *ast.Program:
@@ -33,38 +78,58 @@ func Eval(root ast.Node, env *object.Env) object.Object {
 		return &object.ReturnValue{Value: val}
 	case *ast.LetStatement:
 		val := Eval(node.Value, env)
-		if isError(val) {
+		if isError(val) || isLoopControl(val) {
 			return val
 		}
 		env.Set(node.Name.Value, val)
 	case *ast.ImportStatement:
-		loaded, err := loadStdModule(node.Module.Value)
-		if err != nil {
-			return newError(err.Error())
+		if err := evalImportStatement(node, env); err != nil {
+			return err
 		}
-
-		// Evaluate the module without returning anything.
-		// This should load any exported symbols into the current environment.
-		Eval(loaded, env)
 	case *ast.ForEachStatement:
 		e := evalForEachStatement(node, env)
-		if isError(e) {
+		if isError(e) || isReturnValue(e) {
+			return e
+		}
+	case *ast.WhileStatement:
+		e := evalWhileStatement(node, env)
+		if isError(e) || isReturnValue(e) {
+			return e
+		}
+	case *ast.ForStatement:
+		e := evalForStatement(node, env)
+		if isError(e) || isReturnValue(e) {
 			return e
 		}
 	case *ast.BreakStatement:
 		return evalBreakStatement(node, env)
+	case *ast.ContinueStatement:
+		return evalContinueStatement(node, env)
+	case *ast.ThrowStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return object.NewThrownError(val)
+	case *ast.TryStatement:
+		return evalTryStatement(node, env)
 
 	// Expressions
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	case *ast.BooleanLiteral:
 		return nativeBoolToBoolean(node.Value)
 	case *ast.PrefixExpression:
+		if node.Operator == "++" || node.Operator == "--" {
+			return evalIncrementExpression(node.Operator, node.Right, true, env)
+		}
 		right := Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return evalPrefixExpression(node.Operator, right, env)
 	case *ast.InfixExpression:
 		left := Eval(node.Left, env)
 		if isError(left) {
@@ -74,7 +139,11 @@ func Eval(root ast.Node, env *object.Env) object.Object {
 		if isError(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		return evalInfixExpression(node.Operator, left, right, env)
+	case *ast.PostfixExpression:
+		return evalIncrementExpression(node.Operator, node.Left, false, env)
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
 	case *ast.Identifier:
@@ -84,13 +153,15 @@ func Eval(root ast.Node, env *object.Env) object.Object {
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Body: body, Env: env}
+		return &object.Function{Parameters: params, Body: body, Env: env, Name: node.Name}
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 	case *ast.ArrayLiteral:
 		return evalArrayLiteral(node, env)
 	case *ast.IndexAccessExpression:
 		return evalIndexAccessExpression(node, env)
+	case *ast.MemberExpression:
+		return evalMemberExpression(node, env)
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
 	}
@@ -124,7 +195,7 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Env) object.Objec
 
 		if result != nil {
 			t := result.Type()
-			if t == object.RETURN_VALUE || t == object.ERROR || t == object.BREAK {
+			if t == object.RETURN_VALUE || t == object.ERROR || t == object.BREAK || t == object.CONTINUE {
 				return result
 			}
 		}
@@ -142,6 +213,11 @@ func nativeBoolToBoolean(b bool) *object.Boolean {
 
 func evalIdentifier(ident *ast.Identifier, env *object.Env) object.Object {
 	if v, ok := env.Get(ident.Value); ok {
+		if _, ok := v.(*object.Module); ok {
+			// Modules only exist at compile time in the VM, so they can't be
+			// passed around.
+			return newError(object.TypeError, "cannot use module %s as a value", ident.Value)
+		}
 		return v
 	}
 
@@ -149,21 +225,25 @@ func evalIdentifier(ident *ast.Identifier, env *object.Env) object.Object {
 		return builtin
 	}
 
-	return newError("identifier not found: %s", ident.Value)
+	return newError(object.NameError, "identifier not found: %s", ident.Value)
 }
 
-func evalInfixExpression(operator string, left, right object.Object) object.Object {
+func evalInfixExpression(operator string, left, right object.Object, env *object.Env) object.Object {
 	switch {
 	case left.Type() == object.INTEGER && right.Type() == object.INTEGER:
-		return evalIntegerInfixExpression(operator, left, right)
+		return evalIntegerInfixExpression(operator, left, right, env.CheckedArithmetic())
+	case isNumber(left) && isNumber(right):
+		// At least one of the operands is a float, so the other one is
+		// promoted to a float too.
+		return evalFloatInfixExpression(operator, left, right)
 	case left.Type() == object.BOOLEAN && right.Type() == object.BOOLEAN:
 		return evalBooleanInfixExpression(operator, left, right)
 	case left.Type() == object.STRING && right.Type() == object.STRING:
-		return evalStringInfixExpression(operator, left, right)
+		return evalStringInfixExpression(operator, left, right, env.Limits())
 	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TypeError, "type mismatch: %s %s %s", left.Type(), operator, right.Type())
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
@@ -181,27 +261,50 @@ func evalBooleanInfixExpression(operator string, left, right object.Object) obje
 	case "!=":
 		return nativeBoolToBoolean(leftVal != rightVal)
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
-func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
+// evalIntegerInfixExpression applies operator to two integers. Arithmetic
+// wraps around on overflow unless checked is set, in which case overflow is
+// reported as an error.
+func evalIntegerInfixExpression(operator string, left, right object.Object, checked bool) object.Object {
 	leftVal := left.(*object.Integer).Value
 	rightVal := right.(*object.Integer).Value
 
+	// integer returns the result of an arithmetic operation, or an error if
+	// it overflowed and overflow is being checked.
+	integer := func(result int64, overflow bool) object.Object {
+		if checked && overflow {
+			return newError(object.ArithmeticError, "integer overflow: %d %s %d", leftVal, operator, rightVal)
+		}
+		return &object.Integer{Value: result}
+	}
+
 	switch operator {
 	// Arithmetic operators
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		return integer(object.AddInt64(leftVal, rightVal))
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		return integer(object.SubInt64(leftVal, rightVal))
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		return integer(object.MulInt64(leftVal, rightVal))
 	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
+		if rightVal == 0 {
+			return newError(object.ArithmeticError, "division by zero")
+		}
+		// The only quotient that doesn't fit is math.MinInt64 / -1.
+		return integer(leftVal/rightVal, leftVal == math.MinInt64 && rightVal == -1)
 	case "**":
-		return &object.Integer{Value: int64(math.Pow(float64(leftVal), float64(rightVal)))}
+		power, overflow := object.IntegerPow(leftVal, rightVal)
+		if checked && overflow {
+			return newError(object.ArithmeticError, "integer overflow: %d ** %d", leftVal, rightVal)
+		}
+		return power
 	case "%":
+		if rightVal == 0 {
+			return newError(object.ArithmeticError, "modulo by zero")
+		}
 		return &object.Integer{Value: leftVal % rightVal}
 
 	// Comparison operators
@@ -225,76 +328,321 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 		return nativeBoolToBoolean((leftVal != 0) || (rightVal != 0))
 
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal, _ := object.ToFloat(left)
+	rightVal, _ := object.ToFloat(right)
+
+	switch operator {
+	// Arithmetic operators
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		// Dividing floats by zero is an error, as it is for integers,
+		// rather than giving an infinity or NaN.
+		if rightVal == 0 {
+			return newError(object.ArithmeticError, "division by zero")
+		}
+		return &object.Float{Value: leftVal / rightVal}
+	case "**":
+		return &object.Float{Value: math.Pow(leftVal, rightVal)}
+	case "%":
+		if rightVal == 0 {
+			return newError(object.ArithmeticError, "modulo by zero")
+		}
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+
+	// Comparison operators
+	case "<":
+		return nativeBoolToBoolean(leftVal < rightVal)
+	case "<=":
+		return nativeBoolToBoolean(leftVal <= rightVal)
+	case ">":
+		return nativeBoolToBoolean(leftVal > rightVal)
+	case ">=":
+		return nativeBoolToBoolean(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBoolean(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBoolean(leftVal != rightVal)
+
+	// Boolean operators
+	case "&&":
+		return nativeBoolToBoolean((leftVal != 0) && (rightVal != 0))
+	case "||":
+		return nativeBoolToBoolean((leftVal != 0) || (rightVal != 0))
+
+	default:
+		return newError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
-func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
+// evalStringInfixExpression applies operator to two strings, checking that
+// concatenating them doesn't exceed limits before doing so.
+func evalStringInfixExpression(operator string, left, right object.Object, limits object.Limits) object.Object {
 	l := left.(*object.String).Value
 	r := right.(*object.String).Value
 	switch operator {
 	case "+":
+		if err := limits.CheckStringLength(len(l) + len(r)); err != nil {
+			return err
+		}
 		return &object.String{Value: l + r}
 	case "==":
 		return nativeBoolToBoolean(l == r)
 	case "!=":
 		return nativeBoolToBoolean(l != r)
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
-func evalPrefixExpression(operator string, right object.Object) object.Object {
+func evalPrefixExpression(operator string, right object.Object, env *object.Env) object.Object {
 	switch operator {
 	case "!":
 		return evalBangOperator(right)
 	case "-":
-		return evalNegativeOperator(right)
+		return evalNegativeOperator(right, env.CheckedArithmetic())
 	default:
 		return NULL
 	}
 }
 
+// compoundOperators maps compound assignment operators to the infix operator
+// they apply before assigning.
+var compoundOperators = map[string]string{
+	"+=": "+",
+	"-=": "-",
+	"*=": "*",
+	"/=": "/",
+	"%=": "%",
+	"++": "+",
+	"--": "-",
+}
+
+func evalAssignExpression(node *ast.AssignExpression, env *object.Env) object.Object {
+	ref, err := evalReference(node.Target, env)
+	if err != nil {
+		return err
+	}
+
+	var current object.Object
+	op, compound := compoundOperators[node.Operator]
+	if compound {
+		current = ref.get()
+		if isError(current) {
+			return current
+		}
+	}
+
+	val := Eval(node.Value, env)
+	if isError(val) {
+		return val
+	}
+
+	if compound {
+		val = evalInfixExpression(op, current, val, env)
+		if isError(val) {
+			return val
+		}
+	}
+
+	return ref.set(val)
+}
+
+// evalIncrementExpression evaluates ++ and --, returning the updated value
+// when used as a prefix and the original value when used as a postfix.
+func evalIncrementExpression(operator string, target ast.Expression, prefix bool, env *object.Env) object.Object {
+	ref, err := evalReference(target, env)
+	if err != nil {
+		return err
+	}
+
+	current := ref.get()
+	if isError(current) {
+		return current
+	}
+
+	val := evalInfixExpression(compoundOperators[operator], current, &object.Integer{Value: 1}, env)
+	if isError(val) {
+		return val
+	}
+
+	if res := ref.set(val); isError(res) {
+		return res
+	}
+
+	if prefix {
+		return val
+	}
+	return current
+}
+
+// reference is a location that can be assigned to: a variable, or an element
+// of an array or hash.
+type reference struct {
+	get func() object.Object
+	set func(val object.Object) object.Object
+}
+
+// evalReference evaluates the parts of an assignment target, i.e the
+// collection and index of an index expression, exactly once so that compound
+// assignments don't repeat their side effects.
+func evalReference(target ast.Expression, env *object.Env) (*reference, object.Object) {
+	switch target := target.(type) {
+	case *ast.Identifier:
+		return &reference{
+			get: func() object.Object {
+				return Eval(target, env)
+			},
+			set: func(val object.Object) object.Object {
+				if current, ok := env.Get(target.Value); ok && current.Type() == object.MODULE {
+					return newError(object.TypeError, "cannot assign to module %s", target.Value)
+				}
+				if _, ok := env.Assign(target.Value, val); !ok {
+					return newError(object.NameError, "identifier not found: %s", target.Value)
+				}
+				return val
+			},
+		}, nil
+	case *ast.IndexAccessExpression:
+		left := Eval(target.Left, env)
+		if isError(left) {
+			return nil, left
+		}
+
+		index := Eval(target.Index, env)
+		if isError(index) {
+			return nil, index
+		}
+
+		return &reference{
+			get: func() object.Object {
+				return evalIndex(left, index)
+			},
+			set: func(val object.Object) object.Object {
+				if res := evalIndexAssignment(left, index, val); isError(res) {
+					return res
+				}
+				// Assigning to a new key grows a hash.
+				if err := env.CheckSize(left); err != nil {
+					return err
+				}
+				return val
+			},
+		}, nil
+	default:
+		return nil, newError(object.RuntimeError, "cannot assign to %s", target.String())
+	}
+}
+
 func evalCallExpression(call *ast.CallExpression, env *object.Env) object.Object {
-	v := Eval(call.Function, env)
-	if isError(v) {
-		return v
+	fn, args, err := evalCall(call, env)
+	if err != nil {
+		return err
+	}
+
+	return applyFunction(fn, args, call.Pos(), env)
+}
+
+// evalCall evaluates the function and arguments of a call.
+func evalCall(call *ast.CallExpression, env *object.Env) (object.Object, []object.Object, object.Object) {
+	fn := Eval(call.Function, env)
+	if isError(fn) {
+		return nil, nil, fn
 	}
 
-	evaluatedArgs := []object.Object{}
+	args := []object.Object{}
 	for _, arg := range call.Arguments {
 		v := Eval(arg, env)
 		if isError(v) {
-			return v
+			return nil, nil, v
 		}
-		evaluatedArgs = append(evaluatedArgs, v)
+		args = append(args, v)
 	}
 
-	switch f := v.(type) {
+	return fn, args, nil
+}
+
+// Apply calls the function or builtin fn with the given arguments, as the
+// program that env belongs to would. Errors are returned as *object.Error
+// values.
+func Apply(fn object.Object, args []object.Object, env *object.Env) object.Object {
+	return applyFunction(fn, args, token.Position{}, env)
+}
+
+// applyFunction calls fn, keeping track of the call made at pos for
+// tracebacks.
+func applyFunction(fn object.Object, args []object.Object, pos token.Position, env *object.Env) object.Object {
+	switch f := fn.(type) {
 	case *object.Function:
-		fEnv := object.NewScopedEnv(f.Env)
-		// evaluate arguments left to right, propagating errors as necessary
-		// and set the appropriate values in the environment.
-		for i, arg := range evaluatedArgs {
-			fEnv.Set(f.Parameters[i].Value, arg)
+		if len(args) != len(f.Parameters) {
+			return newError(object.ArgumentError, "wrong number of arguments. got=%d, want=%d", len(args), len(f.Parameters))
 		}
 
-		// eval the function body with this new environment
-		ret := Eval(f.Body, fEnv)
+		if env.CallStack().Depth() >= MaxCallDepth {
+			return newError(object.RuntimeError, "stack overflow")
+		}
+		if err := env.CheckCallDepth(); err != nil {
+			return err
+		}
 
-		return unwrapReturnValue(ret)
+		stack := env.CallStack()
+		stack.Push(object.Frame{Function: f.Name, Pos: pos})
+		calls := 1
+
+		// Calls in tail position are made here, once the function they are
+		// in has returned, rather than by recursing.
+		var ret object.Object
+		for {
+			fEnv := object.NewScopedEnv(f.Env)
+			for i, arg := range args {
+				fEnv.Set(f.Parameters[i].Value, arg)
+			}
+
+			ret = unwrapReturnValue(evalTail(f.Body, fEnv, true))
+			call, ok := ret.(*tailCall)
+			if !ok {
+				break
+			}
+
+			f, args = call.fn, call.args
+			stack.PushTail(object.Frame{Function: f.Name, Pos: call.pos})
+			calls++
+		}
+
+		for ; calls > 0; calls-- {
+			stack.Pop()
+		}
+		if ret == nil {
+			// e.g the body is empty or ends with a let statement
+			return NULL
+		}
+
+		return ret
 	case *object.Builtin:
-		return f.F(evaluatedArgs...)
+		// Builtins return nil when they have nothing to return.
+		if ret := f.Call(env.Host(), args...); ret != nil {
+			return ret
+		}
+		return NULL
 	default:
-		return newError("not a function: %s", f.Type())
+		return newError(object.TypeError, "not a function: %s", f.Type())
 	}
-
 }
 
 func evalHashLiteral(hash *ast.HashLiteral, env *object.Env) object.Object {
 	hashVal := &object.Hash{Pairs: map[object.HashKey]object.HashPair{}}
 
-	for k, v := range hash.Pairs {
+	for _, k := range hash.Keys() {
+		v := hash.Pairs[k]
 		keyVal := Eval(k, env)
 		if isError(keyVal) {
 			return keyVal
@@ -302,7 +650,7 @@ func evalHashLiteral(hash *ast.HashLiteral, env *object.Env) object.Object {
 
 		hb, ok := isHashable(keyVal)
 		if !ok {
-			return newError("given key '%s' is not hashable", keyVal.Inspect())
+			return newError(object.TypeError, "given key '%s' is not hashable", keyVal.Inspect())
 		}
 
 		valVal := Eval(v, env)
@@ -343,13 +691,19 @@ func evalIndexAccessExpression(expr *ast.IndexAccessExpression, env *object.Env)
 		return index
 	}
 
+	return evalIndex(left, index)
+}
+
+func evalIndex(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY && index.Type() == object.INTEGER:
 		return evalArrayAccessExpression(left, index)
+	case left.Type() == object.STRING && index.Type() == object.INTEGER:
+		return evalStringAccessExpression(left, index)
 	case left.Type() == object.HASH:
 		return evalHashAccessExpression(left, index)
 	default:
-		return newError("index operator not supported: %s", left.Type())
+		return newError(object.TypeError, "index operator not supported: %s", left.Type())
 	}
 }
 
@@ -358,7 +712,7 @@ func evalHashAccessExpression(left, index object.Object) object.Object {
 
 	key, ok := isHashable(index)
 	if !ok {
-		return newError("unusable as hash key: %s", index.Inspect())
+		return newError(object.TypeError, "unusable as hash key: %s", index.Inspect())
 	}
 
 	pair, ok := hash.Pairs[key.HashKey()]
@@ -374,11 +728,54 @@ func evalArrayAccessExpression(left, index object.Object) object.Object {
 	idx := index.(*object.Integer)
 
 	// Access the index at idx or return out of bounds error
-	if int(idx.Value) >= len(array.Values) {
-		return newError("out of bounds error: index %d is out of range for array", idx.Value)
+	i, ok := array.Position(idx.Value)
+	if !ok {
+		return newError(object.IndexError, "out of bounds error: index %d is out of range for array", idx.Value)
+	}
+
+	return array.Values[i]
+}
+
+func evalStringAccessExpression(left, index object.Object) object.Object {
+	str := left.(*object.String)
+	idx := index.(*object.Integer)
+
+	char, ok := str.At(idx.Value)
+	if !ok {
+		return newError(object.IndexError, "out of bounds error: index %d is out of range for string", idx.Value)
 	}
 
-	return array.Values[int(idx.Value)]
+	return char
+}
+
+// evalIndexAssignment sets the element at index in place, so the change is
+// visible through every reference to the array or hash.
+func evalIndexAssignment(left, index, val object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY && index.Type() == object.INTEGER:
+		array := left.(*object.Array)
+		idx := index.(*object.Integer)
+
+		i, ok := array.Position(idx.Value)
+		if !ok {
+			return newError(object.IndexError, "out of bounds error: index %d is out of range for array", idx.Value)
+		}
+
+		array.Set(i, val)
+		return val
+	case left.Type() == object.HASH:
+		hash := left.(*object.Hash)
+
+		key, ok := isHashable(index)
+		if !ok {
+			return newError(object.TypeError, "unusable as hash key: %s", index.Inspect())
+		}
+
+		hash.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: val}
+		return val
+	default:
+		return newError(object.TypeError, "index operator not supported: %s", left.Type())
+	}
 }
 
 func evalForEachStatement(forEach *ast.ForEachStatement, env *object.Env) object.Object {
@@ -399,7 +796,7 @@ func evalForEachStatement(forEach *ast.ForEachStatement, env *object.Env) object
 			newEnv.Set(id.Value, v)
 			newEnv.SetExecutionContext(object.ExecutionContextLoop)
 			r := evalBlockStatement(forEach.Body, newEnv)
-			if isError(r) {
+			if isError(r) || isReturnValue(r) {
 				return r
 			}
 			if r != nil && r.Type() == object.BREAK {
@@ -417,7 +814,7 @@ func evalForEachStatement(forEach *ast.ForEachStatement, env *object.Env) object
 			newEnv.Set(val.Value, pair.Value)
 			newEnv.SetExecutionContext(object.ExecutionContextLoop)
 			r := evalBlockStatement(forEach.Body, newEnv)
-			if isError(r) {
+			if isError(r) || isReturnValue(r) {
 				return r
 			}
 			if r != nil && r.Type() == object.BREAK {
@@ -425,22 +822,143 @@ func evalForEachStatement(forEach *ast.ForEachStatement, env *object.Env) object
 			}
 		}
 	default:
-		return newError("unsupported iteration type: %s and %d identifiers", collection.Type(), len(forEach.Identifiers))
+		return newError(object.TypeError, "unsupported iteration type: %s and %d identifiers", collection.Type(), len(forEach.Identifiers))
 	}
 
 	return nil
 }
 
+func evalWhileStatement(while *ast.WhileStatement, env *object.Env) object.Object {
+	for {
+		cond := Eval(while.Condition, env)
+		if isError(cond) {
+			return cond
+		}
+		if !isTruthy(cond) {
+			return nil
+		}
+
+		if r, done := evalLoopBody(while.Body, env); done {
+			return r
+		}
+	}
+}
+
+func evalForStatement(forStmt *ast.ForStatement, env *object.Env) object.Object {
+	// Variables defined by the init clause are only visible inside the loop,
+	// and are shared by all of its iterations.
+	loopEnv := object.NewScopedEnv(env)
+
+	if forStmt.Init != nil {
+		init := Eval(forStmt.Init, loopEnv)
+		if isError(init) {
+			return init
+		}
+	}
+
+	for {
+		if forStmt.Condition != nil {
+			cond := Eval(forStmt.Condition, loopEnv)
+			if isError(cond) {
+				return cond
+			}
+			if !isTruthy(cond) {
+				return nil
+			}
+		}
+
+		if r, done := evalLoopBody(forStmt.Body, loopEnv); done {
+			return r
+		}
+
+		if forStmt.Step != nil {
+			step := Eval(forStmt.Step, loopEnv)
+			if isError(step) {
+				return step
+			}
+		}
+	}
+}
+
+// evalLoopBody runs a single iteration of a loop body in a scope of its own.
+// It reports whether the loop is done, i.e whether the body used break,
+// returned or failed, along with the error or return value to propagate.
+func evalLoopBody(body *ast.BlockStatement, env *object.Env) (object.Object, bool) {
+	newEnv := object.NewScopedEnv(env)
+	newEnv.SetExecutionContext(object.ExecutionContextLoop)
+
+	r := evalBlockStatement(body, newEnv)
+	if isError(r) || isReturnValue(r) {
+		return r, true
+	}
+	if r != nil && r.Type() == object.BREAK {
+		return nil, true
+	}
+
+	return nil, false
+}
+
 func evalBreakStatement(breakStmt *ast.BreakStatement, env *object.Env) object.Object {
 	// Check the context we're in - we should only accept break when we're in
 	// a loop.
 	if env.GetExecutionContext() != object.ExecutionContextLoop {
-		return newError("break cannot be used outside a loop context")
+		return newError(object.RuntimeError, "break cannot be used outside a loop context")
 	}
 
 	return BREAK
 }
 
+func evalContinueStatement(continueStmt *ast.ContinueStatement, env *object.Env) object.Object {
+	if env.GetExecutionContext() != object.ExecutionContextLoop {
+		return newError(object.RuntimeError, "continue cannot be used outside a loop context")
+	}
+
+	return CONTINUE
+}
+
+// evalTryStatement runs the body of a try statement, handing an error raised
+// by it to the catch block. The finally block runs however the statement is
+// left, and if it fails, returns or breaks out of a loop itself, that takes
+// precedence over the outcome of the body and catch blocks.
+func evalTryStatement(try *ast.TryStatement, env *object.Env) object.Object {
+	result := evalBlockStatement(try.Body, env)
+
+	// exit ends programs at once, without running finally blocks.
+	if err, ok := result.(*object.Error); ok && err.Kind == object.ExitError {
+		return err
+	}
+	// Programs can't catch errors raised for exceeding their limits, so
+	// that they can't keep running regardless.
+	if err, ok := result.(*object.Error); ok && try.Catch != nil && err.Catchable() {
+		// The caught error is only visible inside the catch block.
+		catchEnv := object.NewScopedEnv(env)
+		catchEnv.SetExecutionContext(env.GetExecutionContext())
+		catchEnv.Set(try.CatchParam.Value, err.Caught())
+		result = evalBlockStatement(try.Catch, catchEnv)
+	}
+
+	if try.Finally != nil {
+		if r := evalBlockStatement(try.Finally, env); isError(r) || isReturnValue(r) || isLoopControl(r) {
+			return r
+		}
+	}
+
+	if isError(result) || isReturnValue(result) || isLoopControl(result) {
+		return result
+	}
+	return nil
+}
+
+// isLoopControl reports whether o is the result of a break or continue
+// statement, e.g one nested in an if expression, that has to be passed on to
+// the enclosing loop.
+func isLoopControl(o object.Object) bool {
+	if o == nil {
+		return false
+	}
+	return o.Type() == object.BREAK || o.Type() == object.CONTINUE
+}
+
 func unwrapReturnValue(obj object.Object) object.Object {
 	if rValue, ok := obj.(*object.ReturnValue); ok {
 		return rValue.Value
@@ -461,14 +979,19 @@ func evalBangOperator(right object.Object) *object.Boolean {
 	}
 }
 
-func evalNegativeOperator(right object.Object) object.Object {
+func evalNegativeOperator(right object.Object, checked bool) object.Object {
 	switch e := right.(type) {
 	case *object.Integer:
+		if checked && e.Value == math.MinInt64 {
+			return newError(object.ArithmeticError, "integer overflow: -(%d)", e.Value)
+		}
 		return &object.Integer{
 			Value: e.Value * -1,
 		}
+	case *object.Float:
+		return &object.Float{Value: -e.Value}
 	default:
-		return newError("unknown operator: -%s", right.Type())
+		return newError(object.TypeError, "unknown operator: -%s", right.Type())
 	}
 }
 
@@ -500,8 +1023,9 @@ func isTruthy(o object.Object) bool {
 	}
 }
 
-func newError(message string, format ...interface{}) *object.Error {
+func newError(kind object.ErrorKind, message string, format ...interface{}) *object.Error {
 	return &object.Error{
+		Kind:    kind,
 		Message: fmt.Sprintf(message, format...),
 	}
 }
@@ -513,6 +1037,18 @@ func isError(o object.Object) bool {
 	return false
 }
 
+func isReturnValue(o object.Object) bool {
+	if o != nil {
+		return o.Type() == object.RETURN_VALUE
+	}
+	return false
+}
+
+func isNumber(o object.Object) bool {
+	_, ok := object.ToFloat(o)
+	return ok
+}
+
 func isHashable(o object.Object) (object.Hashable, bool) {
 	hb, ok := o.(object.Hashable)
 	return hb, ok
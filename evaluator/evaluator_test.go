@@ -1,15 +1,24 @@
 package evaluator_test
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/makramkd/go-monkey/evaluator"
+	"github.com/makramkd/go-monkey/evaluator/stdlib"
 	"github.com/makramkd/go-monkey/lexer"
 	"github.com/makramkd/go-monkey/object"
 	"github.com/makramkd/go-monkey/parser"
+	"github.com/makramkd/go-monkey/token"
 	"github.com/stretchr/testify/assert"
 )
 
+// at returns the position of the given byte offset in single-line input.
+func at(offset int) token.Position {
+	return token.Position{Offset: offset, Line: 1, Column: offset + 1}
+}
+
 func TestEvalIntegerLiteral(t *testing.T) {
 	testCases := []struct {
 		input    string
@@ -39,6 +48,35 @@ func TestEvalIntegerLiteral(t *testing.T) {
 	}
 }
 
+func TestEvalFloatLiteral(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected float64
+		inspect  string
+	}{
+		{"2.5", 2.5, "2.5"},
+		{"-2.5", -2.5, "-2.5"},
+		{"1.5 + 1.5", 3, "3.0"},
+		{"1 + 0.5", 1.5, "1.5"},
+		{"0.5 * 4", 2, "2.0"},
+		{"1 / 8.0", 0.125, "0.125"},
+		{"2 ** -2", 0.25, "0.25"},
+		{"1e21 * 10", 1e22, "1e+22"},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.New(testCase.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		env := object.NewEnv()
+		val := evaluator.Eval(program, env)
+		if assert.IsType(t, &object.Float{}, val, testCase.input) {
+			assert.Equal(t, testCase.expected, val.(*object.Float).Value)
+			assert.Equal(t, testCase.inspect, val.Inspect())
+		}
+	}
+}
+
 func TestEvalBooleanLiteral(t *testing.T) {
 	testCases := []struct {
 		input    string
@@ -146,13 +184,15 @@ func TestErrorHandling(t *testing.T) {
 		input    string
 		expected *object.Error
 	}{
-		{"5 + true;", &object.Error{Message: "type mismatch: INTEGER + BOOLEAN"}},
-		{"-true;", &object.Error{Message: "unknown operator: -BOOLEAN"}},
-		{"true + false", &object.Error{Message: "unknown operator: BOOLEAN + BOOLEAN"}},
-		{"if (10 > 1) { if ( 10 > 2 ) { return false + true; } return 42; }", &object.Error{Message: "unknown operator: BOOLEAN + BOOLEAN"}},
-		{"if (true + false == 1) { return 42; }", &object.Error{Message: "unknown operator: BOOLEAN + BOOLEAN"}},
-		{"if (true == false * 1) { return 42; }", &object.Error{Message: "type mismatch: BOOLEAN * INTEGER"}},
-		{"foobar", &object.Error{Message: "identifier not found: foobar"}},
+		{"5 + true;", &object.Error{Kind: object.TypeError, Message: "type mismatch: INTEGER + BOOLEAN", Pos: at(0)}},
+		{"-true;", &object.Error{Kind: object.TypeError, Message: "unknown operator: -BOOLEAN", Pos: at(0)}},
+		{"true + false", &object.Error{Kind: object.TypeError, Message: "unknown operator: BOOLEAN + BOOLEAN", Pos: at(0)}},
+		{"if (10 > 1) { if ( 10 > 2 ) { return false + true; } return 42; }", &object.Error{Kind: object.TypeError, Message: "unknown operator: BOOLEAN + BOOLEAN", Pos: at(37)}},
+		{"if (true + false == 1) { return 42; }", &object.Error{Kind: object.TypeError, Message: "unknown operator: BOOLEAN + BOOLEAN", Pos: at(4)}},
+		{"if (true == false * 1) { return 42; }", &object.Error{Kind: object.TypeError, Message: "type mismatch: BOOLEAN * INTEGER", Pos: at(12)}},
+		{"foobar", &object.Error{Kind: object.NameError, Message: "identifier not found: foobar", Pos: at(0)}},
+		{"10 / (5 - 5)", &object.Error{Kind: object.ArithmeticError, Message: "division by zero", Pos: at(0)}},
+		{"10 % 0", &object.Error{Kind: object.ArithmeticError, Message: "modulo by zero", Pos: at(0)}},
 	}
 
 	for _, testCase := range testCases {
@@ -186,6 +226,129 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestAssignExpressions(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected object.Object
+	}{
+		{"let a = 5; a = 10; a;", &object.Integer{Value: 10}},
+		{"let a = 5; a = 10;", &object.Integer{Value: 10}},
+		{"let a = 1; let b = 2; a = b = 3; a + b;", &object.Integer{Value: 6}},
+		{"let a = 5; a += 2; a;", &object.Integer{Value: 7}},
+		{"let a = 5; a -= 2; a;", &object.Integer{Value: 3}},
+		{"let a = 5; a *= 2; a;", &object.Integer{Value: 10}},
+		{"let a = 5; a /= 2; a;", &object.Integer{Value: 2}},
+		{"let a = 5; a %= 2; a;", &object.Integer{Value: 1}},
+		{`let a = "foo"; a += "bar"; a;`, &object.String{Value: "foobar"}},
+		{"let a = 5; ++a;", &object.Integer{Value: 6}},
+		{"let a = 5; --a;", &object.Integer{Value: 4}},
+		{"let a = 5; a++;", &object.Integer{Value: 5}},
+		{"let a = 5; a++; a;", &object.Integer{Value: 6}},
+		{"let a = 5; a--; a;", &object.Integer{Value: 4}},
+		{"let a = 1; let f = fn() { a = a + 1; }; f(); f(); a;", &object.Integer{Value: 3}},
+		{"let a = 1; let f = fn() { let a = 10; a = a + 1; }; f(); a;", &object.Integer{Value: 1}},
+		{"b = 1;", &object.Error{Kind: object.NameError, Message: "identifier not found: b", Pos: at(0)}},
+		{"b++;", &object.Error{Kind: object.NameError, Message: "identifier not found: b", Pos: at(0)}},
+		{"++5;", &object.Error{Kind: object.RuntimeError, Message: "cannot assign to 5", Pos: at(0)}},
+		{`let a = "foo"; a -= 1;`, &object.Error{Kind: object.TypeError, Message: "type mismatch: STRING - INTEGER", Pos: at(15)}},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.New(testCase.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		assert.Empty(t, p.Errors())
+		env := object.NewEnv()
+		val := evaluator.Eval(program, env)
+		assert.Equal(t, testCase.expected, val, testCase.input)
+	}
+}
+
+func TestIndexAssignment(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected object.Object
+	}{
+		{"let a = [1, 2, 3]; a[1] = 5; a[1];", &object.Integer{Value: 5}},
+		{"let a = [1, 2, 3]; a[1] = 5;", &object.Integer{Value: 5}},
+		{"let a = [1, 2, 3]; let b = a; b[0] = 7; a[0];", &object.Integer{Value: 7}},
+		{"let a = [1, 2, 3]; a[2] *= 10; a[2];", &object.Integer{Value: 30}},
+		{"let a = [[1], [2]]; a[1][0] = 9; a[1][0];", &object.Integer{Value: 9}},
+		{"let a = [1]; a[0]++;", &object.Integer{Value: 1}},
+		{"let a = [1]; ++a[0];", &object.Integer{Value: 2}},
+		{`let h = {"a": 1}; h["a"] = 2; h["a"];`, &object.Integer{Value: 2}},
+		{`let h = {}; h["b"] = 3; h["b"];`, &object.Integer{Value: 3}},
+		{`let h = {"a": {"b": 1}}; h["a"]["b"] += 1; h["a"]["b"];`, &object.Integer{Value: 2}},
+		{"let a = [1]; a[1] = 2;", &object.Error{Kind: object.IndexError, Message: "out of bounds error: index 1 is out of range for array", Pos: at(13)}},
+		{"let a = [1]; a[-2] = 2;", &object.Error{Kind: object.IndexError, Message: "out of bounds error: index -2 is out of range for array", Pos: at(13)}},
+		{"let h = {}; h[[1]] = 2;", &object.Error{Kind: object.TypeError, Message: "unusable as hash key: [1]", Pos: at(12)}},
+		{"let s = 1; s[0] = 2;", &object.Error{Kind: object.TypeError, Message: "index operator not supported: INTEGER", Pos: at(11)}},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.New(testCase.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		assert.Empty(t, p.Errors())
+		env := object.NewEnv()
+		val := evaluator.Eval(program, env)
+		assert.Equal(t, testCase.expected, val, testCase.input)
+	}
+}
+
+func TestLoops(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected object.Object
+	}{
+		{"let i = 0; while (i < 10) { i++; } i;", &object.Integer{Value: 10}},
+		{"let i = 0; while (i < 10) { i++; if (i == 5) { break; } } i;", &object.Integer{Value: 5}},
+		{"let sum = 0; for (let i = 0; i < 5; i++) { sum += i; } sum;", &object.Integer{Value: 10}},
+		{"let sum = 0; for (let i = 0; i < 5; i++) { if (i % 2 == 0) { continue; } sum += i; } sum;", &object.Integer{Value: 4}},
+		{"let n = 0; for (;;) { n++; if (n > 2) { if (true) { break; } } } n;", &object.Integer{Value: 3}},
+		{"let n = 0; for x in [1, 2, 3] { if (x == 2) { continue; } n += x; } n;", &object.Integer{Value: 4}},
+		{"let f = fn() { let i = 0; while (true) { i++; if (i == 3) { return i * 10; } } }; f();", &object.Integer{Value: 30}},
+		{"for (let i = 0; i < 3; i++) { } i;", &object.Error{Kind: object.NameError, Message: "identifier not found: i", Pos: at(32)}},
+		{"while (true) { fn() { continue; }(); }", &object.Error{Kind: object.RuntimeError, Message: "continue cannot be used outside a loop context", Pos: at(22), Stack: []object.Frame{{Pos: at(15)}}}},
+		{"continue;", &object.Error{Kind: object.RuntimeError, Message: "continue cannot be used outside a loop context", Pos: at(0)}},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.New(testCase.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		assert.Empty(t, p.Errors())
+		env := object.NewEnv()
+		val := evaluator.Eval(program, env)
+		assert.Equal(t, testCase.expected, val, testCase.input)
+	}
+}
+
+func TestThrowStatements(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected object.Object
+	}{
+		{`throw "bad";`, &object.Error{Kind: object.GenericError, Message: "bad", Pos: at(0), Value: &object.String{Value: "bad"}}},
+		{`let e = {"kind": "ValueError"}; throw e;`, &object.Error{Kind: object.ValueError, Message: "{kind:ValueError}", Pos: at(32), Value: &object.Hash{Pairs: map[object.HashKey]object.HashPair{
+			(&object.String{Value: "kind"}).HashKey(): {Key: &object.String{Value: "kind"}, Value: &object.String{Value: "ValueError"}},
+		}}}},
+		{`try { throw 1; } catch (e) { e["value"] }`, nil},
+		{`let r = 0; try { throw 1; } catch (e) { r = e["value"]; } r;`, &object.Integer{Value: 1}},
+		{`let r = 0; try { 1 / 0; } catch (e) { r = e["value"]; } r;`, evaluator.NULL},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.New(testCase.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		assert.Empty(t, p.Errors())
+		env := object.NewEnv()
+		val := evaluator.Eval(program, env)
+		assert.Equal(t, testCase.expected, val, testCase.input)
+	}
+}
+
 func TestFunctionObject(t *testing.T) {
 	testCases := []struct {
 		input    string
@@ -247,8 +410,8 @@ func TestBuiltinFunctions(t *testing.T) {
 	}{
 		{`len("")`, &object.Integer{Value: 0}},
 		{`len("hello")`, &object.Integer{Value: 5}},
-		{`len(1)`, &object.Error{Message: "argument to 'len' not supported, got INTEGER"}},
-		{`len("one", "two")`, &object.Error{Message: "wrong number of arguments. got=2, want=1"}},
+		{`len(1)`, &object.Error{Kind: object.TypeError, Message: "argument to 'len' not supported, got INTEGER", Pos: at(0)}},
+		{`len("one", "two")`, &object.Error{Kind: object.ArgumentError, Message: "wrong number of arguments. got=2, want=1", Pos: at(0)}},
 	}
 
 	for _, testCase := range testCases {
@@ -262,6 +425,87 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+func TestCheckedArithmetic(t *testing.T) {
+	testCases := []struct {
+		input    string
+		checked  bool
+		expected object.Object
+	}{
+		{"9223372036854775807 + 1", false, &object.Integer{Value: -9223372036854775808}},
+		{"9223372036854775807 + 1", true, &object.Error{Kind: object.ArithmeticError, Message: "integer overflow: 9223372036854775807 + 1", Pos: at(0)}},
+		{"let f = fn() { 2 ** 63 }; f();", true, &object.Error{Kind: object.ArithmeticError, Message: "integer overflow: 2 ** 63", Pos: at(15), Stack: []object.Frame{{Function: "f", Pos: at(26)}}}},
+		{"let x = 2; fn() { x * 3 }();", true, &object.Integer{Value: 6}},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.New(testCase.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		assert.Empty(t, p.Errors())
+		env := object.NewEnv()
+		env.SetCheckedArithmetic(testCase.checked)
+		val := evaluator.Eval(program, env)
+		assert.Equal(t, testCase.expected, val, testCase.input)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	testCases := []struct {
+		input    string
+		limits   object.Limits
+		expected string
+	}{
+		{"while (true) {}", object.Limits{MaxSteps: 100}, "maximum number of steps exceeded: 100"},
+		{"let r = 0; try { while (true) {} } catch (e) { r = 1; } r;", object.Limits{MaxSteps: 100}, "maximum number of steps exceeded: 100"},
+		{"let f = fn(n) { 1 + f(n + 1) }; f(0);", object.Limits{MaxCallDepth: 10}, "maximum call depth exceeded: 10"},
+		{`let s = "ab"; while (true) { s = s + s; }`, object.Limits{MaxStringLength: 8}, "maximum string length exceeded: 8"},
+		{"[1, 2, 3, 4]", object.Limits{MaxArrayLength: 3}, "maximum array length exceeded: 3"},
+		{"push([1, 2, 3], 4)", object.Limits{MaxArrayLength: 3}, "maximum array length exceeded: 3"},
+		{"{1: 1, 2: 2, 3: 3}", object.Limits{MaxHashSize: 2}, "maximum hash size exceeded: 2"},
+		{`let h = {}; h["a"] = 1; h["b"] = 2; h["c"] = 3;`, object.Limits{MaxHashSize: 2}, "maximum hash size exceeded: 2"},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.New(testCase.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		assert.Empty(t, p.Errors())
+		env := object.NewEnv()
+		env.SetLimits(testCase.limits)
+		val := evaluator.Eval(program, env)
+		if assert.IsType(t, &object.Error{}, val, testCase.input) {
+			assert.Equal(t, object.LimitError, val.(*object.Error).Kind, testCase.input)
+			assert.Equal(t, testCase.expected, val.(*object.Error).Message, testCase.input)
+		}
+	}
+
+	// Programs within their limits aren't affected.
+	env := object.NewEnv()
+	env.SetLimits(object.Limits{MaxCallDepth: 10, MaxArrayLength: 3, MaxHashSize: 2})
+	l := lexer.New(`let f = fn(n) { if (n == 0) { [1, 2, 3] } else { f(n - 1) } }; let h = {"a": 1}; h["b"] = f(9); h["a"] = 2; h["b"]`)
+	val := evaluator.Eval(parser.New(l).ParseProgram(), env)
+	assert.Equal(t, &object.Array{Values: []object.Object{&object.Integer{Value: 1}, &object.Integer{Value: 2}, &object.Integer{Value: 3}}}, val)
+}
+
+func TestEvalContext(t *testing.T) {
+	program := parser.New(lexer.New("while (true) {}")).ParseProgram()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	val := evaluator.EvalContext(ctx, program, object.NewEnv())
+	if assert.IsType(t, &object.Error{}, val) {
+		assert.Equal(t, object.LimitError, val.(*object.Error).Kind)
+		assert.Equal(t, "evaluation stopped: context canceled", val.(*object.Error).Message)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	val = evaluator.EvalContext(ctx, program, object.NewEnv())
+	if assert.IsType(t, &object.Error{}, val) {
+		assert.Equal(t, "evaluation stopped: context deadline exceeded", val.(*object.Error).Message)
+	}
+}
+
 func TestArrayAccess(t *testing.T) {
 	testCases := []struct {
 		input    string
@@ -270,6 +514,9 @@ func TestArrayAccess(t *testing.T) {
 		{`let a = [1, 2, 3, 4]; a[0];`, &object.Integer{Value: 1}},
 		{`let a = [true, false, "hello"]; a[0];`, &object.Boolean{Value: true}},
 		{`let a = [true, false, "hello"]; a[2];`, &object.String{Value: "hello"}},
+		{`let a = [1, 2, 3, 4]; a[-1];`, &object.Integer{Value: 4}},
+		{`let a = [1, 2, 3, 4]; a[-4];`, &object.Integer{Value: 1}},
+		{`let a = [1, 2, 3, 4]; a[-5];`, &object.Error{Kind: object.IndexError, Message: "out of bounds error: index -5 is out of range for array", Pos: at(22)}},
 	}
 
 	for _, testCase := range testCases {
@@ -282,3 +529,99 @@ func TestArrayAccess(t *testing.T) {
 		assert.Equal(t, testCase.expected, val)
 	}
 }
+
+func TestErrorPositions(t *testing.T) {
+	input := `let add = fn(a, b) {
+	a + b
+};
+add(1, "two");`
+
+	l := lexer.NewWithFilename("script.monkey", input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	assert.Empty(t, p.Errors())
+	env := object.NewEnv()
+	val := evaluator.Eval(program, env)
+	assert.IsType(t, &object.Error{}, val)
+	assert.Equal(t, "ERROR: script.monkey:2:2: type mismatch: INTEGER + STRING", val.Inspect())
+}
+
+func TestTraceback(t *testing.T) {
+	input := `let count = fn(n) {
+	if (n == 0) { n + true } else { count(n - 1) }
+};
+let start = fn() { count(3) };
+start();`
+
+	l := lexer.NewWithFilename("script.monkey", input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	assert.Empty(t, p.Errors())
+	env := object.NewEnv()
+	val := evaluator.Eval(program, env)
+	if assert.IsType(t, &object.Error{}, val) {
+		assert.Equal(t, `Traceback (most recent call last):
+  script.monkey:5:1: in <main>
+  script.monkey:4:20: in start
+  script.monkey:2:34: in count
+  [previous line repeated 2 more times]
+  script.monkey:2:16: in count
+`, val.(*object.Error).Traceback())
+	}
+	assert.Equal(t, 0, env.CallStack().Depth())
+
+	val = evaluator.Eval(parser.New(lexer.New("1 + true")).ParseProgram(), env)
+	if assert.IsType(t, &object.Error{}, val) {
+		assert.Empty(t, val.(*object.Error).Traceback())
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"let count = fn(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } }; count(200000, 0);", "200000"},
+		{`let f = fn(n) { if (n == 0) { return "done"; } return f(n - 1); }; f(200000);`, "done"},
+		{"let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; even(100001);", "false"},
+		{"let f = fn(n) { let m = n - 1; if (m < 0) { len([]) } else { f(m) } }; f(100000);", "0"},
+		{`let f = fn(n) { let r = ""; try { if (n == 0) { throw "done"; } return f(n - 1); } catch (e) { r = e["message"]; } r }; f(10);`, "done"},
+		// Returns inside try statements aren't tail calls, as finally blocks run after them.
+		{"let log = []; let f = fn(n) { try { if (n == 0) { return 0; } return f(n - 1); } finally { log = push(log, n); } }; f(2); log;", "[0,1,2]"},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.New(testCase.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		assert.Empty(t, p.Errors())
+		env := object.NewEnv()
+		val := evaluator.Eval(program, env)
+		assert.Equal(t, testCase.expected, val.Inspect(), testCase.input)
+		assert.Equal(t, 0, env.CallStack().Depth(), testCase.input)
+	}
+
+	// Tail calls keep their frames for tracebacks.
+	input := "let f = fn(n) { if (n == 0) { 1 + true } else { f(n - 1) } };\nf(100000);"
+	val := evaluator.Eval(parser.New(lexer.New(input)).ParseProgram(), object.NewEnv())
+	if assert.IsType(t, &object.Error{}, val) {
+		assert.Len(t, val.(*object.Error).Stack, 100001)
+		assert.Equal(t, `Traceback (most recent call last):
+  2:1: in <main>
+  1:49: in f
+  [previous line repeated 99999 more times]
+  1:31: in f
+`, val.(*object.Error).Traceback())
+	}
+}
+
+func TestStdlibOnLargeArrays(t *testing.T) {
+	env := object.NewEnv()
+	env.SetModuleLoader(stdlib.NewDirLoader("stdlib"))
+	l := lexer.New(`import functools;
+let a = [];
+for (let i = 0; i < 100000; i++) { a = push(a, i); }
+[len(map(a, fn(x) { x * 2 })), sum(a), len(filter(a, fn(x) { x % 2 == 0 }))];`)
+	val := evaluator.Eval(parser.New(l).ParseProgram(), env)
+	assert.Equal(t, "[100000,4999950000,50000]", val.Inspect())
+}
@@ -0,0 +1,116 @@
+package evaluator
+
+import (
+	"github.com/makramkd/go-monkey/ast"
+	"github.com/makramkd/go-monkey/evaluator/stdlib"
+	"github.com/makramkd/go-monkey/object"
+)
+
+// evalImportStatement imports a module and binds it in env: the listed
+// definitions if there are any, else the module to its alias if it has one,
+// else files to their name and standard modules by copying their exported
+// definitions into env.
+func evalImportStatement(node *ast.ImportStatement, env *object.Env) *object.Error {
+	module, err := importModule(node, env)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case node.Names != nil:
+		for _, name := range node.Names {
+			value, ok := module.Member(name.Value)
+			if !ok || !object.Exported(name.Value) {
+				return newError(object.ImportError, "cannot import %s from module %s", name.Value, module.Name)
+			}
+			env.Set(name.Value, value)
+		}
+	case node.Alias != nil:
+		env.Set(node.Alias.Value, module)
+	case node.Path != nil:
+		env.Set(module.Name, module)
+	default:
+		for _, name := range module.Env.Names() {
+			if object.Exported(name) {
+				value, _ := module.Member(name)
+				env.Set(name, value)
+			}
+		}
+	}
+	return nil
+}
+
+// importModule returns the module imported by node, evaluating it in an
+// environment of its own the first time it is imported.
+func importModule(node *ast.ImportStatement, env *object.Env) (*object.Module, *object.Error) {
+	imported, err := stdlib.ResolveImport(node)
+	if err != nil {
+		return nil, newError(object.ImportError, "%s", err)
+	}
+
+	if module, ok := env.ImportedModule(imported.Key); ok {
+		return module, nil
+	}
+
+	if err := env.StartImport(imported.Key); err != nil {
+		return nil, err
+	}
+	module, errObj := evalModule(imported, node, env)
+	env.FinishImport(imported.Key, module)
+	return module, errObj
+}
+
+// evalModule loads and evaluates a module, which is shown in tracebacks as if
+// it were a function called by the import statement.
+func evalModule(imported stdlib.Module, node *ast.ImportStatement, env *object.Env) (*object.Module, *object.Error) {
+	load := stdlib.Load
+	if loader := env.ModuleLoader(); loader != nil {
+		load = loader.Load
+	}
+	program, err := imported.Load(load)
+	if err != nil {
+		return nil, newError(object.ImportError, "%s", err)
+	}
+
+	module := &object.Module{Name: imported.Name, Env: object.NewModuleEnv(env)}
+
+	stack := env.CallStack()
+	stack.Push(object.Frame{Function: "<module " + module.Name + ">", Pos: node.Pos()})
+	defer stack.Pop()
+
+	if result := Eval(program, module.Env); isError(result) {
+		return nil, result.(*object.Error)
+	}
+	return module, nil
+}
+
+// evalMemberExpression evaluates an access to a member of a module. Modules
+// are only accessed through the names they're bound to, as in the VM, where
+// members are resolved at compile time.
+func evalMemberExpression(node *ast.MemberExpression, env *object.Env) object.Object {
+	ident, ok := node.Left.(*ast.Identifier)
+	if !ok {
+		return newError(object.TypeError, "%s is not a module", node.Left.String())
+	}
+
+	left, ok := env.Get(ident.Value)
+	if _, builtin := builtins[ident.Value]; !ok && !builtin {
+		return newError(object.NameError, "identifier not found: %s", ident.Value)
+	}
+	module, ok := left.(*object.Module)
+	if !ok {
+		return newError(object.TypeError, "%s is not a module", ident.Value)
+	}
+
+	if !object.Exported(node.Member.Value) {
+		return newError(object.NameError, "cannot access private member %s of module %s", node.Member.Value, module.Name)
+	}
+	value, ok := module.Member(node.Member.Value)
+	if !ok {
+		return newError(object.NameError, "module %s has no member %s", module.Name, node.Member.Value)
+	}
+	if _, ok := value.(*object.Module); ok {
+		return newError(object.TypeError, "cannot use module %s.%s as a value", ident.Value, node.Member.Value)
+	}
+	return value
+}
@@ -0,0 +1,218 @@
+// Package stdlib loads the modules imported by Monkey programs: those of the
+// standard library, imported by name, and files, imported by path. It is
+// shared by every execution engine.
+package stdlib
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/makramkd/go-monkey/ast"
+	"github.com/makramkd/go-monkey/lexer"
+	"github.com/makramkd/go-monkey/parser"
+	"github.com/makramkd/go-monkey/token"
+)
+
+//go:embed *.monkey
+var embedded embed.FS
+
+// FS holds the modules of the standard library, which are embedded in the
+// binary.
+var FS fs.FS = embedded
+
+// MonkeyPathEnv is the environment variable holding a list of directories
+// that standard modules are looked up in, separated like PATH.
+const MonkeyPathEnv = "MONKEYPATH"
+
+// Loader loads standard modules from a list of file systems, in which the
+// module called name is stored in the file name.monkey. Modules are looked up
+// in each file system in turn, and parsed once.
+type Loader struct {
+	sources []source
+
+	mu    sync.Mutex
+	cache map[string]*ast.Program
+}
+
+type source struct {
+	fsys fs.FS
+	// dir is the directory the file system was opened from, if any, used to
+	// report positions in modules by their path.
+	dir string
+}
+
+// NewLoader returns a loader of the modules in the given file systems.
+func NewLoader(fsyss ...fs.FS) *Loader {
+	l := &Loader{cache: map[string]*ast.Program{}}
+	for _, fsys := range fsyss {
+		l.sources = append(l.sources, source{fsys: fsys})
+	}
+	return l
+}
+
+// NewDirLoader returns a loader of the modules in the given directories.
+func NewDirLoader(dirs ...string) *Loader {
+	l := NewLoader()
+	l.addDirs(dirs)
+	return l
+}
+
+// NewDefaultLoader returns a loader of the modules of the embedded standard
+// library, then of those in the given directories and finally of those in
+// the directories listed in the MONKEYPATH environment variable.
+func NewDefaultLoader(dirs ...string) *Loader {
+	l := NewLoader()
+	l.sources = append(l.sources, source{fsys: FS, dir: "<stdlib>"})
+	l.addDirs(dirs)
+	l.addDirs(filepath.SplitList(os.Getenv(MonkeyPathEnv)))
+	return l
+}
+
+func (l *Loader) addDirs(dirs []string) {
+	for _, dir := range dirs {
+		if dir != "" {
+			l.sources = append(l.sources, source{fsys: os.DirFS(dir), dir: dir})
+		}
+	}
+}
+
+var defaultLoader = NewDefaultLoader()
+
+// SetPath sets the directories in which standard modules are looked up by
+// Load, after the embedded standard library.
+func SetPath(dirs ...string) {
+	defaultLoader = NewDefaultLoader(dirs...)
+}
+
+// Load reads and parses the standard module with the given name, as found
+// by the loader returned by NewDefaultLoader with the directories set with
+// SetPath.
+func Load(name string) (*ast.Program, error) {
+	return defaultLoader.Load(name)
+}
+
+// Load reads and parses the standard module with the given name, from the
+// first file system that has it.
+func (l *Loader) Load(name string) (*ast.Program, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if program, ok := l.cache[name]; ok {
+		return program, nil
+	}
+
+	filename := name + ".monkey"
+	for _, src := range l.sources {
+		b, err := fs.ReadFile(src.fsys, filename)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("internal error: failed to read standard module '%s': %v", name, err)
+		}
+
+		if src.dir != "" {
+			filename = path.Join(src.dir, filename)
+		}
+		program, err := parse(filename, string(b))
+		if err != nil {
+			return nil, err
+		}
+		l.cache[name] = program
+		return program, nil
+	}
+
+	return nil, fmt.Errorf("standard module does not exist: %s. Was the Monkey stdlib path specified correctly?", name)
+}
+
+// ResolvePath returns the name of the file imported by path p from the file
+// from. Relative paths are resolved from the directory of from, or from the
+// working directory for programs that aren't read from a file. The .monkey
+// extension may be left out of p.
+func ResolvePath(from, p string) string {
+	if !strings.HasSuffix(p, ".monkey") {
+		p += ".monkey"
+	}
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(filepath.Dir(from), p)
+	}
+	return filepath.Clean(p)
+}
+
+// moduleName returns the name that the module in the named file is bound to
+// when imported without an alias: the name of the file without its extension.
+// It reports false if that isn't a valid identifier.
+func moduleName(filename string) (string, bool) {
+	name := strings.TrimSuffix(filepath.Base(filename), ".monkey")
+
+	lx := lexer.New(name)
+	tok := lx.NextToken()
+	return name, tok.T == token.IDENT && tok.Literal == name && lx.NextToken().T == token.EOF
+}
+
+// LoadFile reads and parses the module in the named file.
+func LoadFile(filename string) (*ast.Program, error) {
+	b, err := ioutil.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("module does not exist: %s", filename)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read module %s: %v", filename, err)
+	}
+
+	return parse(filename, string(b))
+}
+
+// parse parses the module in the named file, reporting all syntax errors.
+func parse(filename, src string) (*ast.Program, error) {
+	p := parser.New(lexer.NewWithFilename(filename, src))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		messages := make([]string, len(p.Errors()))
+		for i, err := range p.Errors() {
+			messages[i] = err.Error()
+		}
+		return nil, errors.New(strings.Join(messages, "\n"))
+	}
+	return program, nil
+}
+
+// Module is a module imported by an import statement.
+type Module struct {
+	// Key identifies the module, so that importing it again yields the same
+	// module: it is the name of standard modules and the file name of files.
+	Key string
+	// Name is the name the module is bound to when imported without an
+	// alias.
+	Name string
+	// Filename is the file the module is read from, if imported by path.
+	Filename string
+}
+
+// ResolveImport returns the module imported by node.
+func ResolveImport(node *ast.ImportStatement) (Module, error) {
+	if node.Path == nil {
+		return Module{Key: node.Module.Value, Name: node.Module.Value}, nil
+	}
+
+	filename := ResolvePath(node.Pos().Filename, node.Path.Value)
+	name, ok := moduleName(filename)
+	if !ok && node.Alias == nil {
+		return Module{}, fmt.Errorf("module name %s is not an identifier, import it with 'as' instead", name)
+	}
+	return Module{Key: filename, Name: name, Filename: filename}, nil
+}
+
+// Load reads and parses the module, using load for standard modules.
+func (m Module) Load(load func(name string) (*ast.Program, error)) (*ast.Program, error) {
+	if m.Filename != "" {
+		return LoadFile(m.Filename)
+	}
+	return load(m.Name)
+}
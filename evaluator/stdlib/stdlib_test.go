@@ -0,0 +1,76 @@
+package stdlib_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/makramkd/go-monkey/evaluator/stdlib"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeModule(t *testing.T, dir, name, src string) {
+	t.Helper()
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+".monkey"), []byte(src), 0o644))
+}
+
+func TestDefaultLoader(t *testing.T) {
+	userDir, envDir := t.TempDir(), t.TempDir()
+	writeModule(t, userDir, "shapes", "let square = fn(x) { x * x };")
+	writeModule(t, userDir, "colors", "let red = 1;")
+	writeModule(t, envDir, "colors", "let red = 2;")
+	writeModule(t, envDir, "sizes", "let small = 1;")
+	// Modules of the embedded standard library can't be shadowed.
+	writeModule(t, userDir, "math", "let shadowed = true;")
+	t.Setenv(stdlib.MonkeyPathEnv, envDir)
+
+	testCases := []struct {
+		name     string
+		expected string
+	}{
+		{"shapes", "let square = fn(x){(x * x)};"},
+		{"colors", "let red = 1;"},
+		{"sizes", "let small = 1;"},
+	}
+
+	l := stdlib.NewDefaultLoader(userDir)
+	for _, testCase := range testCases {
+		program, err := l.Load(testCase.name)
+		if assert.NoError(t, err, testCase.name) {
+			assert.Equal(t, testCase.expected, program.String(), testCase.name)
+		}
+	}
+
+	program, err := l.Load("math")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "<stdlib>/math.monkey", program.Pos().Filename)
+	}
+
+	// Modules are parsed once.
+	again, err := l.Load("math")
+	assert.NoError(t, err)
+	assert.Same(t, program, again)
+
+	_, err = l.Load("missing")
+	assert.EqualError(t, err, "standard module does not exist: missing. Was the Monkey stdlib path specified correctly?")
+}
+
+func TestLoader(t *testing.T) {
+	l := stdlib.NewLoader(
+		fstest.MapFS{"a.monkey": {Data: []byte("let x = 1;")}},
+		fstest.MapFS{"a.monkey": {Data: []byte("let x = 2;")}, "b.monkey": {Data: []byte("let = 2;")}},
+	)
+
+	program, err := l.Load("a")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "let x = 1;", program.String())
+	}
+
+	_, err = l.Load("b")
+	assert.EqualError(t, err, "b.monkey:1:5: expected next token to be 'IDENT', got '=' instead\nb.monkey:1:5: no prefix parse function found for '='")
+
+	// Standard modules are embedded, so they can be loaded from anywhere.
+	_, err = stdlib.NewLoader(stdlib.FS).Load("functools")
+	assert.NoError(t, err)
+}
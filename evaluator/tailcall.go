@@ -0,0 +1,107 @@
+package evaluator
+
+import (
+	"github.com/makramkd/go-monkey/ast"
+	"github.com/makramkd/go-monkey/object"
+	"github.com/makramkd/go-monkey/token"
+)
+
+const tailCallType object.ObjectType = "TAIL_CALL"
+
+// tailCall is a call in tail position, i.e the last thing a function does.
+// It is returned instead of being made, so that the caller of the function
+// can make it in its place without growing the Go stack.
+type tailCall struct {
+	fn   *object.Function
+	args []object.Object
+	pos  token.Position
+}
+
+func (c *tailCall) Type() object.ObjectType { return tailCallType }
+func (c *tailCall) Inspect() string         { return "tail call" }
+
+// evalTail evaluates a node of the body of a function. If tail is set, the
+// value of node is the result of the function, so calls to functions that
+// make up the value are returned as a tailCall. Either way, return
+// statements are in tail position.
+//
+// Only blocks, return statements and if expressions pass on tail position to
+// their children, e.g a return inside a loop or try statement is evaluated
+// as usual.
+func evalTail(root ast.Node, env *object.Env, tail bool) object.Object {
+	if err := env.Step(); err != nil {
+		return located(err, root, env)
+	}
+
+	var obj object.Object
+	switch node := root.(type) {
+	case *ast.BlockStatement:
+		obj = evalTailBlockStatement(node, env, tail)
+	case *ast.ExpressionStatement:
+		obj = evalTail(node.Expression, env, tail)
+	case *ast.ReturnStatement:
+		val := evalTail(node.ReturnValue, env, true)
+		if isError(val) {
+			return val
+		}
+		obj = &object.ReturnValue{Value: val}
+	case *ast.IfExpression:
+		obj = evalTailIfExpression(node, env, tail)
+	case *ast.CallExpression:
+		if tail {
+			obj = evalTailCallExpression(node, env)
+		} else {
+			obj = evalCallExpression(node, env)
+		}
+	default:
+		obj = eval(root, env)
+	}
+
+	return checked(obj, root, env)
+}
+
+func evalTailBlockStatement(block *ast.BlockStatement, env *object.Env, tail bool) object.Object {
+	var result object.Object
+
+	for i, stmt := range block.Statements {
+		result = evalTail(stmt, env, tail && i == len(block.Statements)-1)
+
+		if result != nil {
+			t := result.Type()
+			if t == object.RETURN_VALUE || t == object.ERROR || t == object.BREAK || t == object.CONTINUE {
+				return result
+			}
+		}
+	}
+
+	return result
+}
+
+func evalTailIfExpression(exp *ast.IfExpression, env *object.Env, tail bool) object.Object {
+	condition := Eval(exp.Condition, env)
+	if isError(condition) {
+		return condition
+	}
+
+	if isTruthy(condition) {
+		return evalTail(exp.Consequence, env, tail)
+	} else if exp.Alternative != nil {
+		return evalTail(exp.Alternative, env, tail)
+	} else {
+		return NULL
+	}
+}
+
+// evalTailCallExpression returns calls to functions as a tailCall, and makes
+// any other call, e.g one to a builtin or that fails, right away.
+func evalTailCallExpression(call *ast.CallExpression, env *object.Env) object.Object {
+	fn, args, err := evalCall(call, env)
+	if err != nil {
+		return err
+	}
+
+	if f, ok := fn.(*object.Function); ok && len(args) == len(f.Parameters) {
+		return &tailCall{fn: f, args: args, pos: call.Pos()}
+	}
+	return applyFunction(fn, args, call.Pos(), env)
+}
@@ -0,0 +1,544 @@
+// Package format formats Monkey source code in a canonical style.
+//
+// Blocks are indented by four spaces, with a statement per line, and
+// operators are surrounded by spaces, with only the parentheses that are
+// needed. Blank lines between statements, blocks written on a single line and
+// arrays and hashes written with an element per line are kept as they are, as
+// is a #! line at the start of scripts.
+//
+// Comments are kept on a line of their own before the statement or element
+// they precede, or at the end of the line of the one they follow. Those in
+// the middle of an expression written on a single line are moved after it.
+package format
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	"github.com/makramkd/go-monkey/ast"
+	"github.com/makramkd/go-monkey/lexer"
+	"github.com/makramkd/go-monkey/parser"
+	"github.com/makramkd/go-monkey/token"
+)
+
+// indent is the indentation of each level of blocks.
+const indent = "    "
+
+// Source formats the program src, which is named filename in errors. It
+// returns the syntax errors of src, one per line, if it has any.
+func Source(filename string, src []byte) ([]byte, error) {
+	p := parser.New(lexer.NewWithFilename(filename, string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		messages := make([]string, len(p.Errors()))
+		for i, err := range p.Errors() {
+			messages[i] = err.Error()
+		}
+		return nil, errors.New(strings.Join(messages, "\n"))
+	}
+
+	pr := &printer{source: newSource(filename, src)}
+	shebang := pr.shebang()
+	pr.statements(program.Statements, len(src), false, shebang)
+	return []byte(pr.String()), nil
+}
+
+// shebang prints the #! line that the source starts with, reporting whether
+// there is one.
+func (p *printer) shebang() bool {
+	if !bytes.HasPrefix(p.src, []byte("#!")) {
+		return false
+	}
+
+	line := p.src
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	p.WriteString(strings.TrimRight(string(line), " \t\r") + "\n")
+	return true
+}
+
+// source is the source of the program being printed, which is looked at for
+// the layout that is kept.
+type source struct {
+	src []byte
+	// comments are the comments of the source that are yet to be printed,
+	// in order.
+	comments []comment
+	// closing holds the offsets of the closing brackets, parentheses and
+	// braces by the offsets of the opening ones.
+	closing map[int]int
+}
+
+// comment is a comment of the source.
+type comment struct {
+	token.Token
+	// trailing is set for comments following code on the same line.
+	trailing bool
+}
+
+func newSource(filename string, src []byte) *source {
+	s := &source{src: src, closing: map[int]int{}}
+
+	l := lexer.NewWithFilename(filename, string(src))
+	l.SetKeepComments(true)
+	var open []int
+	line := 0 // the line of the last token that isn't a comment
+	for tok := l.NextToken(); tok.T != token.EOF; tok = l.NextToken() {
+		switch tok.T {
+		case token.COMMENT:
+			s.comments = append(s.comments, comment{Token: tok, trailing: tok.Pos.Line == line})
+			continue
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			open = append(open, tok.Pos.Offset)
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			if len(open) > 0 {
+				s.closing[open[len(open)-1]] = tok.Pos.Offset
+				open = open[:len(open)-1]
+			}
+		}
+		line = tok.Pos.Line
+	}
+	return s
+}
+
+// closingOffset returns the offset of the bracket closing the one at pos.
+func (s *source) closingOffset(pos token.Position) int {
+	if offset, ok := s.closing[pos.Offset]; ok && pos.IsValid() {
+		return offset
+	}
+	return len(s.src)
+}
+
+// hasComments reports whether there are comments left to print before
+// offset.
+func (s *source) hasComments(offset int) bool {
+	return len(s.comments) > 0 && s.comments[0].Pos.Offset < offset
+}
+
+// printer prints the nodes of a program, along with the comments of its
+// source.
+type printer struct {
+	strings.Builder
+	*source
+	depth int
+}
+
+// sub returns a printer for part of the output of p, which prints the
+// comments of the source in its place.
+func (p *printer) sub() *printer {
+	return &printer{source: p.source, depth: p.depth}
+}
+
+// draft returns a printer for trying out part of the output of p, which
+// leaves the comments of the source to p.
+func (p *printer) draft() *printer {
+	return &printer{source: &source{src: p.src, closing: p.closing}, depth: p.depth}
+}
+
+func (p *printer) indent() {
+	p.WriteString(strings.Repeat(indent, p.depth))
+}
+
+// statements prints stmts, one per line, followed by the comments before
+// end. The value of a block is that of its last statement, so it goes
+// without a semicolon. Blank lines are kept before the first statement or
+// comment only if printed is set, i.e something was printed before them.
+func (p *printer) statements(stmts []ast.Statement, end int, block, printed bool) {
+	lines := make([]string, len(stmts))
+	for i, stmt := range stmts {
+		line := p.draft()
+		line.statement(stmt)
+		lines[i] = line.String()
+	}
+
+	for i, stmt := range stmts {
+		printed = p.ownLineComments(stmt.Pos().Offset, printed)
+		if printed && p.blankLineBefore(stmt.Pos()) {
+			p.WriteString("\n")
+		}
+		p.indent()
+		p.statement(stmt)
+
+		next := end
+		if i < len(stmts)-1 {
+			next = stmts[i+1].Pos().Offset
+		}
+		if stmt, ok := stmt.(*ast.ExpressionStatement); ok {
+			last := i == len(stmts)-1
+			if last && !block && needsSemicolon(stmt, "") || !last && needsSemicolon(stmt, lines[i+1]) {
+				p.WriteString(";")
+			}
+		}
+		p.trailingComments(next)
+		p.WriteString("\n")
+		printed = true
+	}
+	p.ownLineComments(end, printed)
+}
+
+// ownLineComments prints the comments before offset, each on a line of its
+// own, with the blank lines before them if printed is set. It reports
+// whether anything was printed, before or by it.
+func (p *printer) ownLineComments(offset int, printed bool) bool {
+	for p.hasComments(offset) {
+		c := p.comments[0]
+		p.comments = p.comments[1:]
+
+		if printed && p.blankLineBefore(c.Pos) {
+			p.WriteString("\n")
+		}
+		p.indent()
+		p.WriteString(c.Literal + "\n")
+		printed = true
+	}
+	return printed
+}
+
+// trailingComments prints the comments before offset that follow code on the
+// same line, at the end of the line being printed.
+func (p *printer) trailingComments(offset int) {
+	line := 0
+	for p.hasComments(offset) && p.comments[0].trailing && (line == 0 || p.comments[0].Pos.Line == line) {
+		line = p.comments[0].Pos.Line
+		p.WriteString(" " + p.comments[0].Literal)
+		p.comments = p.comments[1:]
+	}
+}
+
+// needsSemicolon reports whether the expression statement stmt, followed by
+// the statement next, must end with a semicolon so that next isn't parsed as
+// part of it. Only if expressions go without one, like other statements
+// ending with a block.
+func needsSemicolon(stmt *ast.ExpressionStatement, next string) bool {
+	if _, ok := stmt.Expression.(*ast.IfExpression); !ok {
+		return true
+	}
+
+	for _, op := range []string{"(", "[", "-", "++"} {
+		if strings.HasPrefix(next, op) {
+			return true
+		}
+	}
+	return false
+}
+
+// blankLineBefore reports whether there is a blank line before pos in the
+// source.
+func (p *printer) blankLineBefore(pos token.Position) bool {
+	if !pos.IsValid() {
+		return false
+	}
+
+	newlines := 0
+	for i := pos.Offset - 1; i >= 0 && strings.IndexByte(" \t\r\n", p.src[i]) >= 0; i-- {
+		if p.src[i] == '\n' {
+			newlines++
+		}
+	}
+	return newlines > 1
+}
+
+// oneLine reports whether the block starting at pos is written on a single
+// line in the source.
+func (p *printer) oneLine(pos token.Position) bool {
+	if !pos.IsValid() {
+		return false
+	}
+
+	l := lexer.New(string(p.src[pos.Offset:]))
+	depth := 0
+	for tok := l.NextToken(); tok.T != token.EOF; tok = l.NextToken() {
+		switch tok.T {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			depth--
+			if depth == 0 {
+				return tok.Pos.Line == 1
+			}
+		}
+	}
+	return false
+}
+
+func (p *printer) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		p.WriteString("let " + stmt.Name.Value + " = ")
+		p.expression(stmt.Value, 0)
+		p.WriteString(";")
+	case *ast.ReturnStatement:
+		p.WriteString("return ")
+		p.expression(stmt.ReturnValue, 0)
+		p.WriteString(";")
+	case *ast.ExpressionStatement:
+		p.expression(stmt.Expression, 0)
+	case *ast.ImportStatement:
+		p.WriteString(stmt.String())
+	case *ast.ForEachStatement:
+		names := make([]string, len(stmt.Identifiers))
+		for i, id := range stmt.Identifiers {
+			names[i] = id.Value
+		}
+		p.WriteString("for " + strings.Join(names, ", ") + " in ")
+		p.expression(stmt.Collection, 0)
+		p.WriteString(" ")
+		p.block(stmt.Body)
+	case *ast.WhileStatement:
+		p.WriteString("while (")
+		p.expression(stmt.Condition, 0)
+		p.WriteString(") ")
+		p.block(stmt.Body)
+	case *ast.ForStatement:
+		p.WriteString("for (")
+		switch init := stmt.Init.(type) {
+		case *ast.LetStatement:
+			p.WriteString("let " + init.Name.Value + " = ")
+			p.expression(init.Value, 0)
+		case *ast.ExpressionStatement:
+			p.expression(init.Expression, 0)
+		}
+		p.WriteString(";")
+		if stmt.Condition != nil {
+			p.WriteString(" ")
+			p.expression(stmt.Condition, 0)
+		}
+		p.WriteString(";")
+		if stmt.Step != nil {
+			p.WriteString(" ")
+			p.expression(stmt.Step, 0)
+		}
+		p.WriteString(") ")
+		p.block(stmt.Body)
+	case *ast.BreakStatement:
+		p.WriteString("break;")
+	case *ast.ContinueStatement:
+		p.WriteString("continue;")
+	case *ast.ThrowStatement:
+		p.WriteString("throw ")
+		p.expression(stmt.Value, 0)
+		p.WriteString(";")
+	case *ast.TryStatement:
+		p.WriteString("try ")
+		p.block(stmt.Body)
+		if stmt.Catch != nil {
+			p.WriteString(" catch (" + stmt.CatchParam.Value + ") ")
+			p.block(stmt.Catch)
+		}
+		if stmt.Finally != nil {
+			p.WriteString(" finally ")
+			p.block(stmt.Finally)
+		}
+	case *ast.BlockStatement:
+		p.block(stmt)
+	}
+}
+
+// block prints a block, on a single line if it is one in the source and
+// holds a single expression and no comments.
+func (p *printer) block(block *ast.BlockStatement) {
+	end := p.closingOffset(block.Token.Pos)
+	if len(block.Statements) == 0 && !p.hasComments(end) {
+		p.WriteString("{}")
+		return
+	}
+
+	if len(block.Statements) == 1 && !p.hasComments(end) && p.oneLine(block.Token.Pos) {
+		if stmt, ok := block.Statements[0].(*ast.ExpressionStatement); ok {
+			line := p.draft()
+			line.depth = 0
+			line.expression(stmt.Expression, 0)
+			if !strings.Contains(line.String(), "\n") {
+				p.WriteString("{ " + line.String() + " }")
+				return
+			}
+		}
+	}
+
+	p.WriteString("{")
+	if len(block.Statements) > 0 {
+		p.trailingComments(block.Statements[0].Pos().Offset)
+	}
+	p.WriteString("\n")
+	p.depth++
+	p.statements(block.Statements, end, true, false)
+	p.depth--
+	p.indent()
+	p.WriteString("}")
+}
+
+// stringLiteral returns lit as it is written in the source, so that raw
+// strings and escape sequences are kept.
+func (p *printer) stringLiteral(lit *ast.StringLiteral) string {
+	pos := lit.Token.Pos
+	if !pos.IsValid() || pos.Offset >= len(p.src) {
+		return `"` + escaper.Replace(lit.Value) + `"`
+	}
+
+	src := p.src[pos.Offset:]
+	if src[0] == '`' {
+		return string(src[:bytes.IndexByte(src[1:], '`')+2])
+	}
+	for i := 1; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case '"':
+			return string(src[:i+1])
+		}
+	}
+	return string(src)
+}
+
+// escaper escapes the chars that can't be written as they are in string
+// literals.
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\r", `\r`)
+
+// precedence returns how tightly the operator of expr binds, as the
+// precedences of the parser.
+func precedence(expr ast.Expression) int {
+	switch expr := expr.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(expr.Token.T)
+	case *ast.AssignExpression:
+		return int(parser.ASSIGN)
+	case *ast.PrefixExpression:
+		return int(parser.PREFIX)
+	case *ast.PostfixExpression:
+		return int(parser.POSTFIX)
+	case *ast.CallExpression, *ast.IndexAccessExpression, *ast.MemberExpression:
+		return int(parser.CALL)
+	default:
+		// Literals, identifiers and expressions starting with a keyword
+		// never need parentheses.
+		return int(parser.CALL) + 1
+	}
+}
+
+// expression prints expr, in parentheses if its operator binds less tightly
+// than prec.
+func (p *printer) expression(expr ast.Expression, prec int) {
+	if precedence(expr) < prec {
+		p.WriteString("(")
+		defer p.WriteString(")")
+	}
+
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		p.WriteString(expr.Value)
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.BooleanLiteral:
+		p.WriteString(expr.TokenLiteral())
+	case *ast.StringLiteral:
+		p.WriteString(p.stringLiteral(expr))
+	case *ast.PrefixExpression:
+		operand := p.sub()
+		operand.expression(expr.Right, int(parser.PREFIX))
+		p.WriteString(expr.Operator)
+		// - -x isn't --x.
+		if expr.Operator == "-" && strings.HasPrefix(operand.String(), "-") {
+			p.WriteString("(" + operand.String() + ")")
+		} else {
+			p.WriteString(operand.String())
+		}
+	case *ast.PostfixExpression:
+		p.expression(expr.Left, int(parser.POSTFIX))
+		p.WriteString(expr.Operator)
+	case *ast.InfixExpression:
+		prec := parser.Precedence(expr.Token.T)
+		p.expression(expr.Left, prec)
+		p.WriteString(" " + expr.Operator + " ")
+		// Operators are left associative.
+		p.expression(expr.Right, prec+1)
+	case *ast.AssignExpression:
+		p.expression(expr.Target, int(parser.ASSIGN)+1)
+		p.WriteString(" " + expr.Operator + " ")
+		p.expression(expr.Value, 0)
+	case *ast.IfExpression:
+		p.WriteString("if (")
+		p.expression(expr.Condition, 0)
+		p.WriteString(") ")
+		p.block(expr.Consequence)
+		if expr.Alternative != nil {
+			p.WriteString(" else ")
+			p.block(expr.Alternative)
+		}
+	case *ast.FunctionLiteral:
+		params := make([]string, len(expr.Parameters))
+		for i, param := range expr.Parameters {
+			params[i] = param.Value
+		}
+		p.WriteString("fn(" + strings.Join(params, ", ") + ") ")
+		p.block(expr.Body)
+	case *ast.CallExpression:
+		p.expression(expr.Function, int(parser.CALL))
+		p.WriteString("(")
+		for i, arg := range expr.Arguments {
+			if i > 0 {
+				p.WriteString(", ")
+			}
+			p.expression(arg, 0)
+		}
+		p.WriteString(")")
+	case *ast.IndexAccessExpression:
+		p.expression(expr.Left, int(parser.CALL))
+		p.WriteString("[")
+		p.expression(expr.Index, 0)
+		p.WriteString("]")
+	case *ast.MemberExpression:
+		p.expression(expr.Left, int(parser.CALL))
+		p.WriteString("." + expr.Member.Value)
+	case *ast.ArrayLiteral:
+		p.list("[", "]", expr.Token.Pos, expr.Elements, func(elem ast.Expression) {
+			p.expression(elem, 0)
+		})
+	case *ast.HashLiteral:
+		p.list("{", "}", expr.Token.Pos, expr.Keys(), func(key ast.Expression) {
+			p.expression(key, 0)
+			p.WriteString(": ")
+			p.expression(expr.Pairs[key], 0)
+		})
+	}
+}
+
+// list prints the elements of an array or hash literal between open and
+// close, one per line if the first element is on a line of its own in the
+// source.
+func (p *printer) list(open, close string, pos token.Position, elems []ast.Expression, elem func(ast.Expression)) {
+	if len(elems) == 0 || !pos.IsValid() || elems[0].Pos().Line == pos.Line {
+		p.WriteString(open)
+		for i, e := range elems {
+			if i > 0 {
+				p.WriteString(", ")
+			}
+			elem(e)
+		}
+		p.WriteString(close)
+		return
+	}
+
+	end := p.closingOffset(pos)
+	p.WriteString(open)
+	p.trailingComments(elems[0].Pos().Offset)
+	p.WriteString("\n")
+	p.depth++
+	printed := false
+	for i, e := range elems {
+		printed = p.ownLineComments(e.Pos().Offset, printed)
+		p.indent()
+		elem(e)
+		next := end
+		if i < len(elems)-1 {
+			p.WriteString(",")
+			next = elems[i+1].Pos().Offset
+		}
+		p.trailingComments(next)
+		p.WriteString("\n")
+		printed = true
+	}
+	p.ownLineComments(end, printed)
+	p.depth--
+	p.indent()
+	p.WriteString(close)
+}
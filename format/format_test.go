@@ -0,0 +1,120 @@
+package format_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/makramkd/go-monkey/format"
+	"github.com/makramkd/go-monkey/lexer"
+	"github.com/makramkd/go-monkey/parser"
+	"github.com/makramkd/go-monkey/token"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=1+2*3;", "let x = 1 + 2 * 3;\n"},
+		{"#!/usr/bin/env monkeyc  \nputs(1)", "#!/usr/bin/env monkeyc\nputs(1);\n"},
+		{"#!/usr/bin/env monkeyc\n\n\nputs(1)", "#!/usr/bin/env monkeyc\n\nputs(1);\n"},
+		{"#!/usr/bin/env monkeyc", "#!/usr/bin/env monkeyc\n"},
+		{"let x = (1 + 2) * 3;", "let x = (1 + 2) * 3;\n"},
+		{"1 - (2 - 3); (1 - 2) - 3", "1 - (2 - 3);\n1 - 2 - 3;\n"},
+		{"2 ** (3 ** 2); -x ** 2; -(x ** 2)", "2 ** (3 ** 2);\n-x ** 2;\n-(x ** 2);\n"},
+		{"- -x; -(-1); !!ok; -(a + b)", "-(-x);\n-(-1);\n!!ok;\n-(a + b);\n"},
+		{"a = b = c; (a = 1) + 2; x += 1", "a = b = c;\n(a = 1) + 2;\nx += 1;\n"},
+		{"a && b || c && d; a && (b || c)", "a && b || c && d;\na && (b || c);\n"},
+		{"f(1,2)(3); arr[i+1][0]; (a + b)[0]; m.f(x); i++", "f(1, 2)(3);\narr[i + 1][0];\n(a + b)[0];\nm.f(x);\ni++;\n"},
+		{`let h={"a":1,"b":[1,2]};`, "let h = {\"a\": 1, \"b\": [1, 2]};\n"},
+		{"let f = fn(x,y){x+y};", "let f = fn(x, y) { x + y };\n"},
+		{"let f = fn(x) {\nlet y = x;\ny * 2;\n};", "let f = fn(x) {\n    let y = x;\n    y * 2\n};\n"},
+		{"let f = fn() {\n  x\n};", "let f = fn() {\n    x\n};\n"},
+		{"let f = fn() {};", "let f = fn() {};\n"},
+		{"if (a) { b } else { c }; d", "if (a) { b } else { c }\nd;\n"},
+		{"if (a) { b }; (c)", "if (a) { b }\nc;\n"},
+		{"if (a) { b }; (c + 1)[0]", "if (a) { b };\n(c + 1)[0];\n"},
+		{"if (a) { b }; -c", "if (a) { b };\n-c;\n"},
+		{"if (a) {\nreturn b;\n}", "if (a) {\n    return b;\n}\n"},
+		{"let a = 1;\n\n\nlet b = 2;\nlet c = 3;", "let a = 1;\n\nlet b = 2;\nlet c = 3;\n"},
+		{"let a = [\n1,\n2];", "let a = [\n    1,\n    2\n];\n"},
+		{"let h = {\n\"a\": 1};", "let h = {\n    \"a\": 1\n};\n"},
+		{"for x, i in xs { puts(x) }", "for x, i in xs { puts(x) }\n"},
+		{"for (let i=0;i<3;i+=1) {\nif (i == 1) { continue; }\nbreak;\n}", "for (let i = 0; i < 3; i += 1) {\n    if (i == 1) {\n        continue;\n    }\n    break;\n}\n"},
+		{"for (;;) { break; }", "for (;;) {\n    break;\n}\n"},
+		{"while (x > 0) { x -= 1 }", "while (x > 0) { x -= 1 }\n"},
+		{"try { throw \"e\"; } catch (e) { e } finally { done() }", "try {\n    throw \"e\";\n} catch (e) { e } finally { done() }\n"},
+		{"import functools (map, filter);import \"./lib/util\" as u;", "import functools (map, filter);\nimport \"./lib/util\" as u;\n"},
+		{"", ""},
+		{"puts( \"say \\\"hi\\\"\\n\\u{e9}\" ,`raw \\n\n  kept`)", "puts(\"say \\\"hi\\\"\\n\\u{e9}\", `raw \\n\n  kept`);\n"},
+		{"// doc\nlet x=1; // one\n\n\n// last", "// doc\nlet x = 1; // one\n\n// last\n"},
+		{"let f = fn(x) { // why\n  // first\n  x // value\n  // end\n};", "let f = fn(x) { // why\n    // first\n    x // value\n    // end\n};\n"},
+		{"let f = fn() { /* todo */ };", "let f = fn() {\n    /* todo */\n};\n"},
+		{"let f = fn() {\n/* todo */\n};", "let f = fn() {\n    /* todo */\n};\n"},
+		{"if (a) { /* b */ c }", "if (a) { /* b */\n    c\n}\n"},
+		{"let a = [\n// one\n1, // uno\n\n2 /* dos */\n// end\n];", "let a = [\n    // one\n    1, // uno\n    2 /* dos */\n    // end\n];\n"},
+		{"let x = f(1 /* one */, 2);\nx", "let x = f(1, 2); /* one */\nx;\n"},
+		{"/* a /* nested */\n   comment */\nx", "/* a /* nested */\n   comment */\nx;\n"},
+		{"#!/usr/bin/env monkeyc\n\n// doc\nx", "#!/usr/bin/env monkeyc\n\n// doc\nx;\n"},
+		{"let नाम=\"ré\\u{e9}\"; // é\nनाम[1]", "let नाम = \"ré\\u{e9}\"; // é\nनाम[1];\n"},
+	}
+
+	for _, tt := range tests {
+		actual, err := format.Source("test.monkey", []byte(tt.input))
+		if assert.NoError(t, err, tt.input) {
+			assert.Equal(t, tt.expected, string(actual), tt.input)
+		}
+
+		// Formatted code is formatted already.
+		again, err := format.Source("test.monkey", actual)
+		if assert.NoError(t, err, tt.input) {
+			assert.Equal(t, string(actual), string(again), tt.input)
+		}
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	_, err := format.Source("test.monkey", []byte("let = 1;"))
+	assert.EqualError(t, err, "test.monkey:1:5: expected next token to be 'IDENT', got '=' instead\ntest.monkey:1:5: no prefix parse function found for '='")
+}
+
+// TestSourceKeepsMeaning formats the standard library and checks that the
+// formatted programs parse to the same trees, with the same comments.
+func TestSourceKeepsMeaning(t *testing.T) {
+	files, err := filepath.Glob("../evaluator/stdlib/*.monkey")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, files)
+
+	for _, file := range files {
+		src, err := ioutil.ReadFile(file)
+		assert.NoError(t, err)
+
+		formatted, err := format.Source(file, src)
+		if !assert.NoError(t, err, file) {
+			continue
+		}
+		assert.Equal(t, parse(t, src), parse(t, formatted), file)
+		assert.Equal(t, comments(src), comments(formatted), file)
+	}
+}
+
+func comments(src []byte) []string {
+	l := lexer.New(string(src))
+	l.SetKeepComments(true)
+	var comments []string
+	for tok := l.NextToken(); tok.T != token.EOF; tok = l.NextToken() {
+		if tok.T == token.COMMENT {
+			comments = append(comments, tok.Literal)
+		}
+	}
+	return comments
+}
+
+func parse(t *testing.T, src []byte) string {
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	assert.Empty(t, p.Errors())
+	return program.String()
+}
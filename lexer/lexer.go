@@ -1,37 +1,85 @@
 package lexer
 
 import (
+	"strconv"
+	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/makramkd/go-monkey/token"
 )
 
 type Lexer struct {
-	// The input being processed by the lexer.
-	// TODO: should probably be []rune instead?
+	// The input being processed by the lexer, which is decoded as UTF-8.
 	input string
 	// Current position in input (points to current char)
 	position int
 	// Current reading position in input (after current char)
 	readPosition int
-	// Current char under examination
-	// TODO: should probably be rune
-	ch byte
+	// Current char under examination, or utf8.RuneError for bytes that
+	// aren't valid UTF-8.
+	ch rune
+
+	// The name of the file the input was read from, if any.
+	filename string
+	// Line and column of the current char, 1-based. Columns count chars
+	// rather than bytes.
+	line   int
+	column int
+
+	// keepComments makes comments tokens rather than whitespace.
+	keepComments bool
 }
 
 // New creates a new Monkey lexer for the given input.
 func New(input string) *Lexer {
+	return NewWithFilename("", input)
+}
+
+// NewWithFilename creates a new Monkey lexer for the given input, which was
+// read from the given file. The filename is recorded in the position of every
+// token produced by the lexer.
+//
+// A first line starting with #! is skipped, so that scripts can be run
+// directly, e.g with #!/usr/bin/env monkeyc.
+func NewWithFilename(filename, input string) *Lexer {
 	l := &Lexer{
-		input: input,
+		input:    input,
+		filename: filename,
+		line:     1,
 	}
 	l.readChar()
+	if l.ch == '#' && l.peekChar() == '!' {
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+	}
 	return l
 }
 
+// SetKeepComments sets whether comments are returned as COMMENT tokens, as
+// tools that print source code back need, rather than skipped.
+func (l *Lexer) SetKeepComments(keep bool) {
+	l.keepComments = keep
+}
+
 func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 
 	l.skipWhitespace()
+	for l.ch == '/' && (l.peekChar() == '/' || l.peekChar() == '*') {
+		pos := l.pos()
+		comment, ok := l.readComment()
+		if !ok {
+			return token.Token{T: token.ILLEGAL, Literal: comment, Pos: pos}
+		}
+		if l.keepComments {
+			return token.Token{T: token.COMMENT, Literal: comment, Pos: pos}
+		}
+		l.skipWhitespace()
+	}
+
+	pos := l.pos()
 
 	switch l.ch {
 	case ';':
@@ -148,72 +196,245 @@ func (l *Lexer) NextToken() token.Token {
 			tok = token.New(token.ILLEGAL, string(l.ch))
 		}
 	case '"':
-		tok.Literal = l.readStringLiteral()
-		tok.T = token.STRING
+		return l.readString()
+	case '`':
+		return l.readRawString()
 
 	case 0:
 		tok = token.New(token.EOF, "")
 	default:
-		if isLetter(rune(l.ch)) {
+		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.T = token.LookupIdent(tok.Literal)
+			tok.Pos = pos
 			return tok
-		} else if unicode.IsDigit(rune(l.ch)) {
-			tok.T = token.INT
-			tok.Literal = l.readNumber()
+		} else if isDigit(l.ch) {
+			tok.Literal, tok.T = l.readNumber()
+			tok.Pos = pos
 			return tok
 		} else {
-			tok = token.New(token.ILLEGAL, string(l.ch))
+			// The literal holds the bytes read, which may not be valid
+			// UTF-8.
+			tok = token.New(token.ILLEGAL, l.input[l.position:l.readPosition])
 		}
 	}
 
 	l.readChar()
+	tok.Pos = pos
 	return tok
 }
 
+// pos returns the position of the current char.
+func (l *Lexer) pos() token.Position {
+	return token.Position{
+		Filename: l.filename,
+		Offset:   l.position,
+		Line:     l.line,
+		Column:   l.column,
+	}
+}
+
 func (l *Lexer) readChar() {
-	if l.readPosition >= len(l.input) {
-		l.ch = 0
-	} else {
-		l.ch = l.input[l.readPosition]
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
 	}
+	l.column++
+
 	l.position = l.readPosition
-	l.readPosition++
+	l.ch = l.charAt(l.position)
+	size := 1
+	if l.position < len(l.input) {
+		_, size = utf8.DecodeRuneInString(l.input[l.position:])
+	}
+	l.readPosition += size
 }
 
-func (l *Lexer) peekChar() byte {
-	if l.readPosition >= len(l.input) {
+func (l *Lexer) peekChar() rune {
+	return l.charAt(l.readPosition)
+}
+
+// peekCharAt returns the char starting n bytes after the current one, without
+// advancing the lexer.
+func (l *Lexer) peekCharAt(n int) rune {
+	return l.charAt(l.position + n)
+}
+
+// charAt decodes the char starting at the given offset in the input, which
+// is 0 past its end.
+func (l *Lexer) charAt(offset int) rune {
+	if offset >= len(l.input) {
 		return 0
 	}
-
-	return l.input[l.readPosition]
+	r, _ := utf8.DecodeRuneInString(l.input[offset:])
+	return r
 }
 
+// readIdentifier reads an identifier: a letter or underscore followed by
+// letters, digits, underscores and combining marks, in any script.
 func (l *Lexer) readIdentifier() string {
-	return l.read(isLetter)
+	return l.read(isIdentChar)
 }
 
-func (l *Lexer) readNumber() string {
-	return l.read(unicode.IsDigit)
+// readNumber reads an integer or a floating point literal. Floats have a
+// fractional part, an exponent or both, e.g 3.14, 1e-9 or 2.5E3.
+func (l *Lexer) readNumber() (string, token.Type) {
+	position := l.position
+	tokType := token.Type(token.INT)
+
+	l.read(isDigit)
+
+	// A period that isn't followed by a digit isn't part of the number.
+	if l.ch == '.' && isDigit(l.peekCharAt(1)) {
+		tokType = token.FLOAT
+		l.readChar()
+		l.read(isDigit)
+	}
+
+	if l.ch == 'e' || l.ch == 'E' {
+		digitAt := 1
+		if sign := l.peekCharAt(1); sign == '+' || sign == '-' {
+			digitAt = 2
+		}
+		if isDigit(l.peekCharAt(digitAt)) {
+			tokType = token.FLOAT
+			for i := 0; i < digitAt; i++ {
+				l.readChar()
+			}
+			l.read(isDigit)
+		}
+	}
+
+	return l.input[position:l.position], tokType
 }
 
 func (l *Lexer) read(cond func(rune) bool) string {
 	position := l.position
-	for cond(rune(l.ch)) {
+	for cond(l.ch) {
 		l.readChar()
 	}
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readStringLiteral() string {
-	position := l.position + 1
+// readString reads a string literal between double quotes, replacing its
+// escape sequences. Literals that aren't closed on the line they start on
+// are ILLEGAL tokens holding the text read, as are invalid escape sequences,
+// once the rest of the literal is read.
+func (l *Lexer) readString() token.Token {
+	start := l.pos()
+	var value strings.Builder
+	var invalid *token.Token
 	for {
 		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
-			break
+		switch l.ch {
+		case '"':
+			l.readChar()
+			if invalid != nil {
+				return *invalid
+			}
+			return token.Token{T: token.STRING, Literal: value.String(), Pos: start}
+		case '\n', 0:
+			literal := strings.TrimRight(l.input[start.Offset:l.position], "\r")
+			return token.Token{T: token.ILLEGAL, Literal: literal, Pos: start}
+		case '\\':
+			pos := l.pos()
+			if r, ok := l.readEscape(); ok {
+				value.WriteRune(r)
+			} else if invalid == nil {
+				invalid = &token.Token{T: token.ILLEGAL, Literal: l.input[pos.Offset:l.readPosition], Pos: pos}
+			}
+		default:
+			// Bytes that aren't valid UTF-8 are kept as they are.
+			value.WriteString(l.input[l.position:l.readPosition])
 		}
 	}
-	return l.input[position:l.position]
+}
+
+// readEscape reads the escape sequence starting at the current backslash, up
+// to its last char, and returns the char it stands for: one of \n, \t, \r,
+// \\ and \", or \u{...} with the hexadecimal code point of any Unicode char.
+func (l *Lexer) readEscape() (rune, bool) {
+	next := l.peekChar()
+	if next != '\n' && next != 0 {
+		l.readChar()
+	}
+
+	switch next {
+	case 'n':
+		return '\n', true
+	case 't':
+		return '\t', true
+	case 'r':
+		return '\r', true
+	case '\\', '"':
+		return next, true
+	case 'u':
+		if l.peekChar() != '{' {
+			return 0, false
+		}
+		l.readChar()
+		digits := l.readPosition
+		for isHexDigit(l.peekChar()) {
+			l.readChar()
+		}
+		code := l.input[digits:l.readPosition]
+		if l.peekChar() != '}' || len(code) == 0 || len(code) > 6 {
+			return 0, false
+		}
+		l.readChar()
+
+		r, _ := strconv.ParseInt(code, 16, 32)
+		return rune(r), utf8.ValidRune(rune(r))
+	}
+	return 0, false
+}
+
+// readRawString reads a string literal between backticks, which may span
+// lines and has no escape sequences. Literals that aren't closed are ILLEGAL
+// tokens holding the text read.
+func (l *Lexer) readRawString() token.Token {
+	start := l.pos()
+	for {
+		l.readChar()
+		switch l.ch {
+		case '`':
+			l.readChar()
+			return token.Token{T: token.STRING, Literal: l.input[start.Offset+1 : l.position-1], Pos: start}
+		case 0:
+			return token.Token{T: token.ILLEGAL, Literal: l.input[start.Offset:l.position], Pos: start}
+		}
+	}
+}
+
+// readComment reads a line comment, up to the end of the line, or a block
+// comment, in which other block comments may be nested. It reports false for
+// block comments that aren't closed.
+func (l *Lexer) readComment() (string, bool) {
+	position := l.position
+
+	if l.peekChar() == '/' {
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+		return strings.TrimRight(l.input[position:l.position], "\r"), true
+	}
+
+	depth := 0
+	for l.ch != 0 {
+		switch {
+		case l.ch == '/' && l.peekChar() == '*':
+			depth++
+			l.readChar()
+		case l.ch == '*' && l.peekChar() == '/':
+			depth--
+			l.readChar()
+		}
+		l.readChar()
+		if depth == 0 {
+			return l.input[position:l.position], true
+		}
+	}
+	return l.input[position:l.position], false
 }
 
 func (l *Lexer) skipWhitespace() {
@@ -222,10 +443,24 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
-func isWhitespace(ch byte) bool {
+func isWhitespace(ch rune) bool {
 	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
 }
 
+// isDigit reports whether ch is a decimal digit. Numbers are only written
+// with ASCII digits, whatever the script of the identifiers around them.
+func isDigit(ch rune) bool {
+	return '0' <= ch && ch <= '9'
+}
+
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
 func isLetter(ch rune) bool {
 	return unicode.IsLetter(ch) || ch == '_'
 }
+
+func isIdentChar(ch rune) bool {
+	return isLetter(ch) || unicode.IsDigit(ch) || unicode.IsMark(ch)
+}
@@ -222,3 +222,226 @@ a /= 1
 		assert.Equal(t, tt.expectedLiteral, tok.Literal)
 	}
 }
+
+func TestNextTokenNumbers(t *testing.T) {
+	input := `5 3.14 1e-9 2.5E3 1e+2 7e x.5 1.foo`
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{token.INT, "5"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "1e-9"},
+		{token.FLOAT, "2.5E3"},
+		{token.FLOAT, "1e+2"},
+		// An exponent needs digits, otherwise the e starts an identifier.
+		{token.INT, "7"},
+		{token.IDENT, "e"},
+		{token.IDENT, "x"},
+		{token.PERIOD, "."},
+		{token.INT, "5"},
+		// So does a fraction, leaving room for e.g module access.
+		{token.INT, "1"},
+		{token.PERIOD, "."},
+		{token.IDENT, "foo"},
+		{token.EOF, ""},
+	}
+
+	lex := lexer.New(input)
+	for _, tt := range tests {
+		tok := lex.NextToken()
+
+		assert.Equal(t, tt.expectedLiteral, tok.Literal)
+		assert.Equal(t, tt.expectedType, tok.T)
+	}
+}
+
+func TestNextTokenPositions(t *testing.T) {
+	input := `let five = 5;
+if (five >= 5) {
+	"five"
+}`
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{token.LET, "let", 1, 1},
+		{token.IDENT, "five", 1, 5},
+		{token.ASSIGN, "=", 1, 10},
+		{token.INT, "5", 1, 12},
+		{token.SEMICOLON, ";", 1, 13},
+		{token.IF, "if", 2, 1},
+		{token.LPAREN, "(", 2, 4},
+		{token.IDENT, "five", 2, 5},
+		{token.GEQ, ">=", 2, 10},
+		{token.INT, "5", 2, 13},
+		{token.RPAREN, ")", 2, 14},
+		{token.LBRACE, "{", 2, 16},
+		{token.STRING, "five", 3, 2},
+		{token.RBRACE, "}", 4, 1},
+		{token.EOF, "", 4, 2},
+	}
+
+	l := lexer.NewWithFilename("five.monkey", input)
+	for _, tt := range tests {
+		tok := l.NextToken()
+
+		assert.Equal(t, tt.expectedType, tok.T)
+		assert.Equal(t, tt.expectedLiteral, tok.Literal)
+		assert.Equal(t, "five.monkey", tok.Pos.Filename)
+		assert.Equal(t, tt.expectedLine, tok.Pos.Line)
+		assert.Equal(t, tt.expectedColumn, tok.Pos.Column)
+	}
+}
+
+func TestShebang(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedType   token.Type
+		expectedLine   int
+		expectedColumn int
+	}{
+		{"#!/usr/bin/env monkeyc\nlet x = 1;", token.LET, 2, 1},
+		{"#!/usr/bin/env monkeyc", token.EOF, 1, 23},
+		{"#!\n\n  x", token.IDENT, 3, 3},
+		{" #!/usr/bin/env monkeyc", token.ILLEGAL, 1, 2},
+		{"x\n#!/usr/bin/env monkeyc", token.IDENT, 1, 1},
+	}
+
+	for _, tt := range tests {
+		tok := lexer.New(tt.input).NextToken()
+
+		assert.Equal(t, tt.expectedType, tok.T, tt.input)
+		assert.Equal(t, tt.expectedLine, tok.Pos.Line, tt.input)
+		assert.Equal(t, tt.expectedColumn, tok.Pos.Column, tt.input)
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading
+let x = 1; // trailing
+/* block /* nested */
+   still */ x / /**/ 2
+/* open`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{token.COMMENT, "// leading", 1, 1},
+		{token.LET, "let", 2, 1},
+		{token.IDENT, "x", 2, 5},
+		{token.ASSIGN, "=", 2, 7},
+		{token.INT, "1", 2, 9},
+		{token.SEMICOLON, ";", 2, 10},
+		{token.COMMENT, "// trailing", 2, 12},
+		{token.COMMENT, "/* block /* nested */\n   still */", 3, 1},
+		{token.IDENT, "x", 4, 13},
+		{token.DIVIDE, "/", 4, 15},
+		{token.COMMENT, "/**/", 4, 17},
+		{token.INT, "2", 4, 22},
+		{token.ILLEGAL, "/* open", 5, 1},
+		{token.EOF, "", 5, 8},
+	}
+
+	kept := lexer.New(input)
+	kept.SetKeepComments(true)
+	skipped := lexer.New(input)
+	for _, tt := range tests {
+		tok := kept.NextToken()
+		assert.Equal(t, tt.expectedType, tok.T)
+		assert.Equal(t, tt.expectedLiteral, tok.Literal)
+		assert.Equal(t, tt.expectedLine, tok.Pos.Line, tt.expectedLiteral)
+		assert.Equal(t, tt.expectedColumn, tok.Pos.Column, tt.expectedLiteral)
+
+		if tt.expectedType != token.COMMENT {
+			assert.Equal(t, tok, skipped.NextToken())
+		}
+	}
+}
+
+func TestNextTokenStrings(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.Type
+		expectedLiteral string
+		expectedColumn  int
+	}{
+		{`"plain"`, token.STRING, "plain", 1},
+		{`"say \"hi\""`, token.STRING, `say "hi"`, 1},
+		{`"a\nb\tc\rd\\e"`, token.STRING, "a\nb\tc\rd\\e", 1},
+		{`"\u{e9}\u{1F600}\u{0041}"`, token.STRING, "é😀A", 1},
+		{`""`, token.STRING, "", 1},
+		{"`raw \\n \"q\"\nline`", token.STRING, "raw \\n \"q\"\nline", 1},
+		{"``", token.STRING, "", 1},
+		{`"a\qb"`, token.ILLEGAL, `\q`, 3},
+		{`"\u{110000}"`, token.ILLEGAL, `\u{110000}`, 2},
+		{`"\u{}"`, token.ILLEGAL, `\u{`, 2},
+		{`"\u00e9"`, token.ILLEGAL, `\u`, 2},
+		{`"open`, token.ILLEGAL, `"open`, 1},
+		{"\"open\r\n\"", token.ILLEGAL, `"open`, 1},
+		{"`open\n", token.ILLEGAL, "`open\n", 1},
+	}
+
+	for _, tt := range tests {
+		tok := lexer.New(tt.input).NextToken()
+
+		assert.Equal(t, tt.expectedType, tok.T, tt.input)
+		assert.Equal(t, tt.expectedLiteral, tok.Literal, tt.input)
+		assert.Equal(t, tt.expectedColumn, tok.Pos.Column, tt.input)
+	}
+
+	// Lexing goes on after strings, even invalid ones.
+	l := lexer.New("`a\nb` \"\\q\" \"c\nx")
+	for _, expected := range []token.Type{token.STRING, token.ILLEGAL, token.ILLEGAL, token.IDENT, token.EOF} {
+		assert.Equal(t, expected, l.NextToken().T)
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	input := "let naïve = \"日本\";\nnaïve + Ω2 + नाम; x٣ ٣ \xff é"
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{token.LET, "let", 1, 1},
+		{token.IDENT, "naïve", 1, 5},
+		{token.ASSIGN, "=", 1, 11},
+		{token.STRING, "日本", 1, 13},
+		{token.SEMICOLON, ";", 1, 17},
+		{token.IDENT, "naïve", 2, 1},
+		{token.PLUS, "+", 2, 7},
+		{token.IDENT, "Ω2", 2, 9},
+		{token.PLUS, "+", 2, 12},
+		{token.IDENT, "नाम", 2, 14},
+		{token.SEMICOLON, ";", 2, 17},
+		{token.IDENT, "x٣", 2, 19},
+		{token.ILLEGAL, "٣", 2, 22},
+		{token.ILLEGAL, "\xff", 2, 24},
+		{token.IDENT, "é", 2, 26},
+		{token.EOF, "", 2, 27},
+	}
+
+	l := lexer.New(input)
+	for _, tt := range tests {
+		tok := l.NextToken()
+		assert.Equal(t, tt.expectedType, tok.T, tt.expectedLiteral)
+		assert.Equal(t, tt.expectedLiteral, tok.Literal)
+		assert.Equal(t, tt.expectedLine, tok.Pos.Line, tt.expectedLiteral)
+		assert.Equal(t, tt.expectedColumn, tok.Pos.Column, tt.expectedLiteral)
+	}
+
+	// Bytes that aren't valid UTF-8 are kept in strings, and escapes are
+	// reported whole.
+	tok := lexer.New("\"a\xffb\"").NextToken()
+	assert.Equal(t, token.Token{T: token.STRING, Literal: "a\xffb", Pos: tok.Pos}, tok)
+	tok = lexer.New(`"\é"`).NextToken()
+	assert.Equal(t, `\é`, tok.Literal)
+}
@@ -0,0 +1,269 @@
+// Package monkey embeds the Monkey interpreter in Go programs.
+//
+// An Interpreter holds the global environment of a Monkey program. Code is
+// run in it with Run, after which the functions and variables it defined can
+// be used from Go:
+//
+//	interp := monkey.New(monkey.WithStdout(&buf))
+//	if _, err := interp.Run(`let double = fn(x) { x * 2 };`); err != nil {
+//		return err
+//	}
+//	result, err := interp.Call("double", &object.Integer{Value: 21})
+//
+// Untrusted programs can be bounded with WithLimits, and stopped early with
+// RunContext and CallContext. Programs only have access to the operating
+// system if the interpreter is created WithOSAccess. Those calling exit from
+// the os module then end with an error of kind object.ExitError, which
+// leaves it to the host to end the process with its Code.
+//
+// Interpreters don't share any state, so any number of them can be used in
+// the same process, though a single Interpreter must not be used from
+// multiple goroutines at once.
+package monkey
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/makramkd/go-monkey/ast"
+	"github.com/makramkd/go-monkey/evaluator"
+	"github.com/makramkd/go-monkey/evaluator/stdlib"
+	"github.com/makramkd/go-monkey/lexer"
+	"github.com/makramkd/go-monkey/object"
+	"github.com/makramkd/go-monkey/parser"
+)
+
+// Interpreter runs Monkey programs in an environment of its own.
+type Interpreter struct {
+	env    *object.Env
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// Option configures an Interpreter.
+type Option func(*Interpreter)
+
+// WithStdlibPath loads standard modules from the directory path, instead of
+// the standard library embedded in the binary.
+func WithStdlibPath(path string) Option {
+	return func(i *Interpreter) {
+		i.env.SetModuleLoader(stdlib.NewDirLoader(path))
+	}
+}
+
+// WithModulePath looks standard modules up in the given directories after
+// the embedded standard library, and before the directories listed in the
+// MONKEYPATH environment variable.
+func WithModulePath(dirs ...string) Option {
+	return func(i *Interpreter) {
+		i.env.SetModuleLoader(stdlib.NewDefaultLoader(dirs...))
+	}
+}
+
+// WithStdlibFS loads standard modules from fsys, e.g an embed.FS, instead of
+// the standard library embedded in the binary.
+func WithStdlibFS(fsys fs.FS) Option {
+	return func(i *Interpreter) {
+		i.env.SetModuleLoader(stdlib.NewLoader(fsys))
+	}
+}
+
+// WithStdout sets where the output of programs, e.g of puts, is written to.
+// It defaults to os.Stdout.
+func WithStdout(w io.Writer) Option {
+	return func(i *Interpreter) {
+		i.stdout = w
+	}
+}
+
+// WithStderr sets where builtins report diagnostics to. It defaults to
+// os.Stderr.
+func WithStderr(w io.Writer) Option {
+	return func(i *Interpreter) {
+		i.stderr = w
+	}
+}
+
+// WithBuiltin makes a Go function available to programs under the given
+// name, taking precedence over a builtin of the same name.
+func WithBuiltin(name string, f object.BuiltinFunction) Option {
+	return WithGlobal(name, &object.Builtin{F: f})
+}
+
+// WithFunc makes the Go function fn available to programs under the given
+// name, with its arguments and results converted as by object.NewBuiltin. It
+// panics if fn can't be wrapped in a builtin.
+func WithFunc(name string, fn interface{}) Option {
+	return WithGlobal(name, object.MustBuiltin(fn))
+}
+
+// WithGlobal defines a global variable, which is also visible to the modules
+// that programs import.
+func WithGlobal(name string, value object.Object) Option {
+	return func(i *Interpreter) {
+		i.env.Prelude().Set(name, value)
+	}
+}
+
+// WithCheckedArithmetic reports integer overflow as a runtime error instead
+// of wrapping around.
+func WithCheckedArithmetic() Option {
+	return func(i *Interpreter) {
+		i.env.SetCheckedArithmetic(true)
+	}
+}
+
+// WithOSAccess lets programs use the operating system through the os module,
+// to read environment variables and exit. Without it, calling the functions
+// of the module fails with an error of kind object.RuntimeError, so that
+// untrusted programs can neither read the environment of the host nor end
+// it.
+func WithOSAccess() Option {
+	return func(i *Interpreter) {
+		i.env.SetOSAccess(true)
+	}
+}
+
+// WithLimits bounds the resources that each run or call may use. Exceeding
+// them fails with an error of kind object.LimitError, which programs can't
+// catch.
+func WithLimits(limits object.Limits) Option {
+	return func(i *Interpreter) {
+		i.env.SetLimits(limits)
+	}
+}
+
+// New returns an interpreter configured with the given options.
+func New(opts ...Option) *Interpreter {
+	i := &Interpreter{
+		env:    object.NewEnv(),
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+
+	i.env.SetStreams(object.Streams{Stdout: i.stdout, Stderr: i.stderr})
+
+	return i
+}
+
+// Stdout returns the writer that programs print to.
+func (i *Interpreter) Stdout() io.Writer {
+	return i.stdout
+}
+
+// Stderr returns the writer that diagnostics are written to.
+func (i *Interpreter) Stderr() io.Writer {
+	return i.stderr
+}
+
+// ParseError is returned for programs with syntax errors.
+type ParseError struct {
+	Errors []error
+}
+
+func (e *ParseError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Run runs the program src and returns its value. Definitions made by the
+// program remain available to later calls.
+//
+// Runtime errors are returned as *object.Error values and syntax errors as a
+// *ParseError, in which case nothing is run.
+func (i *Interpreter) Run(src string) (object.Object, error) {
+	return i.RunContext(context.Background(), src)
+}
+
+// RunContext runs the program src like Run, stopping it with an error of kind
+// object.LimitError once ctx is done.
+func (i *Interpreter) RunContext(ctx context.Context, src string) (object.Object, error) {
+	return i.run(ctx, lexer.New(src))
+}
+
+// RunFile runs the program in the named file, like Run.
+func (i *Interpreter) RunFile(filename string) (object.Object, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return i.run(context.Background(), lexer.NewWithFilename(filename, string(b)))
+}
+
+func (i *Interpreter) run(ctx context.Context, l *lexer.Lexer) (object.Object, error) {
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, &ParseError{Errors: p.Errors()}
+	}
+
+	return i.EvalContext(ctx, program)
+}
+
+// Eval runs a program that has already been parsed, like Run.
+func (i *Interpreter) Eval(program *ast.Program) (object.Object, error) {
+	return i.EvalContext(context.Background(), program)
+}
+
+// EvalContext runs a program that has already been parsed, like RunContext.
+func (i *Interpreter) EvalContext(ctx context.Context, program *ast.Program) (object.Object, error) {
+	return result(evaluator.EvalContext(ctx, program, i.env))
+}
+
+// Call calls the function bound to the global name with the given arguments.
+func (i *Interpreter) Call(name string, args ...object.Object) (object.Object, error) {
+	return i.CallContext(context.Background(), name, args...)
+}
+
+// CallContext calls a function like Call, stopping it with an error of kind
+// object.LimitError once ctx is done.
+func (i *Interpreter) CallContext(ctx context.Context, name string, args ...object.Object) (object.Object, error) {
+	fn, ok := i.env.Get(name)
+	if !ok {
+		return nil, &object.Error{Kind: object.NameError, Message: "identifier not found: " + name}
+	}
+
+	i.env.SetContext(ctx)
+	defer i.env.SetContext(nil)
+
+	return result(evaluator.Apply(fn, args, i.env))
+}
+
+// Get returns the value of the global variable name.
+func (i *Interpreter) Get(name string) (object.Object, bool) {
+	return i.env.Get(name)
+}
+
+// Set sets the value of the global variable name.
+func (i *Interpreter) Set(name string, value object.Object) {
+	i.env.Set(name, value)
+}
+
+// Env returns the global environment of the interpreter.
+func (i *Interpreter) Env() *object.Env {
+	return i.env
+}
+
+// result converts the result of evaluating a program or call to the values
+// returned by an Interpreter.
+func result(obj object.Object) (object.Object, error) {
+	switch obj := obj.(type) {
+	case nil:
+		// e.g the program ends with a let statement
+		return evaluator.NULL, nil
+	case *object.Error:
+		return nil, obj
+	default:
+		return obj, nil
+	}
+}
@@ -0,0 +1,290 @@
+package monkey_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	monkey "github.com/makramkd/go-monkey"
+	"github.com/makramkd/go-monkey/object"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected object.Object
+	}{
+		{"1 + 2", &object.Integer{Value: 3}},
+		{"let x = 5;", &object.Null{}},
+		{"return 7; 8", &object.Integer{Value: 7}},
+	}
+
+	for _, testCase := range testCases {
+		interp := monkey.New()
+		result, err := interp.Run(testCase.input)
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.expected, result, testCase.input)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	interp := monkey.New()
+
+	_, err := interp.Run("let x = ;")
+	if assert.IsType(t, &monkey.ParseError{}, err) {
+		assert.Len(t, err.(*monkey.ParseError).Errors, 2)
+		assert.EqualError(t, err, "1:9: no prefix parse function found for ';'\n1:10: expected next token to be ';', got 'EOF' instead")
+	}
+
+	_, err = interp.Run("let f = fn() { 1 / 0 };\nf();")
+	if assert.IsType(t, &object.Error{}, err) {
+		assert.Equal(t, object.ArithmeticError, err.(*object.Error).Kind)
+		assert.EqualError(t, err, "1:16: division by zero")
+	}
+
+	// Failed runs don't affect later ones.
+	result, err := interp.Run("f; 1")
+	assert.NoError(t, err)
+	assert.Equal(t, &object.Integer{Value: 1}, result)
+}
+
+func TestCallAndGet(t *testing.T) {
+	interp := monkey.New()
+	_, err := interp.Run(`let greeting = "hello"; let greet = fn(name) { greeting + ", " + name };`)
+	assert.NoError(t, err)
+
+	result, err := interp.Call("greet", &object.String{Value: "monkey"})
+	assert.NoError(t, err)
+	assert.Equal(t, &object.String{Value: "hello, monkey"}, result)
+
+	_, err = interp.Call("greet")
+	assert.EqualError(t, err, "wrong number of arguments. got=0, want=1")
+
+	_, err = interp.Call("missing")
+	assert.EqualError(t, err, "identifier not found: missing")
+
+	_, err = interp.Call("greeting")
+	assert.EqualError(t, err, "not a function: STRING")
+
+	value, ok := interp.Get("greeting")
+	assert.True(t, ok)
+	assert.Equal(t, &object.String{Value: "hello"}, value)
+
+	interp.Set("greeting", &object.String{Value: "hi"})
+	result, err = interp.Call("greet", &object.String{Value: "you"})
+	assert.NoError(t, err)
+	assert.Equal(t, &object.String{Value: "hi, you"}, result)
+
+	_, ok = interp.Get("undefined")
+	assert.False(t, ok)
+}
+
+func TestCallTraceback(t *testing.T) {
+	interp := monkey.New()
+	_, err := interp.Run("let inner = fn() { 1 + true };\nlet outer = fn() { inner() };")
+	assert.NoError(t, err)
+
+	_, err = interp.Call("outer")
+	if assert.IsType(t, &object.Error{}, err) {
+		assert.Equal(t, `Traceback (most recent call last):
+  2:20: in outer
+  1:20: in inner
+`, err.(*object.Error).Traceback())
+	}
+}
+
+func TestOptions(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	stdlib := fstest.MapFS{
+		"greetings.monkey": {Data: []byte(`let hello = fn(name) { "hello " + name };`)},
+	}
+
+	interp := monkey.New(
+		monkey.WithStdout(stdout),
+		monkey.WithStdlibFS(stdlib),
+		monkey.WithGlobal("name", &object.String{Value: "monkey"}),
+		monkey.WithBuiltin("shout", func(args ...object.Object) object.Object {
+			return &object.String{Value: args[0].Inspect() + "!"}
+		}),
+		monkey.WithCheckedArithmetic(),
+	)
+
+	result, err := interp.Run(`import greetings; puts(shout(hello(name))); 42`)
+	assert.NoError(t, err)
+	assert.Equal(t, &object.Integer{Value: 42}, result)
+	assert.Equal(t, "hello monkey!\n", stdout.String())
+
+	_, err = interp.Run("import math;")
+	assert.EqualError(t, err, "1:1: standard module does not exist: math. Was the Monkey stdlib path specified correctly?")
+
+	_, err = interp.Run("9223372036854775807 + 1")
+	assert.EqualError(t, err, "1:1: integer overflow: 9223372036854775807 + 1")
+}
+
+func TestOSAccess(t *testing.T) {
+	t.Setenv("MONKEY_TEST_VAR", "value")
+
+	_, err := monkey.New().Run(`import os; getenv("MONKEY_TEST_VAR");`)
+	assert.EqualError(t, err, "1:12: 'getenv' needs access to the operating system, which the program doesn't have")
+
+	interp := monkey.New(monkey.WithOSAccess())
+	result, err := interp.Run(`import os; getenv("MONKEY_TEST_VAR");`)
+	assert.NoError(t, err)
+	assert.Equal(t, &object.String{Value: "value"}, result)
+
+	_, err = interp.Run(`import os; exit(3);`)
+	if assert.IsType(t, &object.Error{}, err) {
+		assert.Equal(t, object.ExitError, err.(*object.Error).Kind)
+		assert.Equal(t, 3, err.(*object.Error).Code)
+	}
+}
+
+func TestStdlibPath(t *testing.T) {
+	interp := monkey.New(monkey.WithStdlibPath("evaluator/stdlib"))
+	result, err := interp.Run("import functools; sum([1, 2, 3])")
+	assert.NoError(t, err)
+	assert.Equal(t, &object.Integer{Value: 6}, result)
+
+	_, err = interp.Run("let f = fn(x) { x / 0 }; map([1], f);")
+	if assert.IsType(t, &object.Error{}, err) {
+		assert.Equal(t, "evaluator/stdlib/functools.monkey", err.(*object.Error).Stack[1].Pos.Filename)
+	}
+}
+
+func TestEmbeddedStdlib(t *testing.T) {
+	result, err := monkey.New().Run("import math; max(1, 2)")
+	assert.NoError(t, err)
+	assert.Equal(t, &object.Integer{Value: 2}, result)
+
+	dir := t.TempDir()
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "shapes.monkey"), []byte("let square = fn(x) { x * x };"), 0o644))
+
+	interp := monkey.New(monkey.WithModulePath(dir))
+	result, err = interp.Run("import math; import shapes; square(max(2, 3))")
+	assert.NoError(t, err)
+	assert.Equal(t, &object.Integer{Value: 9}, result)
+}
+
+func TestFileModules(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.monkey":      `import "./lib/greet"; import "./lib/greet" as g; greet.hello(); g.hello(); greet.calls;`,
+		"lib/greet.monkey": `let calls = 0; let hello = fn() { calls += 1; puts(greeting + ", " + name) }; let greeting = "hello";`,
+	}
+	for name, src := range files {
+		filename := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filename), 0o755))
+		assert.NoError(t, ioutil.WriteFile(filename, []byte(src), 0o644))
+	}
+
+	stdout := &bytes.Buffer{}
+	interp := monkey.New(
+		monkey.WithStdout(stdout),
+		monkey.WithGlobal("name", &object.String{Value: "monkey"}),
+	)
+
+	// Modules see the definitions of the host, but not those of programs.
+	result, err := interp.RunFile(filepath.Join(dir, "main.monkey"))
+	assert.NoError(t, err)
+	assert.Equal(t, &object.Integer{Value: 2}, result)
+	assert.Equal(t, "hello, monkey\nhello, monkey\n", stdout.String())
+
+	_, ok := interp.Get("greeting")
+	assert.False(t, ok)
+}
+
+func TestIndependentInterpreters(t *testing.T) {
+	first, second := &bytes.Buffer{}, &bytes.Buffer{}
+	a := monkey.New(monkey.WithStdout(first))
+	b := monkey.New(monkey.WithStdout(second), monkey.WithCheckedArithmetic())
+
+	_, err := a.Run(`let x = 1; puts("a");`)
+	assert.NoError(t, err)
+	_, err = b.Run(`let x = 2; puts("b");`)
+	assert.NoError(t, err)
+
+	x, _ := a.Get("x")
+	assert.Equal(t, &object.Integer{Value: 1}, x)
+	x, _ = b.Get("x")
+	assert.Equal(t, &object.Integer{Value: 2}, x)
+	assert.Equal(t, "a\n", first.String())
+	assert.Equal(t, "b\n", second.String())
+
+	result, err := a.Run("9223372036854775807 + 1")
+	assert.NoError(t, err)
+	assert.Equal(t, &object.Integer{Value: -9223372036854775808}, result)
+}
+
+func TestWithFunc(t *testing.T) {
+	interp := monkey.New(
+		monkey.WithFunc("repeat", strings.Repeat),
+		monkey.WithFunc("parse", strconv.Atoi),
+		monkey.WithFunc("keys", func(m map[string]interface{}) []string {
+			keys := []string{}
+			for k := range m {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			return keys
+		}),
+		monkey.WithFunc("positive", func(n int) bool { return n > 0 }),
+	)
+
+	testCases := []struct {
+		input    string
+		expected object.Object
+	}{
+		{`repeat("ab", 3)`, &object.String{Value: "ababab"}},
+		{`parse("12") + 1`, &object.Integer{Value: 13}},
+		{`keys({"b": 1, "a": [2]})`, &object.Array{Values: []object.Object{&object.String{Value: "a"}, &object.String{Value: "b"}}}},
+		{`if (positive(-1)) { 1 } else { 2 }`, &object.Integer{Value: 2}},
+		{`!positive(-1)`, object.TrueValue},
+		{`let r = 0; try { parse("x"); } catch (e) { r = e["message"]; } r;`, &object.String{Value: `strconv.Atoi: parsing "x": invalid syntax`}},
+	}
+
+	for _, testCase := range testCases {
+		result, err := interp.Run(testCase.input)
+		assert.NoError(t, err, testCase.input)
+		assert.Equal(t, testCase.expected, result, testCase.input)
+	}
+
+	_, err := interp.Run(`repeat(1, 2)`)
+	assert.EqualError(t, err, "1:1: argument 1: cannot convert INTEGER to string")
+
+	assert.Panics(t, func() { monkey.New(monkey.WithFunc("x", 1)) })
+}
+
+func TestLimits(t *testing.T) {
+	interp := monkey.New(monkey.WithLimits(object.Limits{MaxSteps: 1000, MaxArrayLength: 10}))
+
+	_, err := interp.Run("let r = 0; try { while (true) { r++; } } catch (e) { r = -1; }")
+	if assert.IsType(t, &object.Error{}, err) {
+		assert.Equal(t, object.LimitError, err.(*object.Error).Kind)
+		assert.EqualError(t, err, "1:33: maximum number of steps exceeded: 1000")
+	}
+
+	// Each run gets steps of its own.
+	result, err := interp.Run("r")
+	assert.NoError(t, err)
+	assert.Greater(t, result.(*object.Integer).Value, int64(0))
+
+	_, err = interp.Run("let a = []; for (let i = 0; i < 20; i++) { a = push(a, i); }")
+	assert.EqualError(t, err, "1:48: maximum array length exceeded: 10")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = interp.RunContext(ctx, "let loop = fn() { while (true) {} };")
+	assert.NoError(t, err)
+	_, err = interp.CallContext(ctx, "loop")
+	if assert.IsType(t, &object.Error{}, err) {
+		assert.Equal(t, object.LimitError, err.(*object.Error).Kind)
+	}
+}
@@ -0,0 +1,50 @@
+package object
+
+import (
+	"math"
+)
+
+// AddInt64 returns a + b, reporting whether the addition overflowed.
+func AddInt64(a, b int64) (int64, bool) {
+	c := a + b
+	return c, (c > a) != (b > 0)
+}
+
+// SubInt64 returns a - b, reporting whether the subtraction overflowed.
+func SubInt64(a, b int64) (int64, bool) {
+	c := a - b
+	return c, (c < a) != (b > 0)
+}
+
+// MulInt64 returns a * b, reporting whether the multiplication overflowed.
+func MulInt64(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, false
+	}
+	c := a * b
+	return c, c/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64)
+}
+
+// IntegerPow raises base to the power of exp, reporting whether the result
+// overflowed. Negative powers of integers generally aren't integers, so those
+// are computed as floats.
+func IntegerPow(base, exp int64) (Object, bool) {
+	if exp < 0 {
+		return &Float{Value: math.Pow(float64(base), float64(exp))}, false
+	}
+
+	result, overflow := int64(1), false
+	for exp > 0 {
+		var o bool
+		if exp&1 == 1 {
+			result, o = MulInt64(result, base)
+			overflow = overflow || o
+		}
+		exp >>= 1
+		if exp > 0 {
+			base, o = MulInt64(base, base)
+			overflow = overflow || o
+		}
+	}
+	return &Integer{Value: result}, overflow
+}
@@ -0,0 +1,314 @@
+package object
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+)
+
+// Builtins is the list of functions available to every Monkey program.
+// The order matters: the compiler refers to builtins by their index in this
+// list, so new builtins must only ever be appended.
+var Builtins = []struct {
+	Name    string
+	Builtin *Builtin
+}{
+	{
+		"len",
+		&Builtin{F: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError(ArgumentError, "wrong number of arguments. got=%d, want=%d", len(args), 1)
+			}
+
+			a := args[0]
+
+			switch a.Type() {
+			case STRING:
+				return &Integer{Value: int64(a.(*String).Len())}
+			case ARRAY:
+				return &Integer{Value: int64(len(a.(*Array).Values))}
+			default:
+				return newError(TypeError, "argument to 'len' not supported, got %s", a.Type())
+			}
+		}},
+	},
+	{
+		"first",
+		&Builtin{F: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError(ArgumentError, "wrong number of arguments. got=%d, want=%d", len(args), 1)
+			}
+
+			a := args[0]
+
+			switch a.Type() {
+			case ARRAY:
+				arr := a.(*Array)
+				if len(arr.Values) > 0 {
+					return arr.Values[0]
+				}
+				return nil
+			default:
+				return newError(TypeError, "argument to 'first' must be ARRAY, got %s", a.Type())
+			}
+		}},
+	},
+	{
+		"last",
+		&Builtin{F: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError(ArgumentError, "wrong number of arguments. got=%d, want=%d", len(args), 1)
+			}
+
+			a := args[0]
+
+			switch a.Type() {
+			case ARRAY:
+				arr := a.(*Array)
+				if len(arr.Values) > 0 {
+					return arr.Values[len(arr.Values)-1]
+				}
+				return nil
+			default:
+				return newError(TypeError, "argument to 'first' must be ARRAY, got %s", a.Type())
+			}
+		}},
+	},
+	{
+		"rest",
+		&Builtin{F: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError(ArgumentError, "wrong number of arguments. got=%d, want=%d", len(args), 1)
+			}
+
+			a := args[0]
+
+			switch a.Type() {
+			case ARRAY:
+				arr := a.(*Array)
+				if len(arr.Values) > 0 {
+					return arr.Rest()
+				}
+				return nil
+			default:
+				return newError(TypeError, "argument to 'first' must be ARRAY, got %s", a.Type())
+			}
+		}},
+	},
+	{
+		"push",
+		&Builtin{
+			F: func(args ...Object) Object {
+				return push(Limits{}, args)
+			},
+			Hosted: func(host Host, args ...Object) Object {
+				return push(host.Limits, args)
+			},
+		},
+	},
+	{
+		"puts",
+		&Builtin{
+			F: func(args ...Object) Object {
+				return puts(os.Stdout, args)
+			},
+			Hosted: func(host Host, args ...Object) Object {
+				return puts(host.Streams.Stdout, args)
+			},
+		},
+	},
+	{
+		"int",
+		&Builtin{F: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError(ArgumentError, "wrong number of arguments. got=%d, want=%d", len(args), 1)
+			}
+
+			switch a := args[0].(type) {
+			case *Integer:
+				return a
+			case *Float:
+				// Floats are truncated towards zero, like Go conversions, as
+				// long as the result fits in an integer.
+				if math.IsNaN(a.Value) || a.Value < math.MinInt64 || a.Value >= math.MaxInt64 {
+					return newError(ValueError, "argument to 'int' out of range, got %s", a.Inspect())
+				}
+				return &Integer{Value: int64(a.Value)}
+			case *String:
+				v, err := strconv.ParseInt(a.Value, 10, 64)
+				if err != nil {
+					return newError(ValueError, "could not parse %q as integer", a.Value)
+				}
+				return &Integer{Value: v}
+			default:
+				return newError(TypeError, "argument to 'int' not supported, got %s", a.Type())
+			}
+		}},
+	},
+	{
+		"float",
+		&Builtin{F: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError(ArgumentError, "wrong number of arguments. got=%d, want=%d", len(args), 1)
+			}
+
+			switch a := args[0].(type) {
+			case *Integer:
+				return &Float{Value: float64(a.Value)}
+			case *Float:
+				return a
+			case *String:
+				v, err := strconv.ParseFloat(a.Value, 64)
+				if err != nil {
+					return newError(ValueError, "could not parse %q as float", a.Value)
+				}
+				return &Float{Value: v}
+			default:
+				return newError(TypeError, "argument to 'float' not supported, got %s", a.Type())
+			}
+		}},
+	},
+	// The builtins whose names start with an underscore are those that the
+	// standard library is built upon, e.g the os module.
+	{
+		"_getenv",
+		&Builtin{
+			F: getenv,
+			Hosted: func(host Host, args ...Object) Object {
+				if !host.OSAccess {
+					return noOSAccess("getenv")
+				}
+				return getenv(args...)
+			},
+		},
+	},
+	{
+		"_exit",
+		&Builtin{
+			F: exit,
+			Hosted: func(host Host, args ...Object) Object {
+				if !host.OSAccess {
+					return noOSAccess("exit")
+				}
+				return exit(args...)
+			},
+		},
+	},
+	{
+		"bytelen",
+		&Builtin{F: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError(ArgumentError, "wrong number of arguments. got=%d, want=%d", len(args), 1)
+			}
+
+			s, ok := args[0].(*String)
+			if !ok {
+				return newError(TypeError, "argument to 'bytelen' must be STRING, got %s", args[0].Type())
+			}
+			// The length of the string encoded as UTF-8, where len counts
+			// its chars.
+			return &Integer{Value: int64(len(s.Value))}
+		}},
+	},
+}
+
+// push appends to an array, checking that the result is within limits
+// before making it.
+func push(limits Limits, args []Object) Object {
+	if len(args) != 2 {
+		return newError(ArgumentError, "wrong number of arguments. got=%d, want=%d", len(args), 2)
+	}
+
+	a := args[0]
+
+	switch a.Type() {
+	case ARRAY:
+		arr := a.(*Array)
+		if err := limits.CheckArrayLength(len(arr.Values) + 1); err != nil {
+			return err
+		}
+		return arr.Push(args[1])
+	default:
+		return newError(TypeError, "argument to 'first' must be ARRAY, got %s", a.Type())
+	}
+}
+
+// Puts returns a puts builtin that prints its arguments to w, one per line,
+// whatever the streams of the program calling it.
+func Puts(w io.Writer) *Builtin {
+	return &Builtin{F: func(args ...Object) Object {
+		return puts(w, args)
+	}}
+}
+
+func puts(w io.Writer, args []Object) Object {
+	for _, a := range args {
+		fmt.Fprintln(w, a.Inspect())
+	}
+
+	return nil
+}
+
+// getenv returns the value of an environment variable, or nil if it isn't
+// set.
+func getenv(args ...Object) Object {
+	if len(args) != 1 {
+		return newError(ArgumentError, "wrong number of arguments. got=%d, want=%d", len(args), 1)
+	}
+
+	name, ok := args[0].(*String)
+	if !ok {
+		return newError(TypeError, "argument to 'getenv' must be STRING, got %s", args[0].Type())
+	}
+	value, ok := os.LookupEnv(name.Value)
+	if !ok {
+		return nil
+	}
+	return &String{Value: value}
+}
+
+// exit returns the error that ends a program with the given status, 0 if
+// there is none.
+func exit(args ...Object) Object {
+	if len(args) > 1 {
+		return newError(ArgumentError, "wrong number of arguments. got=%d, want=%d", len(args), 1)
+	}
+
+	code := int64(0)
+	if len(args) == 1 {
+		i, ok := args[0].(*Integer)
+		if !ok {
+			return newError(TypeError, "argument to 'exit' must be INTEGER, got %s", args[0].Type())
+		}
+		code = i.Value
+	}
+	if code < 0 || code > 255 {
+		return newError(ValueError, "exit status out of range 0-255, got %d", code)
+	}
+	return &Error{Kind: ExitError, Message: fmt.Sprintf("exit status %d", code), Code: int(code)}
+}
+
+// noOSAccess returns the error raised by the builtin name when it is called
+// by a program without access to the operating system.
+func noOSAccess(name string) *Error {
+	return newError(RuntimeError, "'%s' needs access to the operating system, which the program doesn't have", name)
+}
+
+// GetBuiltinByName returns the builtin with the given name, or nil if there
+// is no such builtin.
+// Builtins return nil rather than a null object when they have nothing to
+// return; it is up to the caller to translate that into its own null value.
+func GetBuiltinByName(name string) *Builtin {
+	for _, def := range Builtins {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+	return nil
+}
+
+func newError(kind ErrorKind, format string, a ...interface{}) *Error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
+}
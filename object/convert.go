@@ -0,0 +1,532 @@
+package object
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var (
+	objectType = reflect.TypeOf((*Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// FromGo converts a Go value to the Monkey object that represents it:
+//
+//   - nil and nil pointers, slices and maps become null,
+//   - booleans, integers, floats and strings become their Monkey
+//     counterparts; unsigned integers above math.MaxInt64 are an error,
+//   - slices and arrays become arrays, and maps become hashes,
+//   - structs become hashes keyed by the names of their exported fields,
+//     which a `monkey:"name"` tag can rename, or skip with `monkey:"-"`,
+//   - pointers are converted to the value they point to,
+//   - functions become builtins, as created by NewBuiltin.
+//
+// Objects are returned as-is. Values that contain themselves, e.g through a
+// pointer, can't be converted and are an error.
+func FromGo(v interface{}) (Object, error) {
+	if v == nil {
+		return NullValue, nil
+	}
+	return fromGo(reflect.ValueOf(v))
+}
+
+func fromGo(v reflect.Value) (Object, error) {
+	var c converter
+	return c.fromGo(v)
+}
+
+// converter converts Go values to objects, keeping track of the pointers,
+// slices and maps that are being converted to detect cycles.
+type converter struct {
+	path map[reference]bool
+}
+
+// reference identifies the Go value a pointer, slice or map refers to.
+type reference struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+// enter records that the value v refers to is being converted, reporting
+// false if it already is, i.e v is part of a cycle.
+func (c *converter) enter(v reflect.Value) (reference, bool) {
+	ref := reference{ptr: v.Pointer(), typ: v.Type()}
+	if v.Kind() == reflect.Slice {
+		ref.len = v.Len()
+	}
+	if c.path[ref] {
+		return ref, false
+	}
+	if c.path == nil {
+		c.path = map[reference]bool{}
+	}
+	c.path[ref] = true
+	return ref, true
+}
+
+func (c *converter) leave(ref reference) {
+	delete(c.path, ref)
+}
+
+func (c *converter) fromGo(v reflect.Value) (Object, error) {
+	if v.Type().Implements(objectType) {
+		if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+			return NullValue, nil
+		}
+		return v.Interface().(Object), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return TrueValue, nil
+		}
+		return FalseValue, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := v.Uint()
+		if int64(u) < 0 {
+			return nil, newError(ValueError, "%d is out of range for INTEGER", u)
+		}
+		return &Integer{Value: int64(u)}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Float{Value: v.Float()}, nil
+	case reflect.String:
+		return &String{Value: v.String()}, nil
+	case reflect.Interface:
+		if v.IsNil() {
+			return NullValue, nil
+		}
+		return c.fromGo(v.Elem())
+	case reflect.Ptr, reflect.Slice, reflect.Map:
+		if v.IsNil() {
+			return NullValue, nil
+		}
+		ref, ok := c.enter(v)
+		if !ok {
+			return nil, newError(ValueError, "cannot convert Go value of type %s that contains itself", v.Type())
+		}
+		defer c.leave(ref)
+
+		switch v.Kind() {
+		case reflect.Ptr:
+			return c.fromGo(v.Elem())
+		case reflect.Slice:
+			return c.fromGoArray(v)
+		default:
+			return c.fromGoMap(v)
+		}
+	case reflect.Array:
+		return c.fromGoArray(v)
+	case reflect.Struct:
+		return c.fromGoStruct(v)
+	case reflect.Func:
+		if v.IsNil() {
+			return NullValue, nil
+		}
+		b, err := NewBuiltin(v.Interface())
+		if err != nil {
+			return nil, newError(TypeError, "%s", err)
+		}
+		return b, nil
+	default:
+		return nil, newError(TypeError, "cannot convert Go value of type %s", v.Type())
+	}
+}
+
+func (c *converter) fromGoArray(v reflect.Value) (Object, error) {
+	values := make([]Object, v.Len())
+	for i := range values {
+		value, err := c.fromGo(v.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return &Array{Values: values}, nil
+}
+
+func (c *converter) fromGoMap(v reflect.Value) (Object, error) {
+	h := &Hash{Pairs: make(map[HashKey]HashPair, v.Len())}
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := c.fromGo(iter.Key())
+		if err != nil {
+			return nil, err
+		}
+		hashable, ok := key.(Hashable)
+		if !ok {
+			return nil, newError(TypeError, "unusable as hash key: %s", key.Type())
+		}
+		value, err := c.fromGo(iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		h.Pairs[hashable.HashKey()] = HashPair{Key: key, Value: value}
+	}
+	return h, nil
+}
+
+func (c *converter) fromGoStruct(v reflect.Value) (Object, error) {
+	h := &Hash{Pairs: map[HashKey]HashPair{}}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, ok := fieldName(t.Field(i))
+		if !ok {
+			continue
+		}
+		value, err := c.fromGo(v.Field(i))
+		if err != nil {
+			return nil, err
+		}
+		h.set(name, value)
+	}
+	return h, nil
+}
+
+// fieldName returns the hash key that a struct field is stored under,
+// reporting false if the field is unexported or skipped with a tag.
+func fieldName(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" {
+		return "", false
+	}
+	tag := f.Tag.Get("monkey")
+	switch tag {
+	case "-":
+		return "", false
+	case "":
+		return f.Name, true
+	default:
+		return tag, true
+	}
+}
+
+// ToGo stores the Go value of obj in the value pointed to by target,
+// converting it the opposite way to FromGo. Integers may be stored in floats
+// but not the other way around, hashes may be stored in maps and structs,
+// and null sets pointers, slices, maps and interfaces to nil.
+//
+// Stored in an empty interface, integers become int64, floats float64,
+// arrays []interface{}, and hashes map[string]interface{}, or
+// map[interface{}]interface{} if not all of their keys are strings. Objects
+// without a Go counterpart, e.g functions, are stored as-is.
+func ToGo(obj Object, target interface{}) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("ToGo: target must be a non-nil pointer, got %T", target)
+	}
+	return toGo(obj, v.Elem())
+}
+
+func toGo(obj Object, v reflect.Value) error {
+	t := v.Type()
+	if t == objectType || reflect.TypeOf(obj) == t {
+		v.Set(reflect.ValueOf(obj))
+		return nil
+	}
+
+	if _, ok := obj.(*Null); ok {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		if b, ok := obj.(*Boolean); ok {
+			v.SetBool(b.Value)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i, ok := obj.(*Integer); ok {
+			if v.OverflowInt(i.Value) {
+				return newError(ValueError, "%d is out of range for %s", i.Value, t)
+			}
+			v.SetInt(i.Value)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if i, ok := obj.(*Integer); ok {
+			if i.Value < 0 || v.OverflowUint(uint64(i.Value)) {
+				return newError(ValueError, "%d is out of range for %s", i.Value, t)
+			}
+			v.SetUint(uint64(i.Value))
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if f, ok := ToFloat(obj); ok {
+			v.SetFloat(f)
+			return nil
+		}
+	case reflect.String:
+		if s, ok := obj.(*String); ok {
+			v.SetString(s.Value)
+			return nil
+		}
+	case reflect.Ptr:
+		elem := reflect.New(t.Elem())
+		if err := toGo(obj, elem.Elem()); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	case reflect.Slice:
+		if a, ok := obj.(*Array); ok {
+			s := reflect.MakeSlice(t, len(a.Values), len(a.Values))
+			for i, value := range a.Values {
+				if err := toGo(value, s.Index(i)); err != nil {
+					return err
+				}
+			}
+			v.Set(s)
+			return nil
+		}
+	case reflect.Array:
+		if a, ok := obj.(*Array); ok {
+			if len(a.Values) != t.Len() {
+				return newError(ValueError, "cannot convert array of length %d to %s", len(a.Values), t)
+			}
+			for i, value := range a.Values {
+				if err := toGo(value, v.Index(i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case reflect.Map:
+		if h, ok := obj.(*Hash); ok {
+			m := reflect.MakeMapWithSize(t, len(h.Pairs))
+			for _, pair := range h.Pairs {
+				key := reflect.New(t.Key()).Elem()
+				if err := toGo(pair.Key, key); err != nil {
+					return err
+				}
+				value := reflect.New(t.Elem()).Elem()
+				if err := toGo(pair.Value, value); err != nil {
+					return err
+				}
+				m.SetMapIndex(key, value)
+			}
+			v.Set(m)
+			return nil
+		}
+	case reflect.Struct:
+		if h, ok := obj.(*Hash); ok {
+			for i := 0; i < t.NumField(); i++ {
+				name, ok := fieldName(t.Field(i))
+				if !ok {
+					continue
+				}
+				value := h.get(name)
+				if value == nil {
+					continue
+				}
+				if err := toGo(value, v.Field(i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case reflect.Interface:
+		if t.NumMethod() == 0 {
+			value, err := toInterface(obj)
+			if err != nil {
+				return err
+			}
+			if value != nil {
+				v.Set(reflect.ValueOf(value))
+			} else {
+				v.Set(reflect.Zero(t))
+			}
+			return nil
+		}
+	}
+
+	return newError(TypeError, "cannot convert %s to %s", obj.Type(), t)
+}
+
+// toInterface converts obj to the Go value it is stored as in an empty
+// interface.
+func toInterface(obj Object) (interface{}, error) {
+	switch obj := obj.(type) {
+	case *Null:
+		return nil, nil
+	case *Boolean:
+		return obj.Value, nil
+	case *Integer:
+		return obj.Value, nil
+	case *Float:
+		return obj.Value, nil
+	case *String:
+		return obj.Value, nil
+	case *Array:
+		values := make([]interface{}, len(obj.Values))
+		for i, value := range obj.Values {
+			v, err := toInterface(value)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		return values, nil
+	case *Hash:
+		if !hasStringKeys(obj) {
+			return toInterfaceMap(obj)
+		}
+		m := make(map[string]interface{}, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			v, err := toInterface(pair.Value)
+			if err != nil {
+				return nil, err
+			}
+			m[pair.Key.(*String).Value] = v
+		}
+		return m, nil
+	default:
+		return obj, nil
+	}
+}
+
+func toInterfaceMap(h *Hash) (map[interface{}]interface{}, error) {
+	m := make(map[interface{}]interface{}, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		k, err := toInterface(pair.Key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := toInterface(pair.Value)
+		if err != nil {
+			return nil, err
+		}
+		m[k] = v
+	}
+	return m, nil
+}
+
+func hasStringKeys(h *Hash) bool {
+	for _, pair := range h.Pairs {
+		if _, ok := pair.Key.(*String); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// NewBuiltin wraps a Go function in a builtin. Calls check the number of
+// arguments and convert them to the types of the function's parameters with
+// ToGo, and convert its result back with FromGo. The function may return
+// nothing, a single value, an error, or a value and an error; a non-nil error
+// is returned to the program as a runtime error, keeping its kind if it is an
+// *Error. A panic in the function is returned as a runtime error too, rather
+// than crashing the program running Monkey code.
+//
+// It returns an error if fn isn't a function or returns anything else.
+func NewBuiltin(fn interface{}) (*Builtin, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return nil, fmt.Errorf("NewBuiltin: %T is not a function", fn)
+	}
+	t := v.Type()
+
+	returnsError := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+	numValues := t.NumOut()
+	if returnsError {
+		numValues--
+	}
+	if numValues > 1 {
+		return nil, fmt.Errorf("NewBuiltin: %s returns more than one value besides an error", t)
+	}
+
+	return &Builtin{F: func(args ...Object) Object {
+		in, err := builtinArgs(t, args)
+		if err != nil {
+			return err
+		}
+
+		out, panicErr := call(v, in)
+		if panicErr != nil {
+			return panicErr
+		}
+
+		if returnsError {
+			if err, _ := out[len(out)-1].Interface().(error); err != nil {
+				return goError(err)
+			}
+		}
+		if numValues == 0 {
+			return nil
+		}
+		result, convErr := fromGo(out[0])
+		if convErr != nil {
+			return convErr.(*Error)
+		}
+		return result
+	}}, nil
+}
+
+// call calls fn with the arguments in, recovering from a panic in fn.
+func call(fn reflect.Value, in []reflect.Value) (out []reflect.Value, err *Error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = newError(RuntimeError, "panic in Go function: %v", r)
+		}
+	}()
+	return fn.Call(in), nil
+}
+
+// MustBuiltin is like NewBuiltin but panics if fn can't be wrapped.
+func MustBuiltin(fn interface{}) *Builtin {
+	b, err := NewBuiltin(fn)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// builtinArgs converts the arguments of a call to a builtin created by
+// NewBuiltin to the parameters of its function type t.
+func builtinArgs(t reflect.Type, args []Object) ([]reflect.Value, *Error) {
+	numIn := t.NumIn()
+	if t.IsVariadic() {
+		if len(args) < numIn-1 {
+			return nil, newError(ArgumentError, "wrong number of arguments. got=%d, want at least %d", len(args), numIn-1)
+		}
+	} else if len(args) != numIn {
+		return nil, newError(ArgumentError, "wrong number of arguments. got=%d, want=%d", len(args), numIn)
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var paramType reflect.Type
+		if t.IsVariadic() && i >= numIn-1 {
+			paramType = t.In(numIn - 1).Elem()
+		} else {
+			paramType = t.In(i)
+		}
+
+		param := reflect.New(paramType).Elem()
+		if err := toGo(arg, param); err != nil {
+			e := err.(*Error)
+			return nil, newError(e.Kind, "argument %d: %s", i+1, e.Message)
+		}
+		in[i] = param
+	}
+	return in, nil
+}
+
+// goError converts an error returned by a Go function to a runtime error.
+// Errors of the function's own are copied, as the engines fill in where they
+// occurred.
+func goError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		copied := *e
+		return &copied
+	}
+	return newError(GenericError, "%s", err)
+}
@@ -0,0 +1,246 @@
+package object_test
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/makramkd/go-monkey/object"
+	"github.com/stretchr/testify/assert"
+)
+
+// node is a Go type whose values may contain themselves.
+type node struct {
+	Next *node
+}
+
+type point struct {
+	X, Y   int
+	Label  string `monkey:"label"`
+	Hidden bool   `monkey:"-"`
+	secret int
+}
+
+func hash(pairs ...object.Object) *object.Hash {
+	h := &object.Hash{Pairs: map[object.HashKey]object.HashPair{}}
+	for i := 0; i < len(pairs); i += 2 {
+		h.Pairs[pairs[i].(object.Hashable).HashKey()] = object.HashPair{Key: pairs[i], Value: pairs[i+1]}
+	}
+	return h
+}
+
+func str(s string) *object.String     { return &object.String{Value: s} }
+func integer(i int64) *object.Integer { return &object.Integer{Value: i} }
+
+func TestFromGo(t *testing.T) {
+	var nilPointer *point
+	var nilSlice []int
+
+	testCases := []struct {
+		input    interface{}
+		expected object.Object
+	}{
+		{nil, object.NullValue},
+		{nilPointer, object.NullValue},
+		{nilSlice, object.NullValue},
+		{true, object.TrueValue},
+		{false, object.FalseValue},
+		{42, integer(42)},
+		{int8(-3), integer(-3)},
+		{uint16(7), integer(7)},
+		{2.5, &object.Float{Value: 2.5}},
+		{float32(0.5), &object.Float{Value: 0.5}},
+		{"monkey", str("monkey")},
+		{[]int{1, 2}, &object.Array{Values: []object.Object{integer(1), integer(2)}}},
+		{[2]string{"a", "b"}, &object.Array{Values: []object.Object{str("a"), str("b")}}},
+		{[]interface{}{1, "a", nil}, &object.Array{Values: []object.Object{integer(1), str("a"), object.NullValue}}},
+		{map[string]int{"a": 1}, hash(str("a"), integer(1))},
+		{map[int]bool{1: true}, hash(integer(1), object.TrueValue)},
+		{point{X: 1, Y: 2, Label: "p", Hidden: true}, hash(str("X"), integer(1), str("Y"), integer(2), str("label"), str("p"))},
+		{&point{Label: "q"}, hash(str("X"), integer(0), str("Y"), integer(0), str("label"), str("q"))},
+		{integer(5), integer(5)},
+	}
+
+	for _, testCase := range testCases {
+		result, err := object.FromGo(testCase.input)
+		assert.NoError(t, err, "%#v", testCase.input)
+		assert.Equal(t, testCase.expected, result, "%#v", testCase.input)
+	}
+
+	// Booleans and null are the values shared by the engines.
+	result, _ := object.FromGo(true)
+	assert.Same(t, object.TrueValue, result)
+	result, _ = object.FromGo(nil)
+	assert.Same(t, object.NullValue, result)
+}
+
+func TestFromGoErrors(t *testing.T) {
+	testCases := []struct {
+		input    interface{}
+		expected string
+	}{
+		{uint64(math.MaxUint64), "18446744073709551615 is out of range for INTEGER"},
+		{make(chan int), "cannot convert Go value of type chan int"},
+		{map[float64]int{1.5: 1}, "unusable as hash key: FLOAT"},
+		{[]complex128{1i}, "cannot convert Go value of type complex128"},
+		{func() (int, int) { return 1, 2 }, "NewBuiltin: func() (int, int) returns more than one value besides an error"},
+		{cyclic(), "cannot convert Go value of type *object_test.node that contains itself"},
+		{cyclicSlice(), "cannot convert Go value of type []interface {} that contains itself"},
+		{cyclicMap(), "cannot convert Go value of type map[string]interface {} that contains itself"},
+	}
+
+	for _, testCase := range testCases {
+		_, err := object.FromGo(testCase.input)
+		assert.EqualError(t, err, testCase.expected, "%#v", testCase.input)
+	}
+}
+
+func cyclic() *node {
+	n := &node{}
+	n.Next = &node{Next: n}
+	return n
+}
+
+func cyclicSlice() []interface{} {
+	s := []interface{}{1, nil}
+	s[1] = s
+	return s
+}
+
+func cyclicMap() map[string]interface{} {
+	m := map[string]interface{}{}
+	m["self"] = m
+	return m
+}
+
+func TestFromGoSharedValues(t *testing.T) {
+	// Values referred to more than once without a cycle are converted each
+	// time.
+	shared := &node{}
+	result, err := object.FromGo([]*node{shared, shared})
+	assert.NoError(t, err)
+	leaf := hash(str("Next"), object.NullValue)
+	assert.Equal(t, &object.Array{Values: []object.Object{leaf, leaf}}, result)
+}
+
+func TestToGo(t *testing.T) {
+	var i int
+	assert.NoError(t, object.ToGo(integer(7), &i))
+	assert.Equal(t, 7, i)
+
+	var f float64
+	assert.NoError(t, object.ToGo(integer(3), &f))
+	assert.Equal(t, 3.0, f)
+
+	var s string
+	assert.NoError(t, object.ToGo(str("monkey"), &s))
+	assert.Equal(t, "monkey", s)
+
+	var b bool
+	assert.NoError(t, object.ToGo(object.TrueValue, &b))
+	assert.True(t, b)
+
+	var ints []int
+	assert.NoError(t, object.ToGo(&object.Array{Values: []object.Object{integer(1), integer(2)}}, &ints))
+	assert.Equal(t, []int{1, 2}, ints)
+	assert.NoError(t, object.ToGo(object.NullValue, &ints))
+	assert.Nil(t, ints)
+
+	var pair [2]string
+	assert.NoError(t, object.ToGo(&object.Array{Values: []object.Object{str("a"), str("b")}}, &pair))
+	assert.Equal(t, [2]string{"a", "b"}, pair)
+
+	var m map[string]int
+	assert.NoError(t, object.ToGo(hash(str("a"), integer(1), str("b"), integer(2)), &m))
+	assert.Equal(t, map[string]int{"a": 1, "b": 2}, m)
+
+	var p point
+	assert.NoError(t, object.ToGo(hash(str("X"), integer(1), str("label"), str("p"), str("Hidden"), object.TrueValue), &p))
+	assert.Equal(t, point{X: 1, Label: "p"}, p)
+
+	var pp *point
+	assert.NoError(t, object.ToGo(hash(str("Y"), integer(2)), &pp))
+	assert.Equal(t, &point{Y: 2}, pp)
+
+	var any interface{}
+	assert.NoError(t, object.ToGo(&object.Array{Values: []object.Object{integer(1), &object.Float{Value: 1.5}, object.NullValue, hash(str("a"), object.FalseValue)}}, &any))
+	assert.Equal(t, []interface{}{int64(1), 1.5, nil, map[string]interface{}{"a": false}}, any)
+	assert.NoError(t, object.ToGo(hash(integer(1), str("one")), &any))
+	assert.Equal(t, map[interface{}]interface{}{int64(1): "one"}, any)
+
+	var obj object.Object
+	assert.NoError(t, object.ToGo(integer(1), &obj))
+	assert.Equal(t, integer(1), obj)
+
+	var arr *object.Array
+	assert.NoError(t, object.ToGo(&object.Array{}, &arr))
+	assert.Equal(t, &object.Array{}, arr)
+}
+
+func TestToGoErrors(t *testing.T) {
+	var i int8
+	var u uint
+	var s string
+	var ints []int
+	var pair [2]int
+	var m map[string]int
+
+	testCases := []struct {
+		input    object.Object
+		target   interface{}
+		expected string
+	}{
+		{integer(1), i, "ToGo: target must be a non-nil pointer, got int8"},
+		{integer(300), &i, "300 is out of range for int8"},
+		{integer(-1), &u, "-1 is out of range for uint"},
+		{&object.Float{Value: 1.5}, &i, "cannot convert FLOAT to int8"},
+		{integer(1), &s, "cannot convert INTEGER to string"},
+		{object.NullValue, &s, "cannot convert NULL to string"},
+		{&object.Array{Values: []object.Object{str("a")}}, &ints, "cannot convert STRING to int"},
+		{&object.Array{}, &pair, "cannot convert array of length 0 to [2]int"},
+		{hash(integer(1), integer(1)), &m, "cannot convert INTEGER to string"},
+	}
+
+	for _, testCase := range testCases {
+		err := object.ToGo(testCase.input, testCase.target)
+		assert.EqualError(t, err, testCase.expected, testCase.input.Inspect())
+	}
+}
+
+func TestNewBuiltin(t *testing.T) {
+	testCases := []struct {
+		fn       interface{}
+		args     []object.Object
+		expected object.Object
+	}{
+		{func(a, b int) int { return a + b }, []object.Object{integer(1), integer(2)}, integer(3)},
+		{func(s string, n int) string { return s + strconv.Itoa(n) }, []object.Object{str("a"), integer(1)}, str("a1")},
+		{func(xs ...float64) float64 { return xs[0] + xs[1] }, []object.Object{integer(1), &object.Float{Value: 0.5}}, &object.Float{Value: 1.5}},
+		{func(p point) []int { return []int{p.X, p.Y} }, []object.Object{hash(str("X"), integer(1), str("Y"), integer(2))}, &object.Array{Values: []object.Object{integer(1), integer(2)}}},
+		{func() {}, nil, nil},
+		{func() error { return nil }, nil, nil},
+		{strconv.Atoi, []object.Object{str("12")}, integer(12)},
+		{strconv.Atoi, []object.Object{str("x")}, &object.Error{Kind: object.GenericError, Message: `strconv.Atoi: parsing "x": invalid syntax`}},
+		{func() error { return &object.Error{Kind: object.ValueError, Message: "bad"} }, nil, &object.Error{Kind: object.ValueError, Message: "bad"}},
+		{func() error { return errors.New("failed") }, nil, &object.Error{Kind: object.GenericError, Message: "failed"}},
+		{func(a, b int) int { return a + b }, []object.Object{integer(1)}, &object.Error{Kind: object.ArgumentError, Message: "wrong number of arguments. got=1, want=2"}},
+		{func(s string, xs ...int) int { return 0 }, nil, &object.Error{Kind: object.ArgumentError, Message: "wrong number of arguments. got=0, want at least 1"}},
+		{func(a, b int) int { return a + b }, []object.Object{integer(1), str("2")}, &object.Error{Kind: object.TypeError, Message: "argument 2: cannot convert STRING to int"}},
+		{func() chan int { return nil }, nil, &object.Error{Kind: object.TypeError, Message: "cannot convert Go value of type chan int"}},
+		{func() int { var m map[string]int; m["x"] = 1; return 0 }, nil, &object.Error{Kind: object.RuntimeError, Message: "panic in Go function: assignment to entry in nil map"}},
+		{func(xs []int) int { return xs[3] }, []object.Object{&object.Array{}}, &object.Error{Kind: object.RuntimeError, Message: "panic in Go function: runtime error: index out of range [3] with length 0"}},
+		{func() *node { return cyclic() }, nil, &object.Error{Kind: object.ValueError, Message: "cannot convert Go value of type *object_test.node that contains itself"}},
+	}
+
+	for _, testCase := range testCases {
+		b, err := object.NewBuiltin(testCase.fn)
+		if assert.NoError(t, err) {
+			assert.Equal(t, testCase.expected, b.F(testCase.args...))
+		}
+	}
+
+	_, err := object.NewBuiltin(42)
+	assert.EqualError(t, err, "NewBuiltin: int is not a function")
+	assert.Panics(t, func() { object.MustBuiltin("x") })
+}
@@ -1,5 +1,9 @@
 package object
 
+import (
+	"github.com/makramkd/go-monkey/ast"
+)
+
 type ExecutionContext int
 
 const (
@@ -11,19 +15,54 @@ type Env struct {
 	store            map[string]Object
 	outer            *Env
 	executionContext ExecutionContext
+	runtime          *runtime
+}
+
+// runtime is the state shared by all the environments of a program.
+type runtime struct {
+	callStack CallStack
+	// checkedArithmetic makes integer overflow an error rather than
+	// wrapping around.
+	checkedArithmetic bool
+	// moduleLoader loads imported modules, if set.
+	moduleLoader ModuleLoader
+	// meter counts the steps of the program against its limits.
+	meter Meter
+	// prelude holds the definitions visible to the program and every module
+	// it imports.
+	prelude *Env
+	// modules are the modules imported so far, by key, and importing the
+	// keys of those being imported, outermost first.
+	modules   map[string]*Module
+	importing []string
+	// streams are the writers that builtins print to.
+	streams Streams
+	// osAccess lets builtins such as those of the os module use the
+	// operating system.
+	osAccess bool
+}
+
+// ModuleLoader loads the modules imported by programs.
+type ModuleLoader interface {
+	Load(name string) (*ast.Program, error)
 }
 
 func NewEnv() *Env {
-	return &Env{
-		store: map[string]Object{},
-		outer: nil,
+	r := &runtime{}
+	r.prelude = &Env{
+		store:   map[string]Object{},
+		outer:   nil,
+		runtime: r,
 	}
+	return NewScopedEnv(r.prelude)
 }
 
 func NewScopedEnv(outer *Env) *Env {
-	env := NewEnv()
-	env.outer = outer
-	return env
+	return &Env{
+		store:   map[string]Object{},
+		outer:   outer,
+		runtime: outer.runtime,
+	}
 }
 
 func (e *Env) Get(name string) (o Object, ok bool) {
@@ -39,6 +78,63 @@ func (e *Env) Set(name string, value Object) Object {
 	return value
 }
 
+// Names returns the names defined in the innermost scope of e.
+func (e *Env) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Assign updates an existing binding in the innermost scope that defines it.
+// It reports false if no scope defines the given name.
+func (e *Env) Assign(name string, value Object) (Object, bool) {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			env.store[name] = value
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// SetCheckedArithmetic sets whether integer overflow is reported as an error
+// in the program that e belongs to.
+func (e *Env) SetCheckedArithmetic(enabled bool) {
+	e.runtime.checkedArithmetic = enabled
+}
+
+func (e *Env) CheckedArithmetic() bool {
+	return e.runtime.checkedArithmetic
+}
+
+// SetOSAccess sets whether the program that e belongs to may use the
+// operating system, e.g to read environment variables or exit.
+func (e *Env) SetOSAccess(enabled bool) {
+	e.runtime.osAccess = enabled
+}
+
+func (e *Env) OSAccess() bool {
+	return e.runtime.osAccess
+}
+
+// CallStack returns the stack of function calls in progress in the program
+// that e belongs to.
+func (e *Env) CallStack() *CallStack {
+	return &e.runtime.callStack
+}
+
+// SetModuleLoader sets the loader of the modules imported by the program that
+// e belongs to. Without one, modules are loaded from the standard library.
+func (e *Env) SetModuleLoader(loader ModuleLoader) {
+	e.runtime.moduleLoader = loader
+}
+
+func (e *Env) ModuleLoader() ModuleLoader {
+	return e.runtime.moduleLoader
+}
+
 func (e *Env) SetExecutionContext(context ExecutionContext) {
 	e.executionContext = context
 }
@@ -46,3 +142,9 @@ func (e *Env) SetExecutionContext(context ExecutionContext) {
 func (e *Env) GetExecutionContext() ExecutionContext {
 	return e.executionContext
 }
+
+// Host returns what the program that e belongs to provides the builtins it
+// calls with.
+func (e *Env) Host() Host {
+	return Host{Streams: e.Streams(), Limits: e.Limits(), OSAccess: e.OSAccess()}
+}
@@ -0,0 +1,151 @@
+package object
+
+import "context"
+
+// Limits bound the resources a program may use, so that untrusted programs
+// can't run forever or exhaust memory. Zero fields impose no limit. Both
+// engines enforce them.
+type Limits struct {
+	// MaxSteps bounds the number of evaluation steps, roughly one per node of
+	// the program that is evaluated, or per instruction that the virtual
+	// machine runs.
+	MaxSteps int64
+	// MaxCallDepth bounds the number of function calls in progress, not
+	// counting tail calls.
+	MaxCallDepth int
+	// MaxStringLength bounds the length of strings, in bytes.
+	MaxStringLength int
+	// MaxArrayLength bounds the number of elements of arrays.
+	MaxArrayLength int
+	// MaxHashSize bounds the number of pairs in hashes.
+	MaxHashSize int
+}
+
+// CheckCallDepth returns an error if a program with depth function calls in
+// progress can't make another one.
+func (l Limits) CheckCallDepth(depth int) *Error {
+	if l.MaxCallDepth > 0 && depth >= l.MaxCallDepth {
+		return newError(LimitError, "maximum call depth exceeded: %d", l.MaxCallDepth)
+	}
+	return nil
+}
+
+// CheckStringLength returns an error if a string of n bytes would be longer
+// than l allows, so that strings can be checked before they are made.
+func (l Limits) CheckStringLength(n int) *Error {
+	return checkSize(n, l.MaxStringLength, "string length")
+}
+
+// CheckArrayLength returns an error if an array of n elements would be
+// longer than l allows, so that arrays can be checked before they are made.
+func (l Limits) CheckArrayLength(n int) *Error {
+	return checkSize(n, l.MaxArrayLength, "array length")
+}
+
+// CheckSize returns an error if obj is a string, array or hash larger than l
+// allows.
+func (l Limits) CheckSize(obj Object) *Error {
+	switch obj := obj.(type) {
+	case *String:
+		return l.CheckStringLength(len(obj.Value))
+	case *Array:
+		return l.CheckArrayLength(len(obj.Values))
+	case *Hash:
+		return checkSize(len(obj.Pairs), l.MaxHashSize, "hash size")
+	default:
+		return nil
+	}
+}
+
+func checkSize(size, max int, what string) *Error {
+	if max > 0 && size > max {
+		return newError(LimitError, "maximum %s exceeded: %d", what, max)
+	}
+	return nil
+}
+
+// contextCheckInterval is the number of steps between checks of whether the
+// context of a program is done, as checking on every step is comparatively
+// slow.
+const contextCheckInterval = 256
+
+// Meter counts the steps a program takes, stopping it once it takes more
+// than its limits allow or its context is done.
+type Meter struct {
+	limits Limits
+	ctx    context.Context
+	// steps is the number of steps taken since the context was set.
+	steps int64
+}
+
+func (m *Meter) SetLimits(limits Limits) {
+	m.limits = limits
+}
+
+func (m *Meter) Limits() Limits {
+	return m.limits
+}
+
+// SetContext sets the context of the program, which stops with an error once
+// ctx is done, and restarts the count of steps it has taken. A nil context
+// never stops the program.
+func (m *Meter) SetContext(ctx context.Context) {
+	m.ctx = ctx
+	m.steps = 0
+}
+
+func (m *Meter) Context() context.Context {
+	return m.ctx
+}
+
+// Step counts a step of the program. It returns an error if the program took
+// too many steps or its context is done.
+func (m *Meter) Step() *Error {
+	m.steps++
+	if m.limits.MaxSteps > 0 && m.steps > m.limits.MaxSteps {
+		return newError(LimitError, "maximum number of steps exceeded: %d", m.limits.MaxSteps)
+	}
+	if m.ctx != nil && m.steps%contextCheckInterval == 0 {
+		if err := m.ctx.Err(); err != nil {
+			return newError(LimitError, "evaluation stopped: %v", err)
+		}
+	}
+	return nil
+}
+
+// SetLimits sets the limits of the program that e belongs to.
+func (e *Env) SetLimits(limits Limits) {
+	e.runtime.meter.SetLimits(limits)
+}
+
+func (e *Env) Limits() Limits {
+	return e.runtime.meter.Limits()
+}
+
+// SetContext sets the context of the program that e belongs to, as
+// Meter.SetContext does.
+func (e *Env) SetContext(ctx context.Context) {
+	e.runtime.meter.SetContext(ctx)
+}
+
+func (e *Env) Context() context.Context {
+	return e.runtime.meter.Context()
+}
+
+// Step counts an evaluation step of the program that e belongs to. It returns
+// an error if the program took too many steps or its context is done.
+func (e *Env) Step() *Error {
+	return e.runtime.meter.Step()
+}
+
+// CheckCallDepth returns an error if the program that e belongs to can't make
+// another function call without exceeding its limits.
+func (e *Env) CheckCallDepth() *Error {
+	return e.Limits().CheckCallDepth(e.runtime.callStack.Depth())
+}
+
+// CheckSize returns an error if obj is a string, array or hash larger than the
+// limits of the program that e belongs to allow.
+func (e *Env) CheckSize(obj Object) *Error {
+	return e.Limits().CheckSize(obj)
+}
@@ -0,0 +1,76 @@
+package object
+
+import "strings"
+
+// Module is an imported module, whose members are the definitions made at
+// its top level.
+type Module struct {
+	Name string
+	Env  *Env
+}
+
+func (m *Module) Type() ObjectType { return MODULE }
+func (m *Module) Inspect() string  { return "<module " + m.Name + ">" }
+
+// Member returns the value of the top level definition name of the module.
+func (m *Module) Member(name string) (Object, bool) {
+	value, ok := m.Env.store[name]
+	return value, ok
+}
+
+// Exported reports whether the definition name can be used outside of the
+// module that makes it. Names starting with an underscore are private to
+// their module.
+func Exported(name string) bool {
+	return !strings.HasPrefix(name, "_")
+}
+
+// Prelude returns the environment holding the definitions visible to the
+// program that e belongs to and to every module it imports, e.g those made by
+// the host of the program.
+func (e *Env) Prelude() *Env {
+	return e.runtime.prelude
+}
+
+// NewModuleEnv returns the environment of a module imported by the program
+// that e belongs to. Modules only see the definitions of the prelude, not
+// those of the program importing them.
+func NewModuleEnv(e *Env) *Env {
+	return NewScopedEnv(e.runtime.prelude)
+}
+
+// ImportedModule returns the module imported under key by the program that e
+// belongs to, if it was imported already.
+func (e *Env) ImportedModule(key string) (*Module, bool) {
+	m, ok := e.runtime.modules[key]
+	return m, ok
+}
+
+// StartImport records that the module under key is being imported. It
+// returns an error if the module is already being imported, i.e modules
+// import each other.
+func (e *Env) StartImport(key string) *Error {
+	r := e.runtime
+	for i, k := range r.importing {
+		if k == key {
+			cycle := append(r.importing[i:len(r.importing):len(r.importing)], key)
+			return newError(ImportError, "import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	r.importing = append(r.importing, key)
+	return nil
+}
+
+// FinishImport records that the module under key was imported, or failed to
+// be if m is nil, in which case importing it again tries again.
+func (e *Env) FinishImport(key string, m *Module) {
+	r := e.runtime
+	r.importing = r.importing[:len(r.importing)-1]
+	if m == nil {
+		return
+	}
+	if r.modules == nil {
+		r.modules = map[string]*Module{}
+	}
+	r.modules[key] = m
+}
@@ -5,14 +5,18 @@ import (
 	"hash/fnv"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/makramkd/go-monkey/ast"
+	"github.com/makramkd/go-monkey/code"
+	"github.com/makramkd/go-monkey/token"
 )
 
 type ObjectType string
 
 const (
 	INTEGER      ObjectType = "INTEGER"
+	FLOAT        ObjectType = "FLOAT"
 	BOOLEAN      ObjectType = "BOOLEAN"
 	NULL         ObjectType = "NULL"
 	RETURN_VALUE ObjectType = "RETURN_VALUE"
@@ -23,6 +27,11 @@ const (
 	BUILTIN      ObjectType = "BUILTIN"
 	HASH         ObjectType = "HASH"
 	BREAK        ObjectType = "BREAK"
+	CONTINUE     ObjectType = "CONTINUE"
+	MODULE       ObjectType = "MODULE"
+
+	COMPILED_FUNCTION ObjectType = "COMPILED_FUNCTION"
+	CLOSURE           ObjectType = "CLOSURE"
 )
 
 type Object interface {
@@ -37,6 +46,34 @@ type Integer struct {
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 func (i *Integer) Type() ObjectType { return INTEGER }
 
+type Float struct {
+	Value float64
+}
+
+// Inspect always includes a decimal point or exponent so that floats can be
+// told apart from integers, e.g 2.0 rather than 2.
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+func (f *Float) Type() ObjectType { return FLOAT }
+
+// ToFloat returns the value of an integer or float as a float64, reporting
+// whether o is a number at all.
+func ToFloat(o Object) (float64, bool) {
+	switch o := o.(type) {
+	case *Integer:
+		return float64(o.Value), true
+	case *Float:
+		return o.Value, true
+	default:
+		return 0, false
+	}
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -49,6 +86,14 @@ type Null struct{}
 func (n *Null) Inspect() string  { return "null" }
 func (n *Null) Type() ObjectType { return NULL }
 
+// The true, false and null values are compared by identity, so every engine
+// and every conversion from Go uses these.
+var (
+	TrueValue  = &Boolean{Value: true}
+	FalseValue = &Boolean{Value: false}
+	NullValue  = &Null{}
+)
+
 type ReturnValue struct {
 	Value Object
 }
@@ -56,29 +101,127 @@ type ReturnValue struct {
 func (r *ReturnValue) Inspect() string  { return r.Value.Inspect() }
 func (r *ReturnValue) Type() ObjectType { return RETURN_VALUE }
 
+// ErrorKind classifies errors, so that programs catching them can tell them
+// apart.
+type ErrorKind string
+
+const (
+	GenericError    ErrorKind = "Error" // errors thrown by programs without a kind of their own
+	TypeError       ErrorKind = "TypeError"
+	NameError       ErrorKind = "NameError"
+	IndexError      ErrorKind = "IndexError"
+	ArithmeticError ErrorKind = "ArithmeticError"
+	ArgumentError   ErrorKind = "ArgumentError"
+	ValueError      ErrorKind = "ValueError"
+	ImportError     ErrorKind = "ImportError"
+	RuntimeError    ErrorKind = "RuntimeError"
+	// LimitError is raised when a program exceeds its limits or its context
+	// is done. It can't be caught by the program.
+	LimitError ErrorKind = "LimitError"
+	// ExitError ends a program that calls exit, with the status in the Code
+	// of the error. Neither catch nor finally blocks run for it.
+	ExitError ErrorKind = "ExitError"
+)
+
 type Error struct {
+	Kind    ErrorKind
 	Message string
+	Pos     token.Position // where in the source the error occurred, if known
+	// Stack holds the function calls that were in progress when the error
+	// occurred, outermost call first.
+	Stack []Frame
+	// Value is the value that was thrown, for errors raised by throw.
+	Value Object
+	// Code is the exit status of errors of kind ExitError.
+	Code int
+}
+
+func (e *Error) Inspect() string {
+	if e.Pos.IsValid() {
+		return "ERROR: " + e.Pos.String() + ": " + e.Message
+	}
+	return "ERROR: " + e.Message
 }
 
-func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+// Error implements the error interface so that runtime errors can be
+// returned as Go errors, e.g by the virtual machine.
+func (e *Error) Error() string {
+	if e.Pos.IsValid() {
+		return e.Pos.String() + ": " + e.Message
+	}
+	return e.Message
+}
 func (e *Error) Type() ObjectType { return ERROR }
 
+// Catchable reports whether programs can catch e with a try statement.
+func (e *Error) Catchable() bool {
+	return e.Kind != LimitError && e.Kind != ExitError
+}
+
+// NewThrownError creates the error raised by throwing value. A string is used
+// as the message. A hash can set the message and kind of the error with its
+// "message" and "kind" keys, so that caught errors can be thrown again.
+func NewThrownError(value Object) *Error {
+	err := &Error{Kind: GenericError, Message: value.Inspect(), Value: value}
+
+	switch value := value.(type) {
+	case *String:
+		err.Message = value.Value
+	case *Hash:
+		if message, ok := value.get("message").(*String); ok {
+			err.Message = message.Value
+		}
+		if kind, ok := value.get("kind").(*String); ok {
+			err.Kind = ErrorKind(kind.Value)
+		}
+	}
+
+	return err
+}
+
+// Caught returns the hash that a caught error is bound to, holding its
+// "kind", "message" and "position" and, for thrown errors, the thrown
+// "value".
+func (e *Error) Caught() *Hash {
+	kind := e.Kind
+	if kind == "" {
+		kind = GenericError
+	}
+
+	h := &Hash{Pairs: map[HashKey]HashPair{}}
+	h.set("kind", &String{Value: string(kind)})
+	h.set("message", &String{Value: e.Message})
+	h.set("position", &String{Value: e.Pos.String()})
+	if e.Value != nil {
+		h.set("value", e.Value)
+	}
+	return h
+}
+
 type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Env
+	// Name is the name the function was bound to with let, if any.
+	Name string
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION }
 func (f *Function) Inspect() string {
+	return InspectFunction(f.Parameters, f.Body)
+}
+
+// InspectFunction returns how a function with the given parameters and body
+// is printed, which is the same on both engines.
+func InspectFunction(parameters []*ast.Identifier, body *ast.BlockStatement) string {
 	builder := strings.Builder{}
 
 	builder.WriteString("fn(")
-	for _, param := range f.Parameters {
+	for _, param := range parameters {
 		builder.WriteString(param.String())
 	}
 	builder.WriteString(") {\n")
-	builder.WriteString(f.Body.String())
+	builder.WriteString(body.String())
 	builder.WriteString("\n}")
 	return builder.String()
 }
@@ -90,11 +233,92 @@ type String struct {
 func (s *String) Type() ObjectType { return STRING }
 func (s *String) Inspect() string  { return s.Value }
 
+// Len returns the number of chars in the string, i.e of Unicode code points
+// rather than bytes.
+func (s *String) Len() int {
+	return utf8.RuneCountInString(s.Value)
+}
+
+// At returns the char at index i, counted in code points, as a string.
+// Negative indexes count from the end of the string, as they do for arrays.
+// It reports false if i is out of range.
+func (s *String) At(i int64) (*String, bool) {
+	if i < 0 {
+		i += int64(s.Len())
+	}
+	if i < 0 {
+		return nil, false
+	}
+	for _, r := range s.Value {
+		if i == 0 {
+			return &String{Value: string(r)}, true
+		}
+		i--
+	}
+	return nil, false
+}
+
 type Array struct {
 	Values []Object
+	// spare is shared by the arrays created by Push and Rest whose values
+	// are stored in the same Go array, and holds the number of elements left
+	// unused at its end. Pushing onto the longest of them appends in place
+	// rather than copying. Arrays that may share their storage are copied
+	// before being modified.
+	spare *int
 }
 
 func (a *Array) Type() ObjectType { return ARRAY }
+
+// Set sets the element at position i, which must be in range.
+func (a *Array) Set(i int, value Object) {
+	if a.spare != nil {
+		values := make([]Object, len(a.Values))
+		copy(values, a.Values)
+		a.Values, a.spare = values, nil
+	}
+	a.Values[i] = value
+}
+
+// Push returns a new array with value appended to the elements of a, which
+// takes amortized constant time.
+func (a *Array) Push(value Object) *Array {
+	n := len(a.Values)
+	if a.spare != nil && *a.spare > 0 && cap(a.Values)-n == *a.spare {
+		*a.spare--
+		return &Array{Values: append(a.Values, value), spare: a.spare}
+	}
+
+	values := make([]Object, n+1, 2*n+1)
+	copy(values, a.Values)
+	values[n] = value
+	spare := cap(values) - len(values)
+	return &Array{Values: values, spare: &spare}
+}
+
+// Rest returns a new array with the elements of a but the first, which must
+// exist. It takes constant time.
+func (a *Array) Rest() *Array {
+	if a.spare == nil {
+		spare := cap(a.Values) - len(a.Values)
+		a.spare = &spare
+	}
+	return &Array{Values: a.Values[1:], spare: a.spare}
+}
+
+// Position returns the position of the element at index i. Negative indexes
+// count from the end of the array, e.g -1 is the last element. It reports
+// false if i is out of range.
+func (a *Array) Position(i int64) (int, bool) {
+	n := int64(len(a.Values))
+	if i < 0 {
+		i += n
+	}
+	if i < 0 || i >= n {
+		return 0, false
+	}
+	return int(i), true
+}
 func (a *Array) Inspect() string {
 	elems := []string{}
 	for _, e := range a.Values {
@@ -111,6 +335,27 @@ type BuiltinFunction func(args ...Object) Object
 
 type Builtin struct {
 	F BuiltinFunction
+	// Hosted, if set, is called instead of F by programs, with the streams
+	// that the program prints to, its limits and whether it may use the
+	// operating system.
+	Hosted func(host Host, args ...Object) Object
+}
+
+// Host is what the program calling a builtin provides it with.
+type Host struct {
+	Streams Streams
+	Limits  Limits
+	// OSAccess is set if the program may use the operating system, e.g to
+	// read environment variables or exit.
+	OSAccess bool
+}
+
+// Call calls the builtin with args on behalf of the program host.
+func (b *Builtin) Call(host Host, args ...Object) Object {
+	if b.Hosted != nil {
+		return b.Hosted(host, args...)
+	}
+	return b.F(args...)
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN }
@@ -158,6 +403,16 @@ type Hash struct {
 }
 
 func (h *Hash) Type() ObjectType { return HASH }
+
+// get returns the value of a string key, or nil if it isn't set.
+func (h *Hash) get(key string) Object {
+	return h.Pairs[(&String{Value: key}).HashKey()].Value
+}
+
+func (h *Hash) set(key string, value Object) {
+	k := &String{Value: key}
+	h.Pairs[k.HashKey()] = HashPair{Key: k, Value: value}
+}
 func (h *Hash) Inspect() string {
 	builder := strings.Builder{}
 
@@ -176,3 +431,43 @@ type Break struct{}
 
 func (b *Break) Inspect() string  { return "break" }
 func (b *Break) Type() ObjectType { return BREAK }
+
+type Continue struct{}
+
+func (c *Continue) Inspect() string  { return "continue" }
+func (c *Continue) Type() ObjectType { return CONTINUE }
+
+// CompiledFunction is a function that has been compiled to bytecode.
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+	// Name is the name the function was bound to with let, if any.
+	Name string
+	// Positions maps instruction offsets to the source position they were
+	// compiled from, so that runtime errors can be reported where they occur.
+	Positions map[int]token.Position
+	// Source is how the function is printed, as made by InspectFunction, or
+	// "" for functions that weren't compiled from a function literal, e.g
+	// modules.
+	Source string
+}
+
+func (c *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION }
+
+func (c *CompiledFunction) Inspect() string {
+	if c.Source == "" {
+		return "compiled function"
+	}
+	return c.Source
+}
+
+// Closure is a compiled function along with the free variables it captured
+// when it was created.
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+func (c *Closure) Type() ObjectType { return CLOSURE }
+func (c *Closure) Inspect() string  { return c.Fn.Inspect() }
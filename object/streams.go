@@ -0,0 +1,36 @@
+package object
+
+import (
+	"io"
+	"os"
+)
+
+// Streams are the writers that builtins such as puts print to.
+type Streams struct {
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// DefaultStreams returns the streams of the process, os.Stdout and
+// os.Stderr.
+func DefaultStreams() Streams {
+	return Streams{Stdout: os.Stdout, Stderr: os.Stderr}
+}
+
+// SetStreams sets the writers that the program that e belongs to prints to.
+func (e *Env) SetStreams(streams Streams) {
+	e.runtime.streams = streams
+}
+
+// Streams returns the writers that the program that e belongs to prints to,
+// which default to those of the process.
+func (e *Env) Streams() Streams {
+	s := e.runtime.streams
+	if s.Stdout == nil {
+		s.Stdout = os.Stdout
+	}
+	if s.Stderr == nil {
+		s.Stderr = os.Stderr
+	}
+	return s
+}
@@ -0,0 +1,126 @@
+package object
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/makramkd/go-monkey/token"
+)
+
+// Frame is a function call that is in progress.
+type Frame struct {
+	Function string         // the name of the called function, or "" if it is anonymous
+	Pos      token.Position // where the function was called from
+}
+
+func (f Frame) name() string {
+	if f.Function == "" {
+		return "<anonymous>"
+	}
+	return f.Function
+}
+
+// CallStack keeps track of the function calls in progress while a program is
+// evaluated, outermost call first.
+type CallStack struct {
+	entries []stackEntry
+	// depth is the number of calls in progress that weren't tail calls.
+	depth int
+}
+
+type stackEntry struct {
+	frame Frame
+	// repeats is the number of tail calls that repeated the frame, e.g those
+	// of a function calling itself, which are stored once to save memory.
+	repeats int
+	tail    bool
+}
+
+func (s *CallStack) Push(f Frame) {
+	s.entries = append(s.entries, stackEntry{frame: f})
+	s.depth++
+}
+
+// PushTail pushes the frame of a tail call, which is made once the function
+// it is in has returned, so it doesn't count toward the depth of the stack.
+func (s *CallStack) PushTail(f Frame) {
+	if n := len(s.entries); n > 0 && s.entries[n-1].frame == f {
+		s.entries[n-1].repeats++
+		return
+	}
+	s.entries = append(s.entries, stackEntry{frame: f, tail: true})
+}
+
+// Pop pops the frame pushed last, by either Push or PushTail.
+func (s *CallStack) Pop() {
+	top := &s.entries[len(s.entries)-1]
+	if top.repeats > 0 {
+		top.repeats--
+		return
+	}
+	if !top.tail {
+		s.depth--
+	}
+	s.entries = s.entries[:len(s.entries)-1]
+}
+
+// Depth returns the number of calls in progress, not counting tail calls.
+func (s *CallStack) Depth() int {
+	return s.depth
+}
+
+// Frames returns a copy of the frames currently on the stack, including
+// those of tail calls, or nil if there are none.
+func (s *CallStack) Frames() []Frame {
+	if len(s.entries) == 0 {
+		return nil
+	}
+	frames := make([]Frame, 0, len(s.entries))
+	for _, e := range s.entries {
+		for i := 0; i <= e.repeats; i++ {
+			frames = append(frames, e.frame)
+		}
+	}
+	return frames
+}
+
+// Traceback describes the calls that led to the error, most recent call
+// last, with one line per position: the call sites followed by the position
+// of the error itself. Runs of three or more identical lines, as left by
+// recursive calls, are collapsed. It returns an empty string if the error
+// didn't happen inside a function.
+func (e *Error) Traceback() string {
+	if len(e.Stack) == 0 {
+		return ""
+	}
+
+	lines := make([]string, 0, len(e.Stack)+1)
+	caller := "<main>"
+	for _, frame := range e.Stack {
+		// Functions called from Go, rather than Monkey code, have no call site.
+		if frame.Pos.IsValid() {
+			lines = append(lines, fmt.Sprintf("  %s: in %s", frame.Pos, caller))
+		}
+		caller = frame.name()
+	}
+	lines = append(lines, fmt.Sprintf("  %s: in %s", e.Pos, caller))
+
+	b := strings.Builder{}
+	b.WriteString("Traceback (most recent call last):\n")
+	for i := 0; i < len(lines); {
+		b.WriteString(lines[i])
+		b.WriteByte('\n')
+
+		repeats := 0
+		for i+1+repeats < len(lines) && lines[i+1+repeats] == lines[i] {
+			repeats++
+		}
+		if repeats < 2 {
+			i++
+			continue
+		}
+		fmt.Fprintf(&b, "  [previous line repeated %d more times]\n", repeats)
+		i += 1 + repeats
+	}
+	return b.String()
+}
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/makramkd/go-monkey/ast"
 	"github.com/makramkd/go-monkey/token"
@@ -12,7 +13,8 @@ import (
 // appropriate expression and return an AST node that represents it.
 // Each token type can have up to two parsing functions associated with it, depending
 // on whether the token is found in a prefix or infix position.
-// TODO: what about postfix?
+// Postfix operators are parsed by infix parsing functions that don't consume
+// a right hand side.
 type prefixParseFunc func() ast.Expression
 type infixParseFunc func(ast.Expression) ast.Expression
 
@@ -21,6 +23,7 @@ type operatorPrecedence int
 const (
 	_ operatorPrecedence = iota
 	LOWEST
+	ASSIGN      // =, +=, -=, *=, /=, %=
 	OR          // ||
 	AND         // &&
 	EQUALS      // ==, !=
@@ -29,6 +32,7 @@ const (
 	PRODUCT     // *, /, or %
 	POWER       // **
 	PREFIX      // -X, !X, --X, ++X
+	POSTFIX     // X++, X--
 	CALL        // function(X), array[i]
 )
 
@@ -36,6 +40,13 @@ const (
 // In the case where we have a prefix expression or function call expression, it's parsing method should
 // ensure that the higher priority is applied.
 var precedenceTable = map[token.Type]operatorPrecedence{
+	token.ASSIGN:   ASSIGN,
+	token.INCR:     ASSIGN,
+	token.DECR:     ASSIGN,
+	token.TIMES_EQ: ASSIGN,
+	token.DIV_EQ:   ASSIGN,
+	token.REM_EQ:   ASSIGN,
+
 	token.EQUAL:     EQUALS,
 	token.NOT_EQUAL: EQUALS,
 
@@ -56,13 +67,28 @@ var precedenceTable = map[token.Type]operatorPrecedence{
 
 	token.POWER: POWER,
 
+	token.INCR_ONE: POSTFIX,
+	token.DECR_ONE: POSTFIX,
+
 	token.LPAREN: CALL,
 	token.LBRACK: CALL,
+	token.PERIOD: CALL,
+}
+
+// Precedence returns the precedence of the binary, postfix, call or index
+// operator t, which binds tighter the higher it is, or LOWEST if t isn't
+// such an operator.
+func Precedence(t token.Type) int {
+	if p, ok := precedenceTable[t]; ok {
+		return int(p)
+	}
+	return int(LOWEST)
 }
 
 func (p *Parser) registerPrefixes() {
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	for _, tokType := range []token.Type{token.TRUE, token.FALSE} {
 		p.registerPrefix(tokType, p.parseBooleanLiteral)
 	}
@@ -89,8 +115,18 @@ func (p *Parser) registerInfixes() {
 	for _, tokType := range infixOperators {
 		p.registerInfix(tokType, p.parseInfixExpression)
 	}
+	assignmentOperators := []token.Type{
+		token.ASSIGN, token.INCR, token.DECR, token.TIMES_EQ, token.DIV_EQ, token.REM_EQ,
+	}
+	for _, tokType := range assignmentOperators {
+		p.registerInfix(tokType, p.parseAssignExpression)
+	}
+	for _, tokType := range []token.Type{token.INCR_ONE, token.DECR_ONE} {
+		p.registerInfix(tokType, p.parsePostfixExpression)
+	}
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACK, p.parseIndexAccessExpression)
+	p.registerInfix(token.PERIOD, p.parseMemberExpression)
 }
 
 func (p *Parser) nextToken() {
@@ -115,10 +151,49 @@ func (p *Parser) curTokenIs(t token.Type) bool {
 	return p.curToken.T == t
 }
 
+// Error is a syntax error along with the position in the source at which it
+// was found.
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e *Error) Error() string {
+	if e.Pos.IsValid() {
+		return e.Pos.String() + ": " + e.Msg
+	}
+	return e.Msg
+}
+
+func (p *Parser) errorf(pos token.Position, format string, args ...interface{}) {
+	p.errors = append(p.errors, &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}
+
 func (p *Parser) peekError(t token.Type) {
-	p.errors = append(
-		p.errors,
-		fmt.Errorf("expected next token to be '%s', got '%s' instead", t, p.peekToken.T))
+	if p.peekToken.T == token.ILLEGAL {
+		p.illegalError(p.peekToken)
+		return
+	}
+	p.errorf(p.peekToken.Pos, "expected next token to be '%s', got '%s' instead", t, p.peekToken.T)
+}
+
+// illegalError reports tok, which the lexer couldn't make sense of, unless it
+// was just reported, e.g as the next token.
+func (p *Parser) illegalError(tok token.Token) {
+	if n := len(p.errors); n > 0 && p.errors[n-1].(*Error).Pos == tok.Pos {
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(tok.Literal, "/*"):
+		p.errorf(tok.Pos, "unterminated comment")
+	case strings.HasPrefix(tok.Literal, `"`), strings.HasPrefix(tok.Literal, "`"):
+		p.errorf(tok.Pos, "unterminated string literal")
+	case strings.HasPrefix(tok.Literal, `\`) && len(tok.Literal) > 1:
+		p.errorf(tok.Pos, "invalid escape sequence %s", tok.Literal)
+	default:
+		p.errorf(tok.Pos, "illegal character %q", tok.Literal)
+	}
 }
 
 func (p *Parser) registerPrefix(t token.Type, f prefixParseFunc) {
@@ -130,7 +205,11 @@ func (p *Parser) registerInfix(t token.Type, f infixParseFunc) {
 }
 
 func (p *Parser) noPrefixParseFuncError(t token.Type) {
-	p.errors = append(p.errors, fmt.Errorf("no prefix parse function found for '%s'", t))
+	if t == token.ILLEGAL {
+		p.illegalError(p.curToken)
+		return
+	}
+	p.errorf(p.curToken.Pos, "no prefix parse function found for '%s'", t)
 }
 
 func (p *Parser) peekPrecedence() operatorPrecedence {
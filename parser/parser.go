@@ -1,7 +1,6 @@
 package parser
 
 import (
-	"fmt"
 	"strconv"
 
 	"github.com/makramkd/go-monkey/ast"
@@ -65,9 +64,20 @@ func (p *Parser) parseStatement() ast.Statement {
 	case token.IMPORT:
 		return p.parseImportStatement()
 	case token.FOR:
+		if p.peekTokenIs(token.LPAREN) {
+			return p.parseForStatement()
+		}
 		return p.parseForEachStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
 	case token.BREAK:
 		return p.parseBreakStatement()
+	case token.CONTINUE:
+		return p.parseContinueStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.TRY:
+		return p.parseTryStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -83,6 +93,148 @@ func (p *Parser) parseBreakStatement() *ast.BreakStatement {
 	return stmt
 }
 
+func (p *Parser) parseContinueStatement() *ast.ContinueStatement {
+	stmt := &ast.ContinueStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.SEMICOLON) {
+		return nil
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.SEMICOLON) {
+		return nil
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseTryStatement() *ast.TryStatement {
+	stmt := &ast.TryStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.CatchParam = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		stmt.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		stmt.Finally = p.parseBlockStatement()
+	}
+
+	if stmt.Catch == nil && stmt.Finally == nil {
+		p.errorf(stmt.Token.Pos, "expected catch or finally after try block")
+		return nil
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+
+	return stmt
+}
+
+func (p *Parser) parseForStatement() *ast.ForStatement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	// Skip over the '('.
+	p.nextToken()
+
+	// The init clause is either a let statement, which consumes its own
+	// semicolon, or an expression.
+	p.nextToken()
+	switch p.curToken.T {
+	case token.SEMICOLON:
+	case token.LET:
+		init := p.parseLetStatement()
+		if init == nil {
+			return nil
+		}
+		stmt.Init = init
+	default:
+		init := &ast.ExpressionStatement{Token: p.curToken, Expression: p.parseExpression(LOWEST)}
+		if !p.expectPeek(token.SEMICOLON) {
+			return nil
+		}
+		stmt.Init = init
+	}
+
+	if !p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+		stmt.Condition = p.parseExpression(LOWEST)
+	}
+	if !p.expectPeek(token.SEMICOLON) {
+		return nil
+	}
+
+	if !p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		stmt.Step = p.parseExpression(LOWEST)
+	}
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+
+	return stmt
+}
+
 func (p *Parser) parseForEachStatement() *ast.ForEachStatement {
 	stmt := &ast.ForEachStatement{Token: p.curToken}
 
@@ -143,11 +295,37 @@ func (p *Parser) parseForCollection() ast.Expression {
 func (p *Parser) parseImportStatement() *ast.ImportStatement {
 	stmt := &ast.ImportStatement{Token: p.curToken}
 
-	if !p.expectPeek(token.IDENT) {
+	// Standard modules are imported by name, files by path.
+	switch p.peekToken.T {
+	case token.IDENT:
+		p.nextToken()
+		stmt.Module = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	case token.STRING:
+		p.nextToken()
+		stmt.Path = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+	default:
+		p.errorf(p.peekToken.Pos, "expected next token to be '%s' or '%s', got '%s' instead", token.IDENT, token.STRING, p.peekToken.T)
 		return nil
 	}
 
-	stmt.Module = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	// 'as' is only special here, so it can still be used as an identifier.
+	if p.peekTokenIs(token.IDENT) && p.peekToken.Literal == "as" {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Alias = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	} else if p.peekTokenIs(token.LPAREN) {
+		p.nextToken()
+		stmt.Names = p.parseFunctionParameters()
+		if stmt.Names == nil {
+			return nil
+		}
+		if len(stmt.Names) == 0 {
+			p.errorf(p.curToken.Pos, "expected names to import")
+			return nil
+		}
+	}
 
 	if !p.expectPeek(token.SEMICOLON) {
 		return nil
@@ -194,6 +372,10 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	letStmt.Value = p.parseExpression(LOWEST)
 
+	if fn, ok := letStmt.Value.(*ast.FunctionLiteral); ok {
+		fn.Name = letStmt.Name.Value
+	}
+
 	if !p.expectPeek(token.SEMICOLON) {
 		return nil
 	}
@@ -252,7 +434,20 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
-		p.errors = append(p.errors, fmt.Errorf("could not parse %q as integer: %v", p.curToken.Literal, err))
+		p.errorf(p.curToken.Pos, "could not parse %q as integer: %v", p.curToken.Literal, err)
+		return nil
+	}
+
+	lit.Value = value
+	return lit
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		p.errorf(p.curToken.Pos, "could not parse %q as float: %v", p.curToken.Literal, err)
 		return nil
 	}
 
@@ -265,7 +460,7 @@ func (p *Parser) parseBooleanLiteral() ast.Expression {
 
 	value, err := strconv.ParseBool(p.curToken.Literal)
 	if err != nil {
-		p.errors = append(p.errors, fmt.Errorf("could not parse %q as bool: %v", p.curToken.Literal, err))
+		p.errorf(p.curToken.Pos, "could not parse %q as bool: %v", p.curToken.Literal, err)
 		return nil
 	}
 
@@ -331,6 +526,51 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return exp
 }
 
+func (p *Parser) parsePostfixExpression(left ast.Expression) ast.Expression {
+	if !p.checkAssignable(left) {
+		return nil
+	}
+
+	return &ast.PostfixExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+		Left:     left,
+	}
+}
+
+func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
+	if !p.checkAssignable(left) {
+		return nil
+	}
+
+	exp := &ast.AssignExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+		Target:   left,
+	}
+
+	p.nextToken()
+
+	// Assignment is right associative, i.e a = b = c is a = (b = c).
+	exp.Value = p.parseExpression(LOWEST)
+
+	return exp
+}
+
+// checkAssignable reports whether the given expression can be assigned to,
+// recording an error if it can't.
+func (p *Parser) checkAssignable(target ast.Expression) bool {
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexAccessExpression:
+		return true
+	default:
+		if target != nil {
+			p.errorf(target.Pos(), "cannot assign to %s", target.String())
+		}
+		return false
+	}
+}
+
 func (p *Parser) parseGroupedExpression() ast.Expression {
 	p.nextToken()
 
@@ -463,6 +703,21 @@ func (p *Parser) parseIndexAccessExpression(array ast.Expression) ast.Expression
 	return accessExpr
 }
 
+func (p *Parser) parseMemberExpression(left ast.Expression) ast.Expression {
+	memberExpr := &ast.MemberExpression{
+		Token: p.curToken,
+		Left:  left,
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	memberExpr.Member = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	return memberExpr
+}
+
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	callExpr := &ast.CallExpression{
 		Token:    p.curToken,
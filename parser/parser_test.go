@@ -2,6 +2,7 @@ package parser_test
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/makramkd/go-monkey/ast"
@@ -22,6 +23,7 @@ let helloWorld = 5 * 3 + 4;
 	p := parser.New(l)
 
 	program := p.ParseProgram()
+	clearPositions(program)
 	assert.NotNil(t, program)
 	assert.Len(t, program.Statements, 4)
 	assert.Empty(t, p.Errors())
@@ -136,6 +138,32 @@ func TestIntegerLiteral(t *testing.T) {
 	assert.Equal(t, "5", literal.TokenLiteral())
 }
 
+func TestFloatLiteral(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{"1e-9;", 1e-9},
+		{"2.5E3;", 2500},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.New(testCase.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		assert.Empty(t, p.Errors())
+		if assert.Len(t, program.Statements, 1) {
+			stmt := program.Statements[0].(*ast.ExpressionStatement)
+			if assert.IsType(t, &ast.FloatLiteral{}, stmt.Expression) {
+				literal := stmt.Expression.(*ast.FloatLiteral)
+				assert.Equal(t, testCase.expected, literal.Value)
+				assert.Equal(t, testCase.input[:len(testCase.input)-1], literal.TokenLiteral())
+			}
+		}
+	}
+}
+
 func TestPrefixExpressions(t *testing.T) {
 	testCases := []struct {
 		input    string
@@ -152,6 +180,7 @@ func TestPrefixExpressions(t *testing.T) {
 		l := lexer.New(testCase.input)
 		p := parser.New(l)
 		program := p.ParseProgram()
+		clearPositions(program)
 		assert.Empty(t, p.Errors())
 		assert.Len(t, program.Statements, 1)
 		assert.IsType(t, &ast.ExpressionStatement{}, program.Statements[0])
@@ -234,6 +263,17 @@ func TestPrecedence(t *testing.T) {
 		{"a && b || c", "((a && b) || c)"},
 		{"a || b && c", "(a || (b && c))"},
 		{"a[0](1, 2)", "((a[0])(1,2))"},
+		{"a = b = c", "(a = (b = c))"},
+		{"a += b * c", "(a += (b * c))"},
+		{"a = b || c", "(a = (b || c))"},
+		{"-a++", "(-(a++))"},
+		{"a++ + b--", "((a++) + (b--))"},
+		{"a = b++", "(a = (b++))"},
+		{"a[0] = b[1] + 1", "((a[0]) = ((b[1]) + 1))"},
+		{"h[a][b] += 1", "(((h[a])[b]) += 1)"},
+		{"a[i]++", "((a[i])++)"},
+		{"u.f(1) + 1", "(((u.f)(1)) + 1)"},
+		{"-u.x[0]", "(-((u.x)[0]))"},
 	}
 
 	for _, testCase := range testCases {
@@ -246,12 +286,116 @@ func TestPrecedence(t *testing.T) {
 	}
 }
 
+func TestAssignExpressions(t *testing.T) {
+	testCases := []struct {
+		input    string
+		operator string
+		value    int64
+	}{
+		{"a = 5;", "=", 5},
+		{"a += 5;", "+=", 5},
+		{"a -= 5;", "-=", 5},
+		{"a *= 5;", "*=", 5},
+		{"a /= 5;", "/=", 5},
+		{"a %= 5;", "%=", 5},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.New(testCase.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		clearPositions(program)
+		assert.Empty(t, p.Errors())
+		assert.Equal(t, &ast.Program{
+			Statements: []ast.Statement{
+				&ast.ExpressionStatement{
+					Token: token.Token{T: token.IDENT, Literal: "a"},
+					Expression: &ast.AssignExpression{
+						Token:    token.Token{T: token.Type(testCase.operator), Literal: testCase.operator},
+						Target:   &ast.Identifier{Token: token.Token{T: token.IDENT, Literal: "a"}, Value: "a"},
+						Operator: testCase.operator,
+						Value: &ast.IntegerLiteral{
+							Token: token.Token{T: token.INT, Literal: fmt.Sprintf("%d", testCase.value)},
+							Value: testCase.value,
+						},
+					},
+				},
+			},
+		}, program)
+	}
+}
+
+func TestPostfixExpressions(t *testing.T) {
+	for _, operator := range []string{"++", "--"} {
+		l := lexer.New("a" + operator + ";")
+		p := parser.New(l)
+		program := p.ParseProgram()
+		clearPositions(program)
+		assert.Empty(t, p.Errors())
+		assert.Equal(t, &ast.Program{
+			Statements: []ast.Statement{
+				&ast.ExpressionStatement{
+					Token: token.Token{T: token.IDENT, Literal: "a"},
+					Expression: &ast.PostfixExpression{
+						Token:    token.Token{T: token.Type(operator), Literal: operator},
+						Left:     &ast.Identifier{Token: token.Token{T: token.IDENT, Literal: "a"}, Value: "a"},
+						Operator: operator,
+					},
+				},
+			},
+		}, program)
+	}
+}
+
+func TestAssignExpressionsError(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"5 = 3;", "1:1: cannot assign to 5"},
+		{"a + b = c;", "1:1: cannot assign to (a + b)"},
+		{"f() += 1;", "1:1: cannot assign to (f())"},
+		{"f()++;", "1:1: cannot assign to (f())"},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.New(testCase.input)
+		p := parser.New(l)
+		p.ParseProgram()
+		if assert.NotEmpty(t, p.Errors()) {
+			assert.EqualError(t, p.Errors()[0], testCase.expected)
+		}
+	}
+}
+
+func TestUnicodeErrorPositions(t *testing.T) {
+	// Columns count chars, whatever the number of bytes they are encoded in.
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"let 名前 = ;", "1:10: no prefix parse function found for ';'"},
+		{`let naïve = "日本" 1;`, "1:18: expected next token to be ';', got 'INT' instead"},
+		{"имя.1", "1:5: expected next token to be 'IDENT', got 'INT' instead"},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.New(testCase.input)
+		p := parser.New(l)
+		p.ParseProgram()
+		if assert.NotEmpty(t, p.Errors()) {
+			assert.EqualError(t, p.Errors()[0], testCase.expected)
+		}
+	}
+}
+
 func TestIfExpression(t *testing.T) {
 	input := `if (x < y) { x + y; y - x; x**2; } else { x + y; }`
 
 	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.ParseProgram()
+	clearPositions(program)
 	assert.Empty(t, p.Errors())
 	assert.Len(t, program.Statements, 1)
 
@@ -356,6 +500,7 @@ func TestFunctionLiteral(t *testing.T) {
 	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.ParseProgram()
+	clearPositions(program)
 	assert.Empty(t, p.Errors())
 	assert.Len(t, program.Statements, 1)
 	assert.IsType(t, &ast.ExpressionStatement{}, program.Statements[0])
@@ -405,6 +550,7 @@ func TestCallExpression(t *testing.T) {
 	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.ParseProgram()
+	clearPositions(program)
 	assert.Empty(t, p.Errors())
 	assert.Len(t, program.Statements, 1)
 
@@ -449,6 +595,7 @@ func TestStringLiteralExpressions(t *testing.T) {
 		l := lexer.New(testCase.input)
 		p := parser.New(l)
 		program := p.ParseProgram()
+		clearPositions(program)
 		assert.Empty(t, p.Errors())
 		assert.IsType(t, &ast.ExpressionStatement{}, program.Statements[0])
 		exprStmt := program.Statements[0].(*ast.ExpressionStatement)
@@ -495,6 +642,7 @@ func TestArrayLiteralExpressions(t *testing.T) {
 		l := lexer.New(testCase.input)
 		p := parser.New(l)
 		program := p.ParseProgram()
+		clearPositions(program)
 		assert.Empty(t, p.Errors())
 		assert.IsType(t, &ast.ExpressionStatement{}, program.Statements[0])
 		exprStmt := program.Statements[0].(*ast.ExpressionStatement)
@@ -531,6 +679,7 @@ func TestArrayAccessExpressions(t *testing.T) {
 		l := lexer.New(testCase.input)
 		p := parser.New(l)
 		program := p.ParseProgram()
+		clearPositions(program)
 		assert.Empty(t, p.Errors())
 		assert.IsType(t, &ast.ExpressionStatement{}, program.Statements[0])
 		exprStmt := program.Statements[0].(*ast.ExpressionStatement)
@@ -539,7 +688,48 @@ func TestArrayAccessExpressions(t *testing.T) {
 }
 
 func TestParseImportStatements(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"import functools;", "import functools;"},
+		{"import functools as f;", "import functools as f;"},
+		{`import "./lib/util";`, `import "./lib/util";`},
+		{`import "./lib/util" as u;`, `import "./lib/util" as u;`},
+		{"import functools (map, filter);", "import functools (map, filter);"},
+		{`import "./lib/util" (helper);`, `import "./lib/util" (helper);`},
+		{"let as = 1;", "let as = 1;"},
+	}
 
+	for _, testCase := range testCases {
+		l := lexer.New(testCase.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		assert.Empty(t, p.Errors())
+		assert.Equal(t, testCase.expected, program.String())
+	}
+
+	errorCases := []struct {
+		input    string
+		expected string
+	}{
+		{"import 1;", "1:8: expected next token to be 'IDENT' or 'STRING', got 'INT' instead"},
+		{`import "./util" as;`, "1:19: expected next token to be 'IDENT', got ';' instead"},
+		{`import "./util" u;`, "1:17: expected next token to be ';', got 'IDENT' instead"},
+		{"import functools ();", "1:19: expected names to import"},
+		{"import functools (map, 1);", "1:24: expected next token to be 'IDENT', got 'INT' instead"},
+		{"import functools as f (map);", "1:23: expected next token to be ';', got '(' instead"},
+		{"u.1", "1:3: expected next token to be 'IDENT', got 'INT' instead"},
+	}
+
+	for _, testCase := range errorCases {
+		l := lexer.New(testCase.input)
+		p := parser.New(l)
+		p.ParseProgram()
+		if assert.NotEmpty(t, p.Errors()) {
+			assert.EqualError(t, p.Errors()[0], testCase.expected)
+		}
+	}
 }
 
 func TestHashLiteralExpressions(t *testing.T) {
@@ -680,6 +870,7 @@ func TestForEachStatements(t *testing.T) {
 		l := lexer.New(test.input)
 		p := parser.New(l)
 		program := p.ParseProgram()
+		clearPositions(program)
 		assert.Empty(t, p.Errors())
 		assert.IsType(t, &ast.ForEachStatement{}, program.Statements[0])
 		forEachStmt := program.Statements[0].(*ast.ForEachStatement)
@@ -689,3 +880,212 @@ func TestForEachStatements(t *testing.T) {
 		assert.Equal(t, test.expected.Body, forEachStmt.Body)
 	}
 }
+
+func TestWhileStatements(t *testing.T) {
+	l := lexer.New("while (x) { continue; }")
+	p := parser.New(l)
+	program := p.ParseProgram()
+	clearPositions(program)
+	assert.Empty(t, p.Errors())
+	assert.Equal(t, &ast.Program{
+		Statements: []ast.Statement{
+			&ast.WhileStatement{
+				Token: token.New(token.WHILE, "while"),
+				Condition: &ast.Identifier{
+					Token: token.New(token.IDENT, "x"),
+					Value: "x",
+				},
+				Body: &ast.BlockStatement{
+					Token: token.New(token.LBRACE, "{"),
+					Statements: []ast.Statement{
+						&ast.ContinueStatement{Token: token.New(token.CONTINUE, "continue")},
+					},
+				},
+			},
+		},
+	}, program)
+}
+
+func TestTryStatements(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{`throw "bad record";`, "throw bad record;"},
+		{`throw {"message": x};`, "throw {message:x};"},
+		{"try { x; } catch (e) { y; }", "try x catch (e) y"},
+		{"try { x; } finally { z; }", "try x finally z"},
+		{"try { x; } catch (e) { y; } finally { z; }", "try x catch (e) y finally z"},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.New(testCase.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		assert.Empty(t, p.Errors())
+		assert.Equal(t, testCase.expected, program.String())
+	}
+}
+
+func TestTryStatementsError(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"try { x; }", "1:1: expected catch or finally after try block"},
+		{"try { x; } catch { y; }", "1:18: expected next token to be '(', got '{' instead"},
+		{"try { x; } catch (1) { y; }", "1:19: expected next token to be 'IDENT', got 'INT' instead"},
+		{"try x catch (e) { y; }", "1:5: expected next token to be '{', got 'IDENT' instead"},
+		{`throw "x"`, "1:10: expected next token to be ';', got 'EOF' instead"},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.New(testCase.input)
+		p := parser.New(l)
+		p.ParseProgram()
+		if assert.NotEmpty(t, p.Errors()) {
+			assert.EqualError(t, p.Errors()[0], testCase.expected)
+		}
+	}
+}
+
+func TestForStatements(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"for (let i = 0; i < 10; i++) { x; }", "for (let i = 0; (i < 10); (i++)) x"},
+		{"for (i = 0; i < 10; i += 2) { x; }", "for ((i = 0); (i < 10); (i += 2)) x"},
+		{"for (; i < 10;) { x; }", "for (; (i < 10);) x"},
+		{"for (;;) { break; }", "for (;;) break"},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.New(testCase.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		assert.Empty(t, p.Errors())
+		if assert.Len(t, program.Statements, 1) {
+			assert.IsType(t, &ast.ForStatement{}, program.Statements[0])
+			assert.Equal(t, testCase.expected, program.String())
+		}
+	}
+}
+
+func TestLoopStatementsError(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"while x { }", "1:7: expected next token to be '(', got 'IDENT' instead"},
+		{"for (let i = 0 i < 3;) { }", "1:16: expected next token to be ';', got 'IDENT' instead"},
+		{"for (i; i) { }", "1:10: expected next token to be ';', got ')' instead"},
+		{"continue", "1:9: expected next token to be ';', got 'EOF' instead"},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.New(testCase.input)
+		p := parser.New(l)
+		p.ParseProgram()
+		if assert.NotEmpty(t, p.Errors()) {
+			assert.EqualError(t, p.Errors()[0], testCase.expected)
+		}
+	}
+}
+
+func TestPositions(t *testing.T) {
+	input := `let x = 5;
+let add = fn(a, b) {
+	a + b;
+};`
+	l := lexer.NewWithFilename("script.monkey", input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	assert.Empty(t, p.Errors())
+	assert.Len(t, program.Statements, 2)
+
+	letX := program.Statements[0].(*ast.LetStatement)
+	assert.Equal(t, token.Position{Filename: "script.monkey", Offset: 0, Line: 1, Column: 1}, letX.Pos())
+	assert.Equal(t, token.Position{Filename: "script.monkey", Offset: 4, Line: 1, Column: 5}, letX.Name.Pos())
+
+	letAdd := program.Statements[1].(*ast.LetStatement)
+	fLit := letAdd.Value.(*ast.FunctionLiteral)
+	assert.Equal(t, token.Position{Filename: "script.monkey", Offset: 21, Line: 2, Column: 11}, fLit.Pos())
+
+	sum := fLit.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+	assert.Equal(t, "script.monkey:3:2", sum.Pos().String())
+	assert.Equal(t, "script.monkey:3:4", sum.Token.Pos.String())
+}
+
+func TestErrorPositions(t *testing.T) {
+	input := `let a = 5;
+let b 10;`
+	l := lexer.NewWithFilename("script.monkey", input)
+	p := parser.New(l)
+	p.ParseProgram()
+	assert.Len(t, p.Errors(), 1)
+	assert.EqualError(t, p.Errors()[0], "script.monkey:2:7: expected next token to be '=', got 'INT' instead")
+}
+
+func TestIllegalTokenErrors(t *testing.T) {
+	tests := []struct {
+		input  string
+		errors []string
+	}{
+		{"let a = 1; /* open", []string{"1:12: unterminated comment"}},
+		{"let a = 1 /* open", []string{"1:11: unterminated comment"}},
+		{"let a = #;", []string{"1:9: illegal character \"#\""}},
+		{"let a = 1 # 2;", []string{"1:11: illegal character \"#\""}},
+		{"let a = 1; // fine\n/* fine */", nil},
+		{"let a = \"open;\nlet b = 2;", []string{"1:9: unterminated string literal", "2:1: expected next token to be ';', got 'LET' instead"}},
+		{"let a = `open;\nlet b = 2;", []string{"1:9: unterminated string literal", "2:11: expected next token to be ';', got 'EOF' instead"}},
+		{"let a = \"\\q\";", []string{"1:10: invalid escape sequence \\q"}},
+		{"let a = \\;", []string{"1:9: illegal character \"\\\\\""}},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		var errors []string
+		for _, err := range p.Errors() {
+			errors = append(errors, err.Error())
+		}
+		assert.Equal(t, tt.errors, errors, tt.input)
+	}
+}
+
+// clearPositions zeroes every token position in the given AST so that it can
+// be compared against hand-built nodes.
+func clearPositions(node interface{}) {
+	clearValuePositions(reflect.ValueOf(node))
+}
+
+func clearValuePositions(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			clearValuePositions(v.Elem())
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			clearValuePositions(v.Index(i))
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			clearValuePositions(iter.Key())
+			clearValuePositions(iter.Value())
+		}
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(token.Position{}) {
+			if v.CanSet() {
+				v.Set(reflect.Zero(v.Type()))
+			}
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			clearValuePositions(v.Field(i))
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package repl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/makramkd/go-monkey/ast"
+	"github.com/makramkd/go-monkey/evaluator"
+	"github.com/makramkd/go-monkey/lexer"
+	"github.com/makramkd/go-monkey/object"
+	"github.com/makramkd/go-monkey/token"
+)
+
+// command is a REPL command, entered as a colon followed by its name and
+// argument, e.g :type 1 + 2.
+type command struct {
+	name string
+	arg  string // describes the argument, if the command takes one
+	help string
+	// run runs the command, reporting false if the session should end.
+	run func(s *session, arg string) bool
+}
+
+// commands are the commands of the REPL, in the order they are listed by
+// :help, which is run by runCommand itself.
+var commands = []command{
+	{"help", "", "list the commands", nil},
+	{"env", "", "list the names defined in the session and their values", (*session).showEnv},
+	{"type", "<expr>", "evaluate an expression and print the type of its value", (*session).showType},
+	{"ast", "<code>", "print the syntax tree of code", (*session).showAST},
+	{"tokens", "<code>", "print the tokens of code", (*session).showTokens},
+	{"load", "<file>", "run a file in the session", (*session).load},
+	{"reset", "", "forget everything defined in the session", (*session).reset},
+	{"time", "<code>", "run code and print how long it took", (*session).timeCode},
+	{"quit", "", "end the session", func(*session, string) bool { return false }},
+}
+
+// runCommand runs the command line, e.g ":type 1 + 2", reporting false if the
+// session should end.
+func (s *session) runCommand(line string) bool {
+	name := strings.TrimPrefix(line, ":")
+	arg := ""
+	if i := strings.IndexAny(name, " \t\n"); i >= 0 {
+		name, arg = name[:i], strings.TrimSpace(name[i:])
+	}
+
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		if c.arg != "" && arg == "" {
+			fmt.Fprintf(s.stderr, "usage: :%s %s\n", c.name, c.arg)
+			return true
+		}
+		if c.run == nil {
+			s.help()
+			return true
+		}
+		return c.run(s, arg)
+	}
+
+	fmt.Fprintf(s.stderr, "unknown command: :%s, see :help\n", name)
+	return true
+}
+
+func (s *session) help() {
+	for _, c := range commands {
+		fmt.Fprintf(s.stdout, "  %-16s %s\n", strings.TrimSpace(":"+c.name+" "+c.arg), c.help)
+	}
+}
+
+func (s *session) showEnv(string) bool {
+	names := s.env.Names()
+	sort.Strings(names)
+	for _, name := range names {
+		value, _ := s.env.Get(name)
+		fmt.Fprintf(s.stdout, "%s = %s\n", name, value.Inspect())
+	}
+	return true
+}
+
+func (s *session) showType(arg string) bool {
+	program, ok := s.parse(lexer.New(arg))
+	if !ok {
+		return true
+	}
+
+	evaluated := evaluator.Eval(program, s.env)
+	if evaluated == nil {
+		evaluated = evaluator.NULL
+	}
+	if err, ok := evaluated.(*object.Error); ok {
+		fmt.Fprintf(s.stderr, "%s%s\n", err.Traceback(), err.Inspect())
+		return true
+	}
+	fmt.Fprintln(s.stdout, evaluated.Type())
+	return true
+}
+
+func (s *session) showAST(arg string) bool {
+	if program, ok := s.parse(lexer.New(arg)); ok {
+		fmt.Fprint(s.stdout, ast.Dump(program))
+	}
+	return true
+}
+
+func (s *session) showTokens(arg string) bool {
+	l := lexer.New(arg)
+	l.SetKeepComments(true)
+	for tok := l.NextToken(); tok.T != token.EOF; tok = l.NextToken() {
+		fmt.Fprintf(s.stdout, "%s %s %q\n", tok.Pos, tok.T, tok.Literal)
+	}
+	return true
+}
+
+func (s *session) load(arg string) bool {
+	b, err := ioutil.ReadFile(arg)
+	if err != nil {
+		fmt.Fprintln(s.stderr, err)
+		return true
+	}
+
+	if program, ok := s.parse(lexer.NewWithFilename(arg, string(b))); ok {
+		return s.eval(program)
+	}
+	return true
+}
+
+func (s *session) reset(string) bool {
+	s.env = object.NewEnv()
+	s.env.SetStreams(object.Streams{Stdout: s.stdout, Stderr: s.stderr})
+	s.env.SetOSAccess(s.osAccess)
+	return true
+}
+
+func (s *session) timeCode(arg string) bool {
+	program, ok := s.parse(lexer.New(arg))
+	if !ok {
+		return true
+	}
+
+	start := time.Now()
+	if !s.eval(program) {
+		return false
+	}
+	fmt.Fprintf(s.stdout, "took %s\n", time.Since(start))
+	return true
+}
@@ -0,0 +1,254 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// errInterrupted is returned by readLine when the user discards the line
+// being edited with Ctrl-C.
+var errInterrupted = errors.New("interrupted")
+
+// editor reads lines from a terminal in raw mode, with emacs-style line
+// editing, history and tab completion.
+type editor struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	// history holds the lines entered so far, oldest first.
+	history []string
+	// complete returns the candidates for completing the word prefix, which
+	// follows before on the line.
+	complete func(before, prefix string) []string
+}
+
+func newEditor(in io.Reader, out io.Writer) *editor {
+	return &editor{in: bufio.NewReader(in), out: out}
+}
+
+func ctrl(r rune) rune {
+	return r & 0x1f
+}
+
+// readLine reads a line, which the user edits after prompt.
+func (e *editor) readLine(prompt string) (string, error) {
+	var line []rune
+	pos := 0
+
+	// histIndex is the history entry being edited, or len(e.history) for
+	// the new line, which is saved while browsing the history.
+	histIndex := len(e.history)
+	var saved []rune
+	showHistory := func(i int) {
+		if histIndex == len(e.history) {
+			saved = line
+		}
+		histIndex = i
+		if i == len(e.history) {
+			line = saved
+		} else {
+			line = []rune(e.history[i])
+		}
+		pos = len(line)
+	}
+
+	e.refresh(prompt, line, pos)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			io.WriteString(e.out, "\r\n")
+			return string(line), nil
+		case ctrl('C'):
+			io.WriteString(e.out, "^C\r\n")
+			return "", errInterrupted
+		case ctrl('D'):
+			if len(line) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(line) {
+				line = append(line[:pos], line[pos+1:]...)
+			}
+		case 127, ctrl('H'):
+			if pos > 0 {
+				line = append(line[:pos-1], line[pos:]...)
+				pos--
+			}
+		case ctrl('A'):
+			pos = 0
+		case ctrl('E'):
+			pos = len(line)
+		case ctrl('B'):
+			if pos > 0 {
+				pos--
+			}
+		case ctrl('F'):
+			if pos < len(line) {
+				pos++
+			}
+		case ctrl('K'):
+			line = line[:pos]
+		case ctrl('U'):
+			line = append([]rune{}, line[pos:]...)
+			pos = 0
+		case ctrl('W'):
+			start := pos
+			for start > 0 && line[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && line[start-1] != ' ' {
+				start--
+			}
+			line = append(line[:start], line[pos:]...)
+			pos = start
+		case ctrl('P'):
+			if histIndex > 0 {
+				showHistory(histIndex - 1)
+			}
+		case ctrl('N'):
+			if histIndex < len(e.history) {
+				showHistory(histIndex + 1)
+			}
+		case '\t':
+			line, pos = e.completeWord(prompt, line, pos)
+		case 27:
+			switch e.readEscape() {
+			case 'A':
+				if histIndex > 0 {
+					showHistory(histIndex - 1)
+				}
+			case 'B':
+				if histIndex < len(e.history) {
+					showHistory(histIndex + 1)
+				}
+			case 'C':
+				if pos < len(line) {
+					pos++
+				}
+			case 'D':
+				if pos > 0 {
+					pos--
+				}
+			case 'H':
+				pos = 0
+			case 'F':
+				pos = len(line)
+			case '3':
+				if pos < len(line) {
+					line = append(line[:pos], line[pos+1:]...)
+				}
+			}
+		default:
+			if unicode.IsPrint(r) {
+				line = append(line[:pos], append([]rune{r}, line[pos:]...)...)
+				pos++
+			}
+		}
+
+		e.refresh(prompt, line, pos)
+	}
+}
+
+// readEscape reads the rest of an escape sequence, as sent for arrow and
+// other special keys, and returns the key it stands for: the final byte of
+// the sequence, e.g 'A' for the up arrow, or the number of sequences of the
+// form ESC [ n ~, mapping those of Home and End to 'H' and 'F'.
+func (e *editor) readEscape() byte {
+	b, err := e.in.ReadByte()
+	if err != nil || (b != '[' && b != 'O') {
+		return 0
+	}
+
+	b, err = e.in.ReadByte()
+	if err != nil {
+		return 0
+	}
+	if b < '0' || b > '9' {
+		return b
+	}
+
+	n := b
+	for {
+		b, err = e.in.ReadByte()
+		if err != nil || b == '~' {
+			break
+		}
+		if b < '0' || b > '9' {
+			return 0
+		}
+	}
+	switch n {
+	case '1', '7':
+		return 'H'
+	case '4', '8':
+		return 'F'
+	default:
+		return n
+	}
+}
+
+// completeWord completes the identifier before the cursor: with the only
+// candidate, or the longest prefix the candidates share. If that doesn't
+// complete anything, the candidates are listed below the line.
+func (e *editor) completeWord(prompt string, line []rune, pos int) ([]rune, int) {
+	if e.complete == nil {
+		return line, pos
+	}
+
+	start := pos
+	for start > 0 && isIdentRune(line[start-1]) {
+		start--
+	}
+	prefix := string(line[start:pos])
+
+	candidates := e.complete(string(line[:start]), prefix)
+	if len(candidates) == 0 {
+		return line, pos
+	}
+
+	completion := candidates[0]
+	for _, c := range candidates[1:] {
+		completion = commonPrefix(completion, c)
+	}
+
+	if completion == prefix {
+		if len(candidates) > 1 {
+			fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+		}
+		return line, pos
+	}
+
+	insert := []rune(completion)[len([]rune(prefix)):]
+	line = append(line[:pos], append(insert, line[pos:]...)...)
+	return line, pos + len(insert)
+}
+
+// refresh redraws the line being edited, with the cursor at pos.
+func (e *editor) refresh(prompt string, line []rune, pos int) {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(line))
+	if n := len(line) - pos; n > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", n)
+	}
+}
+
+func isIdentRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || r == '_'
+}
+
+func commonPrefix(a, b string) string {
+	ra, rb := []rune(a), []rune(b)
+	n := 0
+	for n < len(ra) && n < len(rb) && ra[n] == rb[n] {
+		n++
+	}
+	return string(ra[:n])
+}
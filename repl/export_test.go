@@ -0,0 +1,35 @@
+package repl
+
+import (
+	"io"
+	"strings"
+)
+
+var (
+	Incomplete  = incomplete
+	Completions = completions
+	LoadHistory = loadHistory
+	MaxHistory  = maxHistory
+)
+
+// EditLines reads the lines typed as keys with the line editor, as if they
+// were typed at a terminal, until the end of keys. Lines discarded with
+// Ctrl-C are skipped.
+func EditLines(keys string, complete func(before, prefix string) []string) ([]string, error) {
+	e := newEditor(strings.NewReader(keys), io.Discard)
+	e.complete = complete
+
+	var lines []string
+	for {
+		line, err := e.readLine(prompt)
+		if err == io.EOF {
+			return lines, nil
+		} else if err == errInterrupted {
+			continue
+		} else if err != nil {
+			return lines, err
+		}
+		e.history = append(e.history, line)
+		lines = append(lines, line)
+	}
+}
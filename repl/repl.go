@@ -4,46 +4,402 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
 
+	"github.com/makramkd/go-monkey/ast"
 	"github.com/makramkd/go-monkey/evaluator"
 	"github.com/makramkd/go-monkey/lexer"
 	"github.com/makramkd/go-monkey/object"
 	"github.com/makramkd/go-monkey/parser"
+	"github.com/makramkd/go-monkey/token"
 )
 
+const (
+	prompt             = ">> "
+	continuationPrompt = ".. "
+)
+
+// HistoryFile is the name of the file in the home directory that the lines
+// entered in interactive sessions are saved to.
+const HistoryFile = ".monkey_history"
+
+// maxHistory is the number of lines of history kept.
+const maxHistory = 1000
+
+// Config configures a REPL session.
+type Config struct {
+	// Stdout is where results, prompts and the output of programs are
+	// written. It defaults to os.Stdout.
+	Stdout io.Writer
+	// Stderr is where syntax and runtime errors are written. It defaults to
+	// Stdout.
+	Stderr io.Writer
+	// Greeting is printed at the start of interactive sessions.
+	Greeting string
+	// OSAccess lets programs use the operating system, e.g to read
+	// environment variables or exit.
+	OSAccess bool
+}
+
+// Start runs a session reading from in and writing everything to out.
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnv()
+	Run(in, Config{Stdout: out})
+}
+
+// Run runs a session reading from in, until the end of the input, :quit or a
+// call to exit. Prompts and the greeting are only shown if in is a terminal,
+// so that the output of sessions with input piped in holds only what they
+// print. It returns the status that exit was called with, or 0.
+func Run(in io.Reader, config Config) int {
+	if config.Stdout == nil {
+		config.Stdout = os.Stdout
+	}
+	if config.Stderr == nil {
+		config.Stderr = config.Stdout
+	}
+
+	s := &session{stdout: config.Stdout, stderr: config.Stderr, osAccess: config.OSAccess}
+	s.reset("")
+
+	lines := newLineReader(in, s)
+	defer lines.Close()
+
+	if _, ok := terminal(in); ok {
+		io.WriteString(s.stdout, config.Greeting)
+	}
 
 	for {
-		fmt.Print(">> ")
-		scanned := scanner.Scan()
-		if !scanned {
-			return
+		src, err := readInput(lines)
+		if err == errInterrupted {
+			continue
+		} else if err != nil {
+			return s.exitCode
+		}
+		if strings.TrimSpace(src) == "" {
+			continue
 		}
 
-		line := scanner.Text()
-		l := lexer.New(line)
-		p := parser.New(l)
-		program := p.ParseProgram()
-
-		if len(p.Errors()) > 0 {
-			printParserErrors(out, p.Errors())
+		if strings.HasPrefix(strings.TrimSpace(src), ":") {
+			if !s.runCommand(strings.TrimSpace(src)) {
+				return s.exitCode
+			}
 			continue
 		}
 
-		evaluated := evaluator.Eval(program, env)
-		// NOTE: evaluated == nil doesn't mean that there's an error. It just means we've executed
-		// a statement that has no output.
-		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
-			io.WriteString(out, "\n")
+		if program, ok := s.parse(lexer.New(src)); ok && !s.eval(program) {
+			return s.exitCode
 		}
 	}
 }
 
+// session holds the state of a REPL session.
+type session struct {
+	env      *object.Env
+	stdout   io.Writer
+	stderr   io.Writer
+	osAccess bool
+	// exitCode is the status that a program of the session called exit
+	// with.
+	exitCode int
+}
+
+// parse parses the program read by l, printing its syntax errors if it has
+// any.
+func (s *session) parse(l *lexer.Lexer) (*ast.Program, bool) {
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) > 0 {
+		printParserErrors(s.stderr, p.Errors())
+		return nil, false
+	}
+	return program, true
+}
+
+// eval evaluates program and prints its value, reporting false if it called
+// exit, which ends the session.
+func (s *session) eval(program *ast.Program) bool {
+	evaluated := evaluator.Eval(program, s.env)
+	// NOTE: evaluated == nil doesn't mean that there's an error. It just means we've executed
+	// a statement that has no output.
+	if err, ok := evaluated.(*object.Error); ok && err.Kind == object.ExitError {
+		s.exitCode = err.Code
+		return false
+	} else if ok {
+		io.WriteString(s.stderr, err.Traceback()+err.Inspect()+"\n")
+	} else if evaluated != nil {
+		io.WriteString(s.stdout, evaluated.Inspect()+"\n")
+	}
+	return true
+}
+
+// readInput reads lines until they make up a complete input, prompting for
+// continuation lines. Empty lines are part of the input like any other, e.g
+// inside a function body, but two in a row end it anyway, so that its errors
+// are reported.
+func readInput(lines lineReader) (string, error) {
+	src, err := lines.ReadLine(prompt)
+	if err != nil {
+		return "", err
+	}
+
+	empty := 0
+	for incomplete(src) && empty < 2 {
+		line, err := lines.ReadLine(continuationPrompt)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", err
+		}
+		if line == "" {
+			empty++
+		} else {
+			empty = 0
+		}
+		src += "\n" + line
+	}
+
+	return src, nil
+}
+
+// incomplete reports whether src needs more lines to be complete: it has
+// unclosed parentheses, brackets, braces, comments or raw strings, or ends
+// with an operator.
+func incomplete(src string) bool {
+	l := lexer.New(src)
+
+	depth := 0
+	var last token.Token
+	for tok := l.NextToken(); tok.T != token.EOF; tok = l.NextToken() {
+		switch tok.T {
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		}
+		last = tok
+	}
+	if depth > 0 {
+		return true
+	}
+
+	switch last.T {
+	case token.ILLEGAL:
+		return strings.HasPrefix(last.Literal, "/*") || strings.HasPrefix(last.Literal, "`")
+	case token.ASSIGN, token.INCR, token.DECR, token.TIMES_EQ, token.DIV_EQ, token.REM_EQ,
+		token.PLUS, token.MINUS, token.TIMES, token.DIVIDE, token.REMAINDER, token.POWER,
+		token.AND, token.OR, token.EQUAL, token.NOT_EQUAL,
+		token.LESS_THAN, token.GREATER_THAN, token.LEQ, token.GEQ,
+		token.BANG, token.COMMA, token.PERIOD:
+		return true
+	}
+	return false
+}
+
+// completions returns the keywords, builtins and names defined in env that
+// start with prefix, sorted. After the name of a module followed by a
+// period, they are the module's exported members instead, and at the start
+// of a command, the names of the commands.
+func completions(env *object.Env, before, prefix string) []string {
+	var names []string
+	if before == ":" {
+		for _, c := range commands {
+			names = append(names, c.name)
+		}
+	} else if strings.HasSuffix(before, ".") {
+		start := len(before) - 1
+		for start > 0 {
+			r, size := utf8.DecodeLastRuneInString(before[:start])
+			if !isIdentRune(r) {
+				break
+			}
+			start -= size
+		}
+		if module, ok := lookup(env, before[start:len(before)-1]).(*object.Module); ok {
+			for _, name := range module.Env.Names() {
+				if object.Exported(name) {
+					names = append(names, name)
+				}
+			}
+		}
+	} else {
+		names = append(names, token.Keywords()...)
+		for _, b := range object.Builtins {
+			if object.Exported(b.Name) {
+				names = append(names, b.Name)
+			}
+		}
+		names = append(names, env.Names()...)
+		names = append(names, env.Prelude().Names()...)
+	}
+
+	seen := map[string]bool{}
+	var candidates []string
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) && !seen[name] {
+			seen[name] = true
+			candidates = append(candidates, name)
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+func lookup(env *object.Env, name string) object.Object {
+	obj, _ := env.Get(name)
+	return obj
+}
+
 func printParserErrors(out io.Writer, errors []error) {
 	for _, err := range errors {
 		io.WriteString(out, "\t"+err.Error()+"\n")
 	}
 }
+
+// lineReader reads the lines of input of the REPL.
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+	Close() error
+}
+
+// newLineReader returns a reader of lines from in, which are edited in place
+// if in is a terminal that supports it.
+func newLineReader(in io.Reader, s *session) lineReader {
+	f, ok := terminal(in)
+	if !ok {
+		return &plainReader{scanner: bufio.NewScanner(in)}
+	}
+
+	restore, err := makeRaw(f.Fd())
+	if err != nil {
+		return &plainReader{scanner: bufio.NewScanner(in), prompts: s.stdout}
+	}
+	restore()
+
+	t := &terminalReader{f: f, editor: newEditor(f, s.stdout)}
+	t.editor.complete = func(before, prefix string) []string {
+		return completions(s.env, before, prefix)
+	}
+	t.openHistory()
+	return t
+}
+
+// terminal returns the file of in, if in is a terminal.
+func terminal(in io.Reader) (*os.File, bool) {
+	f, ok := in.(*os.File)
+	return f, ok && isTerminal(f.Fd())
+}
+
+// plainReader reads lines without editing them, e.g from a pipe.
+type plainReader struct {
+	scanner *bufio.Scanner
+	// prompts is where prompts are written, if they are shown.
+	prompts io.Writer
+}
+
+func (r *plainReader) ReadLine(prompt string) (string, error) {
+	if r.prompts != nil {
+		io.WriteString(r.prompts, prompt)
+	}
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+func (r *plainReader) Close() error {
+	return nil
+}
+
+// terminalReader reads lines from a terminal with an editor, saving them to
+// the history file.
+type terminalReader struct {
+	f       *os.File
+	editor  *editor
+	history *os.File
+}
+
+// openHistory loads the history saved by earlier sessions and opens the
+// history file to append to it. Sessions go without saved history if the
+// file can't be opened.
+func (t *terminalReader) openHistory() {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return
+	}
+	t.editor.history, t.history = loadHistory(filepath.Join(home, HistoryFile))
+}
+
+// loadHistory returns the last maxHistory lines of the history file and opens
+// it to append to, or returns a nil file if it can't be opened. A file
+// holding more lines is rewritten with just those, so that it doesn't grow
+// without bound.
+func loadHistory(filename string) ([]string, *os.File) {
+	var lines []string
+	if b, err := ioutil.ReadFile(filename); err == nil {
+		for _, line := range strings.Split(string(b), "\n") {
+			if line != "" {
+				lines = append(lines, line)
+			}
+		}
+	}
+
+	if len(lines) > maxHistory {
+		lines = lines[len(lines)-maxHistory:]
+		// Failing to rewrite the file only leaves it to be trimmed by a
+		// later session.
+		writeHistory(filename, lines)
+	}
+
+	f, _ := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	return lines, f
+}
+
+// writeHistory replaces the history file with one holding lines. The lines
+// are written to a temporary file first, so that the history isn't lost if
+// writing them fails.
+func writeHistory(filename string, lines []string) error {
+	tmp := filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+func (t *terminalReader) ReadLine(prompt string) (string, error) {
+	restore, err := makeRaw(t.f.Fd())
+	if err != nil {
+		return "", err
+	}
+	line, err := t.editor.readLine(prompt)
+	restore()
+	if err != nil {
+		return "", err
+	}
+
+	if strings.TrimSpace(line) != "" {
+		t.editor.history = append(t.editor.history, line)
+		if len(t.editor.history) > maxHistory {
+			t.editor.history = t.editor.history[1:]
+		}
+		if t.history != nil {
+			fmt.Fprintln(t.history, line)
+		}
+	}
+	return line, nil
+}
+
+func (t *terminalReader) Close() error {
+	if t.history == nil {
+		return nil
+	}
+	return t.history.Close()
+}
@@ -0,0 +1,257 @@
+package repl_test
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/makramkd/go-monkey/evaluator"
+	"github.com/makramkd/go-monkey/lexer"
+	"github.com/makramkd/go-monkey/object"
+	"github.com/makramkd/go-monkey/parser"
+	"github.com/makramkd/go-monkey/repl"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		input      string
+		incomplete bool
+	}{
+		{"", false},
+		{"let a = 5;", false},
+		{"let f = fn(x) {", true},
+		{"let f = fn(x) {\n  x * 2\n};", false},
+		{"let f = fn(x) {\n", true},
+		{"let f = fn(x) {\n\n  let y = x;\n\n", true},
+		{"let f = fn(x) {\n\n  x * 2\n\n};", false},
+		{"puts(1,", true},
+		{"[1, 2", true},
+		{"{\"a\": 1", true},
+		{"1 +", true},
+		{"a &&", true},
+		{"let a =", true},
+		{"functools.", true},
+		{"a)", false},
+		{"\"{\"", false},
+		{"1 /* note", true},
+		{"1 /* note */", false},
+		{"1 // (", false},
+		{"1 + // note", true},
+		{"`raw", true},
+		{"`raw`", false},
+		{"\"open", false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.incomplete, repl.Incomplete(tt.input), tt.input)
+	}
+}
+
+func TestEditLines(t *testing.T) {
+	complete := func(before, prefix string) []string {
+		var candidates []string
+		for _, name := range []string{"filter", "first", "len"} {
+			if strings.HasPrefix(name, prefix) {
+				candidates = append(candidates, name)
+			}
+		}
+		return candidates
+	}
+
+	tests := []struct {
+		keys  string
+		lines []string
+	}{
+		{"1 + 2\r", []string{"1 + 2"}},
+		{"12\x7f3\r", []string{"13"}},
+		{"b\x1b[Da\r", []string{"ab"}},
+		{"bc\x01a\x05d\r", []string{"abcd"}},
+		{"abc\x1b[D\x1b[D\x1b[3~\r", []string{"ac"}},
+		{"abc\x02\x02\x0b\r", []string{"a"}},
+		{"abc\x02\x15\r", []string{"c"}},
+		{"let abc\x17\r", []string{"let "}},
+		{"one\rtwo\r\x1b[A\x1b[A\r", []string{"one", "two", "one"}},
+		{"one\r\x10!\r", []string{"one", "one!"}},
+		{"one\rtwo\x1b[A\x1b[B\r", []string{"one", "two"}},
+		{"l\t(x)\r", []string{"len(x)"}},
+		{"f\t\r", []string{"fi"}},
+		{"x\t\r", []string{"x"}},
+		{"discarded\x03kept\r", []string{"kept"}},
+	}
+
+	for _, tt := range tests {
+		lines, err := repl.EditLines(tt.keys, complete)
+		assert.NoError(t, err, "%q", tt.keys)
+		assert.Equal(t, tt.lines, lines, "%q", tt.keys)
+	}
+}
+
+func TestCompletions(t *testing.T) {
+	env := object.NewEnv()
+	p := parser.New(lexer.New(`import functools (map); import math as m; let mine = 1; let mapped = 2; import math as मा;`))
+	program := p.ParseProgram()
+	assert.Empty(t, p.Errors())
+	evaluator.Eval(program, env)
+
+	tests := []struct {
+		before, prefix string
+		candidates     []string
+	}{
+		{"", "mi", []string{"mine"}},
+		{"", "ma", []string{"map", "mapped"}},
+		{"", "le", []string{"len", "let"}},
+		{"", "whi", []string{"while"}},
+		{"1 + ", "m", []string{"m", "map", "mapped", "mine"}},
+		{"1 + m.", "m", []string{"max", "min"}},
+		{"1 + मा.", "m", []string{"max", "min"}},
+		{"m.", "_", nil},
+		{"mine.", "", nil},
+		{"nothing.", "", nil},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.candidates, repl.Completions(env, tt.before, tt.prefix), tt.before+tt.prefix)
+	}
+}
+
+func TestStart(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2\n", "3\n"},
+		{"let f = fn(x) {\n  x * 2\n};\nf(21)\n", "42\n"},
+		{"1 +\n2\n", "3\n"},
+		{"[1,\n\n", "\t2:1: no prefix parse function found for 'EOF'\n\t2:2: expected next token to be ']', got 'EOF' instead\n"},
+		{"let a = 1;\n\n\na\n", "1\n"},
+		// Empty lines inside a function body are part of it, but two in a row
+		// end unfinished input.
+		{"let f = fn(x) {\n\n  x * 2\n\n};\nf(3)\n", "6\n"},
+		{"let f = fn(x) {\n\n\n1\n", "\t3:2: expected next token to be ';', got 'EOF' instead\n1\n"},
+		{"import os;\n1\nexit(2)\n3\n", "1\nERROR: 1:1: 'exit' needs access to the operating system, which the program doesn't have\n3\n"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		repl.Start(strings.NewReader(tt.input), &out)
+		assert.Equal(t, tt.expected, out.String(), tt.input)
+	}
+
+	// Sessions with access to the operating system end when exit is called.
+	var out bytes.Buffer
+	code := repl.Run(strings.NewReader("import os;\n1\nexit(2)\n3\n"), repl.Config{Stdout: &out, OSAccess: true})
+	assert.Equal(t, "1\n", out.String())
+	assert.Equal(t, 2, code)
+}
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{":env\n", ""},
+		{"let b = 2; let a = [1];\n:env\n", "a = [1]\nb = 2\n"},
+		{":type 1 + 2.5\n", "FLOAT\n"},
+		{":type let a = 1;\n", "NULL\n"},
+		{":type 1 / 0\n", "ERROR: 1:1: division by zero\n"},
+		{":type\n", "usage: :type <expr>\n"},
+		{":ast -x\n", "Program 1:1\n  Statements[0]: ExpressionStatement 1:1\n    Expression: PrefixExpression 1:1 Operator=\"-\"\n      Right: Identifier 1:2 Value=\"x\"\n"},
+		{":ast (\n\n", "\t1:2: no prefix parse function found for 'EOF'\n\t1:3: expected next token to be ')', got 'EOF' instead\n"},
+		{":tokens a + \"b\"\n", "1:1 IDENT \"a\"\n1:3 + \"+\"\n1:5 STRING \"b\"\n"},
+		{":tokens a // b\n", "1:1 IDENT \"a\"\n1:3 COMMENT \"// b\"\n"},
+		{"let a = 1;\n:reset\n:env\n", ""},
+		{":load ../conformance/testdata/stdlib/shapes.monkey\narea(3)\n", "9\n"},
+		{":load nope.monkey\n", "open nope.monkey: no such file or directory\n"},
+		{":quit\n1\n", ""},
+		{":nope\n", "unknown command: :nope, see :help\n"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		repl.Start(strings.NewReader(tt.input), &out)
+		assert.Equal(t, tt.expected, out.String(), tt.input)
+	}
+
+	var out bytes.Buffer
+	repl.Start(strings.NewReader(":time 1 + 1\n"), &out)
+	assert.Regexp(t, `^2\ntook \S+\n$`, out.String())
+
+	out.Reset()
+	repl.Start(strings.NewReader(":help\n"), &out)
+	assert.Contains(t, out.String(), ":load <file>")
+}
+
+var update = flag.Bool("update", false, "update the golden files of the REPL sessions")
+
+// TestSessions pipes each testdata/*.monkey file into a REPL session and
+// compares what it prints with the .golden file of the same name. Run the
+// tests with -update to rewrite the golden files.
+func TestSessions(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.monkey")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, files)
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			in, err := os.Open(file)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer in.Close()
+
+			var out bytes.Buffer
+			repl.Run(in, repl.Config{Stdout: &out, Stderr: &out, Greeting: "not a terminal, no greeting\n"})
+
+			golden := strings.TrimSuffix(file, ".monkey") + ".golden"
+			if *update {
+				assert.NoError(t, ioutil.WriteFile(golden, out.Bytes(), 0o644))
+			}
+			expected, err := ioutil.ReadFile(golden)
+			assert.NoError(t, err)
+			assert.Equal(t, string(expected), out.String())
+		})
+	}
+}
+
+func TestStreams(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	repl.Run(strings.NewReader("puts(1)\nnope\n:nope\nlet = 1;\n2\n"), repl.Config{Stdout: &stdout, Stderr: &stderr})
+
+	assert.Equal(t, "1\nnull\n2\n", stdout.String())
+	assert.Equal(t, "ERROR: 1:1: identifier not found: nope\nunknown command: :nope, see :help\n\t1:5: expected next token to be 'IDENT', got '=' instead\n\t1:5: no prefix parse function found for '='\n", stderr.String())
+}
+
+func TestLoadHistory(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), repl.HistoryFile)
+
+	var saved []string
+	for i := 0; i < repl.MaxHistory+5; i++ {
+		saved = append(saved, fmt.Sprintf("let x = %d;", i))
+	}
+	assert.NoError(t, ioutil.WriteFile(filename, []byte(strings.Join(saved, "\n")+"\n\n"), 0o600))
+
+	lines, f := repl.LoadHistory(filename)
+	assert.Equal(t, saved[5:], lines)
+	if assert.NotNil(t, f) {
+		_, err := fmt.Fprintln(f, "x")
+		assert.NoError(t, err)
+		assert.NoError(t, f.Close())
+	}
+
+	// The file is trimmed to the lines that were loaded.
+	b, err := ioutil.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Join(append(saved[5:], "x"), "\n")+"\n", string(b))
+
+	lines, f = repl.LoadHistory(filepath.Join(t.TempDir(), repl.HistoryFile))
+	assert.Empty(t, lines)
+	if assert.NotNil(t, f) {
+		assert.NoError(t, f.Close())
+	}
+}
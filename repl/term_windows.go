@@ -0,0 +1,18 @@
+package repl
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Windows consoles edit lines themselves, so input is read a line at a time,
+// but prompts are still shown.
+
+func isTerminal(fd uintptr) bool {
+	var mode uint32
+	return syscall.GetConsoleMode(syscall.Handle(fd), &mode) == nil
+}
+
+func makeRaw(fd uintptr) (func(), error) {
+	return nil, errors.New("raw mode is not supported on this platform")
+}
@@ -1,25 +1,80 @@
 package token
 
+import (
+	"fmt"
+	"sort"
+)
+
 type Type string
 
 type Token struct {
 	T       Type
 	Literal string
+	Pos     Position // where the token starts in the source
+}
+
+// Position describes a location in Monkey source code.
+// Lines and columns are 1-based; a Position with a zero Line is not valid,
+// which is the case for tokens that were not produced by the lexer.
+type Position struct {
+	Filename string
+	Offset   int // byte offset, starting at 0
+	Line     int // line number, starting at 1
+	Column   int // column number (in chars), starting at 1
+}
+
+// IsValid reports whether the position points into actual source code.
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+// String returns the position in one of the forms
+//
+//	file:line:column    valid position with file name
+//	line:column         valid position without file name
+//	file                invalid position with file name
+//	-                   invalid position without file name
+func (p Position) String() string {
+	s := p.Filename
+	if p.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+		s += fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	if s == "" {
+		s = "-"
+	}
+	return s
 }
 
 var keywords = map[string]Type{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
-	"null":   NULL,
-	"import": IMPORT,
-	"for":    FOR,
-	"in":     IN,
-	"break":  BREAK,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"true":     TRUE,
+	"false":    FALSE,
+	"if":       IF,
+	"else":     ELSE,
+	"return":   RETURN,
+	"null":     NULL,
+	"import":   IMPORT,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"while":    WHILE,
+	"throw":    THROW,
+	"try":      TRY,
+	"catch":    CATCH,
+	"finally":  FINALLY,
+}
+
+// Keywords returns the keywords of the language, sorted.
+func Keywords() []string {
+	names := make([]string, 0, len(keywords))
+	for name := range keywords {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 func New(tokType Type, literal string) Token {
@@ -37,10 +92,14 @@ const (
 	// Special, non-visible tokens
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
+	// COMMENT tokens are only produced by lexers keeping comments, e.g for
+	// formatters. The literal is the whole comment, such as "// note".
+	COMMENT = "COMMENT"
 
 	// Identifiers, literals
 	IDENT  = "IDENT"
 	INT    = "INT"
+	FLOAT  = "FLOAT"
 	STRING = "STRING"
 
 	// Operators
@@ -101,4 +160,10 @@ const (
 	FOR      = "FOR"
 	IN       = "IN"
 	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	WHILE    = "WHILE"
+	THROW    = "THROW"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
 )
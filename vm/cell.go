@@ -0,0 +1,28 @@
+package vm
+
+import (
+	"github.com/makramkd/go-monkey/object"
+)
+
+const CELL object.ObjectType = "CELL"
+
+// cell holds a local variable that has been captured by a closure. Both the
+// local slot and the closure's free variables refer to the same cell, so
+// assignments made through either are visible to the other. Like iterators,
+// cells are never visible to Monkey code: reading a variable yields the value
+// the cell holds.
+type cell struct {
+	value object.Object
+}
+
+func (c *cell) Type() object.ObjectType { return CELL }
+
+func (c *cell) Inspect() string { return c.value.Inspect() }
+
+// deref returns the value held by o if it's a cell, o itself otherwise.
+func deref(o object.Object) object.Object {
+	if c, ok := o.(*cell); ok {
+		return c.value
+	}
+	return o
+}
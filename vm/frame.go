@@ -0,0 +1,64 @@
+package vm
+
+import (
+	"github.com/makramkd/go-monkey/code"
+	"github.com/makramkd/go-monkey/object"
+	"github.com/makramkd/go-monkey/token"
+)
+
+// Frame holds the execution state of a single function call.
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+
+	// name is the name of the function the frame was pushed for, which tail
+	// calls may have replaced since.
+	name string
+	// tailCalls are the tail calls that replaced the function, kept for
+	// tracebacks.
+	tailCalls []tailCall
+}
+
+type tailCall struct {
+	frame object.Frame
+	// repeats is the number of tail calls that repeated the frame, e.g those
+	// of a function calling itself, which are stored once to save memory.
+	repeats int
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{
+		cl:          cl,
+		ip:          -1,
+		basePointer: basePointer,
+		name:        cl.Fn.Name,
+	}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
+
+// replaced returns the tail calls of a frame that replaces f with a tail call
+// to a function called name from pos.
+func (f *Frame) replaced(name string, pos token.Position) []tailCall {
+	call := object.Frame{Function: name, Pos: pos}
+	if n := len(f.tailCalls); n > 0 && f.tailCalls[n-1].frame == call {
+		f.tailCalls[n-1].repeats++
+		return f.tailCalls
+	}
+	return append(f.tailCalls, tailCall{frame: call})
+}
+
+// appendStack appends the frames of the call that f was pushed for, called
+// from callSite, and of the tail calls that replaced it to stack.
+func (f *Frame) appendStack(stack []object.Frame, callSite token.Position) []object.Frame {
+	stack = append(stack, object.Frame{Function: f.name, Pos: callSite})
+	for _, c := range f.tailCalls {
+		for i := 0; i <= c.repeats; i++ {
+			stack = append(stack, c.frame)
+		}
+	}
+	return stack
+}
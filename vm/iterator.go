@@ -0,0 +1,51 @@
+package vm
+
+import (
+	"github.com/makramkd/go-monkey/object"
+)
+
+const ITERATOR object.ObjectType = "ITERATOR"
+
+// iterator walks the collection of a for-each loop. It only ever lives in a
+// hidden local variable, so it's never visible to Monkey code.
+type iterator struct {
+	// Iterating over an array yields its values, iterating over a hash
+	// yields its keys and values.
+	values []object.Object
+	pairs  []object.HashPair
+	pos    int
+}
+
+func newIterator(collection object.Object, numIdentifiers int) (*iterator, error) {
+	switch {
+	case collection.Type() == object.ARRAY && numIdentifiers == 1:
+		return &iterator{values: collection.(*object.Array).Values}, nil
+	case collection.Type() == object.HASH && numIdentifiers == 2:
+		hash := collection.(*object.Hash)
+		pairs := make([]object.HashPair, 0, len(hash.Pairs))
+		for _, pair := range hash.Pairs {
+			pairs = append(pairs, pair)
+		}
+		return &iterator{pairs: pairs}, nil
+	default:
+		return nil, newError(object.TypeError, "unsupported iteration type: %s and %d identifiers", collection.Type(), numIdentifiers)
+	}
+}
+
+func (it *iterator) Type() object.ObjectType { return ITERATOR }
+func (it *iterator) Inspect() string         { return "iterator" }
+
+func (it *iterator) done() bool {
+	return it.pos >= len(it.values) && it.pos >= len(it.pairs)
+}
+
+func (it *iterator) next() []object.Object {
+	defer func() { it.pos++ }()
+
+	if it.values != nil {
+		return []object.Object{it.values[it.pos]}
+	}
+
+	pair := it.pairs[it.pos]
+	return []object.Object{pair.Key, pair.Value}
+}
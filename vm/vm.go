@@ -0,0 +1,1035 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/makramkd/go-monkey/code"
+	"github.com/makramkd/go-monkey/compiler"
+	"github.com/makramkd/go-monkey/object"
+)
+
+const (
+	// StackSize is the initial size of the stack, which grows on demand up
+	// to MaxStackSize.
+	StackSize    = 2048
+	MaxStackSize = 1 << 20
+	GlobalsSize  = 65536
+	MaxFrames    = 1 << 16
+)
+
+var (
+	True  = object.TrueValue
+	False = object.FalseValue
+	Null  = object.NullValue
+)
+
+type VM struct {
+	constants   []object.Object
+	globals     []object.Object
+	globalNames []string
+
+	stack []object.Object
+	sp    int // Always points to the next free slot. Top of stack is stack[sp-1]
+
+	frames      []*Frame
+	framesIndex int
+
+	// handlers are the try statements being run, innermost last.
+	handlers []handler
+
+	// checkedArithmetic makes integer overflow an error rather than
+	// wrapping around.
+	checkedArithmetic bool
+
+	// imported holds the constant indexes of the modules run so far.
+	imported map[int]bool
+
+	// streams are the writers that builtins print to.
+	streams object.Streams
+
+	// osAccess lets builtins such as those of the os module use the
+	// operating system.
+	osAccess bool
+
+	// meter counts the instructions run against the limits of the program.
+	meter object.Meter
+}
+
+// handler is where execution resumes when a runtime error is raised inside a
+// try statement: the instruction at ip, in the frame and with the stack as
+// they were when the statement was entered.
+type handler struct {
+	framesIndex int
+	sp          int
+	ip          int
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		NumLocals:    bytecode.NumLocals,
+		Positions:    bytecode.Positions,
+	}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	stackSize := StackSize
+	for stackSize < mainFn.NumLocals {
+		stackSize *= 2
+	}
+
+	return &VM{
+		constants:   bytecode.Constants,
+		globals:     make([]object.Object, GlobalsSize),
+		globalNames: bytecode.GlobalNames,
+
+		stack: make([]object.Object, stackSize),
+		// The main program keeps the variables of top level loops in locals.
+		sp: mainFn.NumLocals,
+
+		frames:      []*Frame{mainFrame},
+		framesIndex: 1,
+
+		streams: object.DefaultStreams(),
+	}
+}
+
+// SetCheckedArithmetic sets whether integer overflow is reported as an error.
+func (vm *VM) SetCheckedArithmetic(enabled bool) {
+	vm.checkedArithmetic = enabled
+}
+
+// SetStreams sets the writers that builtins such as puts print to.
+func (vm *VM) SetStreams(streams object.Streams) {
+	vm.streams = streams
+}
+
+// SetOSAccess sets whether the program may use the operating system, e.g to
+// read environment variables or exit.
+func (vm *VM) SetOSAccess(enabled bool) {
+	vm.osAccess = enabled
+}
+
+// SetLimits sets the limits of the program, which fails with an error of
+// kind object.LimitError once it exceeds them.
+func (vm *VM) SetLimits(limits object.Limits) {
+	vm.meter.SetLimits(limits)
+}
+
+// SetGlobal sets the global at index, e.g one defined with
+// compiler.DefineGlobal.
+func (vm *VM) SetGlobal(index int, value object.Object) {
+	vm.globals[index] = value
+}
+
+// LastPoppedStackElem returns the value of the last expression statement,
+// which is the result of the program.
+func (vm *VM) LastPoppedStackElem() object.Object {
+	if vm.sp >= len(vm.stack) {
+		return nil
+	}
+	return vm.stack[vm.sp]
+}
+
+// RunContext executes the program like Run, stopping it with an error once
+// ctx is done.
+func (vm *VM) RunContext(ctx context.Context) error {
+	vm.meter.SetContext(ctx)
+	defer vm.meter.SetContext(nil)
+
+	return vm.Run()
+}
+
+// Run executes the program. Runtime errors are returned as *object.Error
+// values carrying the position of the instruction that failed.
+func (vm *VM) Run() error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+	var err error
+
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		// Programs can't catch errors raised for exceeding their limits.
+		if e := vm.meter.Step(); e != nil {
+			return vm.errorAt(e, ip)
+		}
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			err = vm.push(vm.constants[constIndex])
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpPow, code.OpRem,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterEqual,
+			code.OpLessThan, code.OpLessEqual, code.OpAnd, code.OpOr:
+			err = vm.executeBinaryOperation(op)
+
+		case code.OpTrue:
+			err = vm.push(True)
+		case code.OpFalse:
+			err = vm.push(False)
+		case code.OpNull:
+			err = vm.push(Null)
+
+		case code.OpBang:
+			err = vm.push(executeBangOperator(vm.pop()))
+		case code.OpMinus:
+			err = vm.executeMinusOperator()
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip = pos - 1
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			condition := vm.pop()
+			if !isTruthy(condition) {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			vm.globals[globalIndex] = vm.pop()
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			global := vm.globals[globalIndex]
+			if global == nil {
+				err = newError(object.NameError, "identifier not found: %s", vm.globalNames[globalIndex])
+				break
+			}
+			err = vm.push(global)
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			vm.stack[vm.currentFrame().basePointer+int(localIndex)] = vm.pop()
+		case code.OpGetLocal:
+			localIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			err = vm.push(deref(vm.stack[vm.currentFrame().basePointer+int(localIndex)]))
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			err = vm.push(object.Builtins[builtinIndex].Builtin)
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			err = vm.push(deref(vm.currentFrame().cl.Free[freeIndex]))
+
+		case code.OpCurrentClosure:
+			err = vm.push(vm.currentFrame().cl)
+
+		case code.OpAssignGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			if vm.globals[globalIndex] == nil {
+				err = newError(object.NameError, "identifier not found: %s", vm.globalNames[globalIndex])
+				break
+			}
+			vm.globals[globalIndex] = vm.stack[vm.sp-1]
+		case code.OpAssignLocal:
+			localIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			slot := vm.currentFrame().basePointer + int(localIndex)
+			if c, ok := vm.stack[slot].(*cell); ok {
+				c.value = vm.stack[vm.sp-1]
+			} else {
+				vm.stack[slot] = vm.stack[vm.sp-1]
+			}
+		case code.OpAssignFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			vm.currentFrame().cl.Free[freeIndex].(*cell).value = vm.stack[vm.sp-1]
+
+		case code.OpGetLocalCell:
+			localIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			slot := vm.currentFrame().basePointer + int(localIndex)
+			c, ok := vm.stack[slot].(*cell)
+			if !ok {
+				c = &cell{value: vm.stack[slot]}
+				vm.stack[slot] = c
+			}
+			err = vm.push(c)
+		case code.OpGetFreeCell:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			err = vm.push(vm.currentFrame().cl.Free[freeIndex])
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if e := vm.meter.Limits().CheckArrayLength(numElements); e != nil {
+				err = e
+				break
+			}
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp -= numElements
+
+			err = vm.push(&object.Array{Values: elements})
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			var hash object.Object
+			hash, err = vm.buildHash(vm.sp-numElements, vm.sp)
+			if err != nil {
+				break
+			}
+			vm.sp -= numElements
+
+			err = vm.push(hash)
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.executeIndexExpression(left, index)
+		case code.OpSetIndex:
+			keepPrevious := code.ReadUint8(ins[ip+1:]) == 1
+			vm.currentFrame().ip += 1
+
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.executeSetIndex(left, index, value, keepPrevious)
+		case code.OpDup2:
+			err = vm.push(vm.stack[vm.sp-2])
+			if err == nil {
+				err = vm.push(vm.stack[vm.sp-2])
+			}
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			err = vm.executeCall(int(numArgs))
+		case code.OpTailCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			err = vm.executeTailCall(int(numArgs))
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			if vm.framesIndex == 1 {
+				// Returning from the main program ends it, with the returned
+				// value as its result.
+				vm.stack[vm.sp] = returnValue
+				return nil
+			}
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			err = vm.push(returnValue)
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			err = vm.push(Null)
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+			err = vm.pushClosure(int(constIndex), int(numFree))
+
+		case code.OpImport:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			err = vm.importModule(int(constIndex))
+
+		case code.OpIterInit:
+			numIdentifiers := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip += 1
+
+			var it *iterator
+			it, err = newIterator(vm.pop(), numIdentifiers)
+			if err != nil {
+				break
+			}
+			err = vm.push(it)
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			it := vm.pop().(*iterator)
+			if it.done() {
+				vm.currentFrame().ip = pos - 1
+				break
+			}
+			for _, v := range it.next() {
+				if err = vm.push(v); err != nil {
+					break
+				}
+			}
+
+		case code.OpTry:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			vm.handlers = append(vm.handlers, handler{framesIndex: vm.framesIndex, sp: vm.sp, ip: pos})
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case code.OpThrow:
+			thrown := vm.pop()
+			if e, ok := thrown.(*object.Error); ok {
+				err = e
+			} else {
+				err = object.NewThrownError(thrown)
+			}
+		case code.OpCatch:
+			err = vm.push(vm.pop().(*object.Error).Caught())
+
+		default:
+			def, _ := code.Lookup(byte(op))
+			err = fmt.Errorf("unsupported opcode: %v", def)
+		}
+
+		if err != nil {
+			err = vm.errorAt(err, ip)
+			if e, ok := err.(*object.Error); ok && len(vm.handlers) > 0 && e.Catchable() {
+				err = vm.handle(e)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// errorAt fills in the position of a runtime error raised by the instruction
+// at ip in the current frame.
+func (vm *VM) errorAt(err error, ip int) error {
+	if e, ok := err.(*object.Error); ok && !e.Pos.IsValid() {
+		e.Pos = vm.currentFrame().cl.Fn.Positions[ip]
+		e.Stack = vm.callStack()
+	}
+	return err
+}
+
+// handle unwinds the frames and stack to the innermost try statement and
+// jumps to its handler, with the error on top of the stack.
+func (vm *VM) handle(e *object.Error) error {
+	h := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+	vm.framesIndex = h.framesIndex
+	vm.sp = h.sp
+	vm.currentFrame().ip = h.ip - 1
+
+	return vm.push(e)
+}
+
+// callStack returns the function calls in progress, outermost call first, or
+// nil if the main program is running.
+func (vm *VM) callStack() []object.Frame {
+	if vm.framesIndex == 1 {
+		return nil
+	}
+
+	stack := make([]object.Frame, 0, vm.framesIndex-1)
+	for i := 1; i < vm.framesIndex; i++ {
+		caller := vm.frames[i-1]
+		// Callers are suspended on the operand of their OpCall instruction.
+		callSite := caller.cl.Fn.Positions[caller.ip-1]
+		stack = vm.frames[i].appendStack(stack, callSite)
+	}
+	return stack
+}
+
+func (vm *VM) push(o object.Object) error {
+	if vm.sp >= len(vm.stack) {
+		if err := vm.growStack(vm.sp + 1); err != nil {
+			return err
+		}
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+// growStack makes sure the stack can hold at least size elements.
+func (vm *VM) growStack(size int) error {
+	if size > MaxStackSize {
+		return newError(object.RuntimeError, "stack overflow")
+	}
+
+	newSize := len(vm.stack)
+	for newSize < size {
+		newSize *= 2
+	}
+	if newSize > MaxStackSize {
+		newSize = MaxStackSize
+	}
+
+	stack := make([]object.Object, newSize)
+	copy(stack, vm.stack)
+	vm.stack = stack
+
+	return nil
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= MaxFrames {
+		return newError(object.RuntimeError, "stack overflow")
+	}
+
+	if vm.framesIndex < len(vm.frames) {
+		vm.frames[vm.framesIndex] = f
+	} else {
+		vm.frames = append(vm.frames, f)
+	}
+	vm.framesIndex++
+
+	return nil
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		if err := vm.meter.Limits().CheckCallDepth(vm.framesIndex - 1); err != nil {
+			return err
+		}
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return newError(object.TypeError, "not a function: %s", callee.Type())
+	}
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	if numArgs != cl.Fn.NumParameters {
+		return newError(object.ArgumentError, "wrong number of arguments. got=%d, want=%d", numArgs, cl.Fn.NumParameters)
+	}
+
+	frame := NewFrame(cl, vm.sp-numArgs)
+	if err := vm.pushFrame(frame); err != nil {
+		return err
+	}
+
+	sp := frame.basePointer + cl.Fn.NumLocals
+	if sp > len(vm.stack) {
+		if err := vm.growStack(sp); err != nil {
+			return err
+		}
+	}
+	// Locals left over from earlier calls may be cells shared with closures,
+	// so they mustn't be written through.
+	for i := frame.basePointer + numArgs; i < sp; i++ {
+		vm.stack[i] = nil
+	}
+	vm.sp = sp
+
+	return nil
+}
+
+// executeTailCall makes a call in tail position. Calls to closures replace
+// the frame of the calling function, so they don't count towards the call
+// depth, and return from it when they return. Any other call is made as
+// usual, leaving its result for the instructions after it to return.
+func (vm *VM) executeTailCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	cl, ok := callee.(*object.Closure)
+	if !ok || numArgs != cl.Fn.NumParameters {
+		return vm.executeCall(numArgs)
+	}
+
+	frame := vm.currentFrame()
+	// Move the callee and its arguments down into the place of those of the
+	// calling function.
+	copy(vm.stack[frame.basePointer-1:], vm.stack[vm.sp-1-numArgs:vm.sp])
+	vm.sp = frame.basePointer + numArgs
+	vm.popFrame()
+
+	if err := vm.callClosure(cl, numArgs); err != nil {
+		return err
+	}
+	replacement := vm.currentFrame()
+	replacement.name = frame.name
+	replacement.tailCalls = frame.replaced(cl.Fn.Name, frame.cl.Fn.Positions[frame.ip-1])
+	return nil
+}
+
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := make([]object.Object, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+
+	result := builtin.Call(object.Host{Streams: vm.streams, Limits: vm.meter.Limits(), OSAccess: vm.osAccess}, args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	switch result := result.(type) {
+	case nil:
+		return vm.push(Null)
+	case *object.Error:
+		return result
+	default:
+		if err := vm.meter.Limits().CheckSize(result); err != nil {
+			return err
+		}
+		return vm.push(result)
+	}
+}
+
+// importModule runs the module compiled to the function constant at
+// constIndex, unless it was imported already.
+func (vm *VM) importModule(constIndex int) error {
+	if vm.imported[constIndex] {
+		return vm.push(Null)
+	}
+	if vm.imported == nil {
+		vm.imported = map[int]bool{}
+	}
+	vm.imported[constIndex] = true
+
+	module := &object.Closure{Fn: vm.constants[constIndex].(*object.CompiledFunction)}
+	if err := vm.push(module); err != nil {
+		return err
+	}
+	return vm.callClosure(module, 0)
+}
+
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+	copy(free, vm.stack[vm.sp-numFree:vm.sp])
+	vm.sp = vm.sp - numFree
+
+	closure := &object.Closure{Fn: function, Free: free}
+	return vm.push(closure)
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
+	hashedPairs := map[object.HashKey]object.HashPair{}
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, newError(object.TypeError, "given key '%s' is not hashable", key.Inspect())
+		}
+
+		hashedPairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	hash := &object.Hash{Pairs: hashedPairs}
+	if err := vm.meter.Limits().CheckSize(hash); err != nil {
+		return nil, err
+	}
+	return hash, nil
+}
+
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	switch {
+	case left.Type() == object.ARRAY && index.Type() == object.INTEGER:
+		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.STRING && index.Type() == object.INTEGER:
+		return vm.executeStringIndex(left, index)
+	case left.Type() == object.HASH:
+		return vm.executeHashIndex(left, index)
+	default:
+		return newError(object.TypeError, "index operator not supported: %s", left.Type())
+	}
+}
+
+func (vm *VM) executeArrayIndex(array, index object.Object) error {
+	arrayObject := array.(*object.Array)
+	i := index.(*object.Integer).Value
+
+	pos, ok := arrayObject.Position(i)
+	if !ok {
+		return newError(object.IndexError, "out of bounds error: index %d is out of range for array", i)
+	}
+
+	return vm.push(arrayObject.Values[pos])
+}
+
+func (vm *VM) executeStringIndex(str, index object.Object) error {
+	stringObject := str.(*object.String)
+	i := index.(*object.Integer).Value
+
+	char, ok := stringObject.At(i)
+	if !ok {
+		return newError(object.IndexError, "out of bounds error: index %d is out of range for string", i)
+	}
+
+	return vm.push(char)
+}
+
+func (vm *VM) executeHashIndex(hash, index object.Object) error {
+	hashObject := hash.(*object.Hash)
+
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newError(object.TypeError, "unusable as hash key: %s", index.Inspect())
+	}
+
+	pair, ok := hashObject.Pairs[key.HashKey()]
+	if !ok {
+		return vm.push(Null)
+	}
+
+	return vm.push(pair.Value)
+}
+
+// executeSetIndex sets an element of an array or hash in place, pushing
+// either the new value or, if keepPrevious is set, the one it replaced.
+func (vm *VM) executeSetIndex(left, index, value object.Object, keepPrevious bool) error {
+	var previous object.Object = Null
+
+	switch {
+	case left.Type() == object.ARRAY && index.Type() == object.INTEGER:
+		arrayObject := left.(*object.Array)
+		i := index.(*object.Integer).Value
+
+		pos, ok := arrayObject.Position(i)
+		if !ok {
+			return newError(object.IndexError, "out of bounds error: index %d is out of range for array", i)
+		}
+
+		previous = arrayObject.Values[pos]
+		arrayObject.Set(pos, value)
+	case left.Type() == object.HASH:
+		hashObject := left.(*object.Hash)
+
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError(object.TypeError, "unusable as hash key: %s", index.Inspect())
+		}
+
+		if pair, ok := hashObject.Pairs[key.HashKey()]; ok {
+			previous = pair.Value
+		}
+		hashObject.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: value}
+		// Assigning to a new key grows a hash.
+		if err := vm.meter.Limits().CheckSize(hashObject); err != nil {
+			return err
+		}
+	default:
+		return newError(object.TypeError, "index operator not supported: %s", left.Type())
+	}
+
+	if keepPrevious {
+		return vm.push(previous)
+	}
+	return vm.push(value)
+}
+
+// operators maps the binary operation opcodes to their source operator, for
+// use in error messages.
+var operators = map[code.Opcode]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpPow:          "**",
+	code.OpRem:          "%",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+	code.OpGreaterThan:  ">",
+	code.OpGreaterEqual: ">=",
+	code.OpLessThan:     "<",
+	code.OpLessEqual:    "<=",
+	code.OpAnd:          "&&",
+	code.OpOr:           "||",
+}
+
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	var result object.Object
+	var err error
+	switch {
+	case left.Type() == object.INTEGER && right.Type() == object.INTEGER:
+		result, err = executeIntegerOperation(op, left, right, vm.checkedArithmetic)
+	case isNumber(left) && isNumber(right):
+		// At least one of the operands is a float, so the other one is
+		// promoted to a float too.
+		result, err = executeFloatOperation(op, left, right)
+	case left.Type() == object.BOOLEAN && right.Type() == object.BOOLEAN:
+		result, err = executeBooleanOperation(op, left, right)
+	case left.Type() == object.STRING && right.Type() == object.STRING:
+		result, err = executeStringOperation(op, left, right, vm.meter.Limits())
+	case left.Type() != right.Type():
+		err = newError(object.TypeError, "type mismatch: %s %s %s", left.Type(), operators[op], right.Type())
+	default:
+		err = unknownOperatorError(op, left, right)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return vm.push(result)
+}
+
+// executeIntegerOperation applies op to two integers. Arithmetic wraps around
+// on overflow unless checked is set, in which case overflow is reported as an
+// error.
+func executeIntegerOperation(op code.Opcode, left, right object.Object, checked bool) (object.Object, error) {
+	leftVal := left.(*object.Integer).Value
+	rightVal := right.(*object.Integer).Value
+
+	// integer returns the result of an arithmetic operation, or an error if
+	// it overflowed and overflow is being checked.
+	integer := func(result int64, overflow bool) (object.Object, error) {
+		if checked && overflow {
+			return nil, newError(object.ArithmeticError, "integer overflow: %d %s %d", leftVal, operators[op], rightVal)
+		}
+		return &object.Integer{Value: result}, nil
+	}
+
+	switch op {
+	// Arithmetic operators
+	case code.OpAdd:
+		return integer(object.AddInt64(leftVal, rightVal))
+	case code.OpSub:
+		return integer(object.SubInt64(leftVal, rightVal))
+	case code.OpMul:
+		return integer(object.MulInt64(leftVal, rightVal))
+	case code.OpDiv:
+		if rightVal == 0 {
+			return nil, newError(object.ArithmeticError, "division by zero")
+		}
+		// The only quotient that doesn't fit is math.MinInt64 / -1.
+		return integer(leftVal/rightVal, leftVal == math.MinInt64 && rightVal == -1)
+	case code.OpPow:
+		power, overflow := object.IntegerPow(leftVal, rightVal)
+		if checked && overflow {
+			return nil, newError(object.ArithmeticError, "integer overflow: %d ** %d", leftVal, rightVal)
+		}
+		return power, nil
+	case code.OpRem:
+		if rightVal == 0 {
+			return nil, newError(object.ArithmeticError, "modulo by zero")
+		}
+		return &object.Integer{Value: leftVal % rightVal}, nil
+
+	// Comparison operators
+	case code.OpLessThan:
+		return nativeBoolToBooleanObject(leftVal < rightVal), nil
+	case code.OpLessEqual:
+		return nativeBoolToBooleanObject(leftVal <= rightVal), nil
+	case code.OpGreaterThan:
+		return nativeBoolToBooleanObject(leftVal > rightVal), nil
+	case code.OpGreaterEqual:
+		return nativeBoolToBooleanObject(leftVal >= rightVal), nil
+	case code.OpEqual:
+		return nativeBoolToBooleanObject(leftVal == rightVal), nil
+	case code.OpNotEqual:
+		return nativeBoolToBooleanObject(leftVal != rightVal), nil
+
+	// Boolean operators
+	case code.OpAnd:
+		return nativeBoolToBooleanObject((leftVal != 0) && (rightVal != 0)), nil
+	case code.OpOr:
+		return nativeBoolToBooleanObject((leftVal != 0) || (rightVal != 0)), nil
+
+	default:
+		return nil, unknownOperatorError(op, left, right)
+	}
+}
+
+func executeFloatOperation(op code.Opcode, left, right object.Object) (object.Object, error) {
+	leftVal, _ := object.ToFloat(left)
+	rightVal, _ := object.ToFloat(right)
+
+	switch op {
+	// Arithmetic operators
+	case code.OpAdd:
+		return &object.Float{Value: leftVal + rightVal}, nil
+	case code.OpSub:
+		return &object.Float{Value: leftVal - rightVal}, nil
+	case code.OpMul:
+		return &object.Float{Value: leftVal * rightVal}, nil
+	case code.OpDiv:
+		// Dividing floats by zero is an error, as it is for integers,
+		// rather than giving an infinity or NaN.
+		if rightVal == 0 {
+			return nil, newError(object.ArithmeticError, "division by zero")
+		}
+		return &object.Float{Value: leftVal / rightVal}, nil
+	case code.OpPow:
+		return &object.Float{Value: math.Pow(leftVal, rightVal)}, nil
+	case code.OpRem:
+		if rightVal == 0 {
+			return nil, newError(object.ArithmeticError, "modulo by zero")
+		}
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}, nil
+
+	// Comparison operators
+	case code.OpLessThan:
+		return nativeBoolToBooleanObject(leftVal < rightVal), nil
+	case code.OpLessEqual:
+		return nativeBoolToBooleanObject(leftVal <= rightVal), nil
+	case code.OpGreaterThan:
+		return nativeBoolToBooleanObject(leftVal > rightVal), nil
+	case code.OpGreaterEqual:
+		return nativeBoolToBooleanObject(leftVal >= rightVal), nil
+	case code.OpEqual:
+		return nativeBoolToBooleanObject(leftVal == rightVal), nil
+	case code.OpNotEqual:
+		return nativeBoolToBooleanObject(leftVal != rightVal), nil
+
+	// Boolean operators
+	case code.OpAnd:
+		return nativeBoolToBooleanObject((leftVal != 0) && (rightVal != 0)), nil
+	case code.OpOr:
+		return nativeBoolToBooleanObject((leftVal != 0) || (rightVal != 0)), nil
+
+	default:
+		return nil, unknownOperatorError(op, left, right)
+	}
+}
+
+func executeBooleanOperation(op code.Opcode, left, right object.Object) (object.Object, error) {
+	leftVal := left.(*object.Boolean).Value
+	rightVal := right.(*object.Boolean).Value
+
+	switch op {
+	case code.OpAnd:
+		return nativeBoolToBooleanObject(leftVal && rightVal), nil
+	case code.OpOr:
+		return nativeBoolToBooleanObject(leftVal || rightVal), nil
+	case code.OpEqual:
+		return nativeBoolToBooleanObject(leftVal == rightVal), nil
+	case code.OpNotEqual:
+		return nativeBoolToBooleanObject(leftVal != rightVal), nil
+	default:
+		return nil, unknownOperatorError(op, left, right)
+	}
+}
+
+// executeStringOperation applies op to two strings, checking that
+// concatenating them doesn't exceed limits before doing so.
+func executeStringOperation(op code.Opcode, left, right object.Object, limits object.Limits) (object.Object, error) {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	switch op {
+	case code.OpAdd:
+		if err := limits.CheckStringLength(len(leftVal) + len(rightVal)); err != nil {
+			return nil, err
+		}
+		return &object.String{Value: leftVal + rightVal}, nil
+	case code.OpEqual:
+		return nativeBoolToBooleanObject(leftVal == rightVal), nil
+	case code.OpNotEqual:
+		return nativeBoolToBooleanObject(leftVal != rightVal), nil
+	default:
+		return nil, unknownOperatorError(op, left, right)
+	}
+}
+
+func unknownOperatorError(op code.Opcode, left, right object.Object) error {
+	return newError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+}
+
+func executeBangOperator(operand object.Object) object.Object {
+	switch operand {
+	case True:
+		return False
+	case False:
+		return True
+	case Null:
+		return True
+	default:
+		return False
+	}
+}
+
+func (vm *VM) executeMinusOperator() error {
+	operand := vm.pop()
+
+	switch operand := operand.(type) {
+	case *object.Integer:
+		if vm.checkedArithmetic && operand.Value == math.MinInt64 {
+			return newError(object.ArithmeticError, "integer overflow: -(%d)", operand.Value)
+		}
+		return vm.push(&object.Integer{Value: -operand.Value})
+	case *object.Float:
+		return vm.push(&object.Float{Value: -operand.Value})
+	default:
+		return newError(object.TypeError, "unknown operator: -%s", operand.Type())
+	}
+}
+
+func isNumber(o object.Object) bool {
+	_, ok := object.ToFloat(o)
+	return ok
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return True
+	}
+	return False
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case Null:
+		return false
+	case True:
+		return true
+	case False:
+		return false
+	default:
+		return true
+	}
+}
+
+func newError(kind object.ErrorKind, format string, a ...interface{}) *object.Error {
+	return &object.Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
+}
@@ -0,0 +1,122 @@
+package vm_test
+
+import (
+	"testing"
+
+	"github.com/makramkd/go-monkey/compiler"
+	"github.com/makramkd/go-monkey/lexer"
+	"github.com/makramkd/go-monkey/object"
+	"github.com/makramkd/go-monkey/parser"
+	"github.com/makramkd/go-monkey/token"
+	"github.com/makramkd/go-monkey/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+func run(t *testing.T, input string) (object.Object, error) {
+	t.Helper()
+
+	l := lexer.NewWithFilename("test.monkey", input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	assert.Empty(t, p.Errors())
+
+	c := compiler.New()
+	if !assert.NoError(t, c.Compile(program)) {
+		t.FailNow()
+	}
+
+	machine := vm.New(c.Bytecode())
+	err := machine.Run()
+	return machine.LastPoppedStackElem(), err
+}
+
+func TestRun(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected object.Object
+	}{
+		{"1 + 2", &object.Integer{Value: 3}},
+		{"let a = 1; a;", &object.Integer{Value: 1}},
+		{"let a = 1;", vm.Null},
+		{"return 5; 10;", &object.Integer{Value: 5}},
+		{"if (true) { return 5; }; 10;", &object.Integer{Value: 5}},
+		{`"a" + "b"`, &object.String{Value: "ab"}},
+		{"[1, 2][0] == 1", vm.True},
+	}
+
+	for _, testCase := range testCases {
+		result, err := run(t, testCase.input)
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.expected, result, testCase.input)
+	}
+}
+
+func TestStackGrowsOnDemand(t *testing.T) {
+	// Each call needs a few stack slots, so this goes well beyond the
+	// initial stack size.
+	input := `
+let count = fn(n) { if (n == 0) { 0 } else { 1 + count(n - 1) } };
+count(5000);`
+
+	result, err := run(t, input)
+	assert.NoError(t, err)
+	assert.Equal(t, &object.Integer{Value: 5000}, result)
+}
+
+func TestStackOverflow(t *testing.T) {
+	_, err := run(t, "let f = fn() { 1 + f() }; f();")
+	if assert.IsType(t, &object.Error{}, err) {
+		assert.Equal(t, "stack overflow", err.(*object.Error).Message)
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected object.Object
+	}{
+		{"let count = fn(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } }; count(200000, 0);", &object.Integer{Value: 200000}},
+		{`let f = fn(n) { if (n == 0) { return "done"; } return f(n - 1); }; f(200000);`, &object.String{Value: "done"}},
+		{"let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; even(100001);", vm.False},
+		{"let f = fn(n) { let m = n - 1; if (m < 0) { len([]) } else { f(m) } }; f(100000);", &object.Integer{Value: 0}},
+		// Tail calls replace the locals of the caller, which closures may
+		// still refer to.
+		{"let f = fn(n, g) { let m = n * 10; if (n == 0) { g() } else { f(n - 1, fn() { m }) } }; f(3, fn() { 0 });", &object.Integer{Value: 10}},
+	}
+
+	for _, testCase := range testCases {
+		result, err := run(t, testCase.input)
+		assert.NoError(t, err, testCase.input)
+		assert.Equal(t, testCase.expected, result, testCase.input)
+	}
+
+	// Tail calls keep their frames for tracebacks.
+	_, err := run(t, "let f = fn(n) { if (n == 0) { 1 + true } else { f(n - 1) } };\nf(100000);")
+	if assert.IsType(t, &object.Error{}, err) {
+		assert.Len(t, err.(*object.Error).Stack, 100001)
+		assert.Equal(t, `Traceback (most recent call last):
+  test.monkey:2:1: in <main>
+  test.monkey:1:49: in f
+  [previous line repeated 99999 more times]
+  test.monkey:1:31: in f
+`, err.(*object.Error).Traceback())
+	}
+}
+
+func TestRuntimeErrorPositions(t *testing.T) {
+	input := `let add = fn(a, b) {
+	a + b
+};
+add(1, true);`
+
+	_, err := run(t, input)
+	assert.Equal(t, &object.Error{
+		Kind:    object.TypeError,
+		Message: "type mismatch: INTEGER + BOOLEAN",
+		Pos:     token.Position{Filename: "test.monkey", Offset: 22, Line: 2, Column: 2},
+		Stack: []object.Frame{
+			{Function: "add", Pos: token.Position{Filename: "test.monkey", Offset: 31, Line: 4, Column: 1}},
+		},
+	}, err)
+	assert.EqualError(t, err, "test.monkey:2:2: type mismatch: INTEGER + BOOLEAN")
+}